@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/itsLeonB/smtproxy/internal/adapters/smtp"
+	"github.com/itsLeonB/smtproxy/internal/core/config"
+	"github.com/itsLeonB/smtproxy/internal/core/password"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/parser"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/policy"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/routing"
+)
+
+// runCommand executes a CLI subcommand and returns the process exit code
+func runCommand(name string, args []string) int {
+	switch name {
+	case "hash-password":
+		return hashPassword(args, os.Stdin, os.Stdout, os.Stderr)
+	case "config":
+		return configCommand(args, os.Stdout, os.Stderr)
+	case "route":
+		return routeCommand(args, os.Stdin, os.Stdout, os.Stderr)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", name)
+		fmt.Fprintln(os.Stderr, "usage: smtproxy [hash-password | config check | route test]")
+		return 2
+	}
+}
+
+// hashPassword reads a password from stdin and prints a credentials file entry
+func hashPassword(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("hash-password", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	scheme := fs.String("scheme", password.SchemeBcrypt, "hash scheme: bcrypt, argon2id or sha512-crypt")
+	user := fs.String("user", "", "prefix the hash with user: for use in AUTH_CREDENTIALS_FILE")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	plain, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		fmt.Fprintf(stderr, "failed to read password: %v\n", err)
+		return 1
+	}
+	plain = strings.TrimRight(plain, "\r\n")
+	if plain == "" {
+		fmt.Fprintln(stderr, "password must not be empty")
+		return 1
+	}
+
+	hash, err := password.Hash(*scheme, plain)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	if *user != "" {
+		fmt.Fprintf(stdout, "%s:%s\n", *user, hash)
+	} else {
+		fmt.Fprintln(stdout, hash)
+	}
+	return 0
+}
+
+// configCommand validates the configuration from the config file and the
+// environment without starting the server
+func configCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprintln(stderr, "usage: smtproxy config check [-file path]")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("config check", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	file := fs.String("file", os.Getenv("CONFIG_FILE"), "config file to validate, defaults to CONFIG_FILE")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if _, err := config.Read(*file); err != nil {
+		fmt.Fprintln(stderr, "configuration is invalid:")
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintf(stderr, "  %s\n", line)
+		}
+		return 1
+	}
+
+	fmt.Fprintln(stdout, "configuration OK")
+	return 0
+}
+
+// routeCommand reports which provider the routing rules would choose for a
+// message read from stdin or -message, without sending it
+func routeCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "test" {
+		fmt.Fprintln(stderr, "usage: smtproxy route test [-file path] [-user name] [-from address] [-to addresses] [-message path]")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("route test", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	file := fs.String("file", os.Getenv("CONFIG_FILE"), "config file with the routing rules, defaults to CONFIG_FILE")
+	user := fs.String("user", "", "authenticated user sending the message")
+	from := fs.String("from", "", "envelope sender, defaults to the From header")
+	to := fs.String("to", "", "comma-separated envelope recipients, defaults to the To and Cc headers")
+	messagePath := fs.String("message", "", "message file, defaults to stdin")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	cfg, err := config.Read(*file)
+	if err != nil {
+		fmt.Fprintf(stderr, "configuration is invalid: %v\n", err)
+		return 1
+	}
+	router, err := smtp.NewRouter(cfg)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	message := stdin
+	if *messagePath != "" {
+		f, err := os.Open(*messagePath)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		message = f
+	}
+	counter := &countingReader{reader: message}
+	email, err := parser.New(cfg.MaxSize).Parse(counter)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to parse message: %v\n", err)
+		return 1
+	}
+
+	email.Envelope.From = *from
+	if email.Envelope.From == "" && email.Headers.From != nil {
+		email.Envelope.From = email.Headers.From.Address
+	}
+	if *to != "" {
+		for _, addr := range strings.Split(*to, ",") {
+			email.Envelope.To = append(email.Envelope.To, strings.TrimSpace(addr))
+		}
+	} else {
+		for _, addr := range append(email.Headers.To, email.Headers.CC...) {
+			email.Envelope.To = append(email.Envelope.To, addr.Address)
+		}
+	}
+
+	// A provider bound by the user's policy takes precedence over the rules
+	if cfg.PolicyFile != "" && *user != "" {
+		policies, err := policy.LoadFile(cfg.PolicyFile)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		if bound := policy.NewManagerFromFile(policies).Lookup(*user).Provider; bound != "" {
+			fmt.Fprintf(stdout, "policy for %s binds provider %s\n", *user, bound)
+			return 0
+		}
+	}
+
+	decision := routing.Decision{}
+	if router != nil {
+		decision = router.Evaluate(routing.Message{User: *user, Email: email, Size: counter.n})
+	}
+	if decision.Rule == "" {
+		fmt.Fprintf(stdout, "no rule matched, default provider %s\n", cfg.DefaultProvider)
+		return 0
+	}
+	fmt.Fprintf(stdout, "rule %q matched, provider %s\n", decision.Rule, decision.Provider)
+	return 0
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.n += int64(n)
+	return n, err
+}
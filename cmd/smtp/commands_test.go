@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itsLeonB/smtproxy/internal/core/password"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashPassword(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	code := hashPassword([]string{"-user", "alice", "-scheme", "sha512-crypt"}, strings.NewReader("s3cret\n"), &stdout, &stderr)
+
+	assert.Equal(t, 0, code)
+	user, hash, found := strings.Cut(strings.TrimSpace(stdout.String()), ":")
+	assert.True(t, found)
+	assert.Equal(t, "alice", user)
+	assert.True(t, strings.HasPrefix(hash, "$6$"))
+	assert.True(t, password.Verify(hash, "s3cret"))
+}
+
+func TestHashPassword_EmptyPassword(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	code := hashPassword(nil, strings.NewReader("\n"), &stdout, &stderr)
+
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), "must not be empty")
+}
+
+func TestHashPassword_UnknownScheme(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	code := hashPassword([]string{"-scheme", "md5"}, strings.NewReader("s3cret\n"), &stdout, &stderr)
+
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), "unknown password scheme")
+}
+
+func TestConfigCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "smtproxy.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("brevo:\n  api_key: key\n"), 0o600))
+	var stdout, stderr bytes.Buffer
+
+	code := configCommand([]string{"check", "-file", path}, &stdout, &stderr)
+
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout.String(), "configuration OK")
+}
+
+func TestConfigCommand_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "smtproxy.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("brevo:\n  api_key: key\nlisteners:\n  smtp:\n    port: \"0\"\n"), 0o600))
+	var stdout, stderr bytes.Buffer
+
+	code := configCommand([]string{"check", "-file", path}, &stdout, &stderr)
+
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), `SMTP_PORT: "0" is not a port number`)
+}
+
+func TestConfigCommand_Usage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	code := configCommand(nil, &stdout, &stderr)
+
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr.String(), "usage: smtproxy config check")
+}
+
+func TestRouteCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "smtproxy.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(`
+default_provider: brevo-tx
+providers:
+  - {name: brevo-tx, type: brevo, api_key: tx-key}
+  - {name: brevo-mkt, type: brevo, api_key: mkt-key}
+routes:
+  - name: newsletters
+    match:
+      headers: {X-Mailer: "Newsletter*"}
+    provider: brevo-mkt
+`), 0o600))
+	message := "From: news@example.com\r\nTo: user@example.org\r\nX-Mailer: Newsletter 2.0\r\nSubject: News\r\n\r\nHello"
+
+	var stdout, stderr bytes.Buffer
+	code := routeCommand([]string{"test", "-file", path}, strings.NewReader(message), &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, "rule \"newsletters\" matched, provider brevo-mkt\n", stdout.String())
+
+	stdout.Reset()
+	code = routeCommand([]string{"test", "-file", path}, strings.NewReader("Subject: Hi\r\n\r\nHello"), &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, "no rule matched, default provider brevo-tx\n", stdout.String())
+}
+
+func TestRouteCommand_InvalidRoutes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "smtproxy.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("brevo:\n  api_key: key\nroutes:\n  - provider: missing\n"), 0o600))
+	var stdout, stderr bytes.Buffer
+
+	code := routeCommand([]string{"test", "-file", path}, strings.NewReader("Subject: Hi\r\n\r\nHello"), &stdout, &stderr)
+
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), `routes[0]: provider "missing" is not a configured provider`)
+}
@@ -1,19 +1,53 @@
 package main
 
 import (
+	"context"
+	"os"
+	"time"
+
 	"github.com/itsLeonB/smtproxy/internal/adapters/smtp"
 	"github.com/itsLeonB/smtproxy/internal/core/config"
 	"github.com/itsLeonB/smtproxy/internal/core/logger"
+	"github.com/itsLeonB/smtproxy/internal/core/tracing"
 	_ "github.com/joho/godotenv/autoload"
 )
 
+// tracingFlushTimeout bounds how long exiting waits for buffered spans to be exported
+const tracingFlushTimeout = 5 * time.Second
+
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	logger.Init("smtproxy")
 
 	if err := config.Load(); err != nil {
 		logger.Fatal(err)
 	}
 
+	if err := logger.Configure("smtproxy", logger.Options{
+		Level:  config.Global.LogLevel,
+		Format: config.Global.LogFormat,
+		Redact: config.Global.LogRedact,
+	}); err != nil {
+		logger.Fatal(err)
+	}
+
+	if config.Global.TracingEnabled {
+		shutdown, err := tracing.Init(context.Background(), "smtproxy")
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+			defer cancel()
+			if err := shutdown(ctx); err != nil {
+				logger.Errorf("failed to flush traces: %v", err)
+			}
+		}()
+	}
+
 	srv, err := smtp.Setup()
 	if err != nil {
 		logger.Fatal(err)
@@ -0,0 +1,80 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/core/logger"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/audit"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// AuditSearcher looks up message history
+type AuditSearcher interface {
+	Search(q audit.Query) ([]*audit.Record, error)
+}
+
+// EnableAudit serves message history at GET /audit/messages
+func (s *Server) EnableAudit(searcher AuditSearcher) {
+	s.mux.HandleFunc("GET /audit/messages", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		query, err := parseAuditQuery(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		records, err := searcher.Search(query)
+		if err != nil {
+			logger.Errorf("audit search failed: %v", err)
+			writeError(w, http.StatusInternalServerError, "audit search failed")
+			return
+		}
+		if records == nil {
+			records = []*audit.Record{}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"messages": records})
+	}))
+}
+
+// parseAuditQuery reads id, provider_message_id, sender, recipient, since,
+// until (RFC 3339) and limit
+func parseAuditQuery(r *http.Request) (audit.Query, error) {
+	params := r.URL.Query()
+	query := audit.Query{
+		ID:                params.Get("id"),
+		ProviderMessageID: params.Get("provider_message_id"),
+		Sender:            params.Get("sender"),
+		Recipient:         params.Get("recipient"),
+		Limit:             defaultAuditLimit,
+	}
+
+	var err error
+	if query.Since, err = parseTime(params.Get("since")); err != nil {
+		return query, fmt.Errorf("invalid since: %w", err)
+	}
+	if query.Until, err = parseTime(params.Get("until")); err != nil {
+		return query, fmt.Errorf("invalid until: %w", err)
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return query, fmt.Errorf("invalid limit %q", limit)
+		}
+		query.Limit = min(n, maxAuditLimit)
+	}
+	return query, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
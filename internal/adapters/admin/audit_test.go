@@ -0,0 +1,81 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/domain/service/audit"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSearcher records the last query and returns fixed records
+type fakeSearcher struct {
+	query   audit.Query
+	records []*audit.Record
+}
+
+func (f *fakeSearcher) Search(q audit.Query) ([]*audit.Record, error) {
+	f.query = q
+	return f.records, nil
+}
+
+func newAuditServer(token string) (*Server, *fakeSearcher) {
+	searcher := &fakeSearcher{records: []*audit.Record{{ID: "m1", Status: audit.StatusDelivered}}}
+	server := NewServer(":0")
+	server.SetToken(token)
+	server.EnableAudit(searcher)
+	return server, searcher
+}
+
+func auditRequest(server *Server, target, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAudit_RequiresToken(t *testing.T) {
+	server, _ := newAuditServer("secret")
+
+	assert.Equal(t, http.StatusUnauthorized, auditRequest(server, "/audit/messages", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, auditRequest(server, "/audit/messages", "wrong").Code)
+}
+
+func TestAudit_DisabledWithoutToken(t *testing.T) {
+	server, _ := newAuditServer("")
+
+	assert.Equal(t, http.StatusUnauthorized, auditRequest(server, "/audit/messages", "anything").Code)
+}
+
+func TestAudit_Search(t *testing.T) {
+	server, searcher := newAuditServer("secret")
+
+	rec := auditRequest(server, "/audit/messages?recipient=bob@example.org&sender=app@example.com&provider_message_id=%3Cp1@example.com%3E&since=2026-03-01T00:00:00Z&limit=5000", "secret")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Messages []audit.Record `json:"messages"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Len(t, body.Messages, 1)
+	assert.Equal(t, "m1", body.Messages[0].ID)
+
+	assert.Equal(t, "bob@example.org", searcher.query.Recipient)
+	assert.Equal(t, "app@example.com", searcher.query.Sender)
+	assert.Equal(t, "<p1@example.com>", searcher.query.ProviderMessageID)
+	assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), searcher.query.Since)
+	assert.Equal(t, maxAuditLimit, searcher.query.Limit)
+}
+
+func TestAudit_InvalidQuery(t *testing.T) {
+	server, _ := newAuditServer("secret")
+
+	assert.Equal(t, http.StatusBadRequest, auditRequest(server, "/audit/messages?since=yesterday", "secret").Code)
+	assert.Equal(t, http.StatusBadRequest, auditRequest(server, "/audit/messages?limit=-1", "secret").Code)
+}
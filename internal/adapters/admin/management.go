@@ -0,0 +1,256 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/core/logger"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/provider"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/queue"
+)
+
+// healthCheckTimeout bounds each provider health check when listing providers
+const healthCheckTimeout = 5 * time.Second
+
+// Reloader reloads configuration from its source
+type Reloader interface {
+	Load() error
+}
+
+type providerStatus struct {
+	Name        string        `json:"name"`
+	Default     bool          `json:"default"`
+	Enabled     bool          `json:"enabled"`
+	Weight      int           `json:"weight,omitempty"`
+	Circuit     string        `json:"circuit"`
+	Healthy     bool          `json:"healthy"`
+	HealthError string        `json:"health_error,omitempty"`
+	Stats       providerStats `json:"stats"`
+}
+
+type providerStats struct {
+	Sent        uint64    `json:"sent"`
+	Failed      uint64    `json:"failed"`
+	LastSuccess time.Time `json:"last_success,omitzero"`
+	LastFailure time.Time `json:"last_failure,omitzero"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+type queuedMessage struct {
+	ID          string    `json:"id"`
+	SessionID   string    `json:"session_id,omitempty"`
+	Provider    string    `json:"provider,omitempty"`
+	From        string    `json:"from"`
+	To          []string  `json:"to"`
+	Subject     string    `json:"subject"`
+	Attempts    int       `json:"attempts"`
+	EnqueuedAt  time.Time `json:"enqueued_at"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// EnableProviders serves provider status and failover controls under
+// /admin/providers, and circuit breaker states in /healthz, for the
+// registry returned by current, which changes when the configuration is
+// reloaded
+func (s *Server) EnableProviders(current func() *provider.Registry) {
+	s.registry = current
+
+	s.mux.HandleFunc("GET /admin/providers", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"providers": providerStatuses(r.Context(), current())})
+	}))
+
+	s.mux.HandleFunc("POST /admin/providers/{name}/default", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		registry := current()
+		name := r.PathValue("name")
+		if !providerExists(w, registry, name) {
+			return
+		}
+		if err := registry.SetDefault(name); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		logger.InfoContext(r.Context(), "default provider set", "provider", name, "admin", r.RemoteAddr)
+		writeJSON(w, http.StatusOK, map[string]string{"default": name})
+	}))
+
+	for action, enabled := range map[string]bool{"enable": true, "disable": false} {
+		s.mux.HandleFunc("POST /admin/providers/{name}/"+action, s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+			registry := current()
+			name := r.PathValue("name")
+			if !providerExists(w, registry, name) {
+				return
+			}
+
+			var err error
+			if enabled {
+				err = registry.Enable(name)
+			} else {
+				err = registry.Disable(name)
+			}
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			logger.InfoContext(r.Context(), "provider "+action+"d", "provider", name, "admin", r.RemoteAddr)
+			writeJSON(w, http.StatusOK, map[string]any{"name": name, "enabled": enabled})
+		}))
+	}
+}
+
+// providerExists writes a 404 response if the registry has no provider called name
+func providerExists(w http.ResponseWriter, registry *provider.Registry, name string) bool {
+	if _, err := registry.GetProvider(name); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return false
+	}
+	return true
+}
+
+// providerStatuses checks every provider's health concurrently
+func providerStatuses(ctx context.Context, registry *provider.Registry) []providerStatus {
+	names := registry.ListProviders()
+	defaultName := registry.Default()
+	weights := registry.Weights()
+	statuses := make([]providerStatus, len(names))
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		stats := registry.Stats(name)
+		statuses[i] = providerStatus{
+			Name:    name,
+			Default: name == defaultName,
+			Enabled: registry.Enabled(name),
+			Weight:  weights[name],
+			Circuit: registry.Circuit(name).String(),
+			Stats: providerStats{
+				Sent:        stats.Sent,
+				Failed:      stats.Failed,
+				LastSuccess: stats.LastSuccess,
+				LastFailure: stats.LastFailure,
+				LastError:   stats.LastError,
+			},
+		}
+
+		p, err := registry.GetProvider(name)
+		if err != nil {
+			statuses[i].HealthError = err.Error()
+			continue
+		}
+		wg.Add(1)
+		go func(status *providerStatus) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+			if err := p.IsHealthy(checkCtx); err != nil {
+				status.HealthError = err.Error()
+				return
+			}
+			status.Healthy = true
+		}(&statuses[i])
+	}
+	wg.Wait()
+
+	return statuses
+}
+
+// EnableQueue serves inspection, retry and purge of queued messages under /admin/queue
+func (s *Server) EnableQueue(q *queue.Queue) {
+	s.mux.HandleFunc("GET /admin/queue", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		messages := q.Messages()
+		result := make([]queuedMessage, 0, len(messages))
+		for _, msg := range messages {
+			result = append(result, toQueuedMessage(msg))
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"messages": result})
+	}))
+
+	s.mux.HandleFunc("GET /admin/queue/{id}", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		msg, err := q.Get(r.PathValue("id"))
+		if err != nil {
+			writeQueueError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, toQueuedMessage(msg))
+	}))
+
+	s.mux.HandleFunc("POST /admin/queue/{id}/retry", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if err := q.Retry(id); err != nil {
+			writeQueueError(w, err)
+			return
+		}
+		logger.InfoContext(r.Context(), "queued message retried", "message_id", id, "admin", r.RemoteAddr)
+		writeJSON(w, http.StatusOK, map[string]string{"id": id})
+	}))
+
+	s.mux.HandleFunc("POST /admin/queue/retry", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		retried := q.RetryAll()
+		logger.InfoContext(r.Context(), "queued messages retried", "count", retried, "admin", r.RemoteAddr)
+		writeJSON(w, http.StatusOK, map[string]int{"retried": retried})
+	}))
+
+	s.mux.HandleFunc("DELETE /admin/queue/{id}", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if err := q.Purge(id); err != nil {
+			writeQueueError(w, err)
+			return
+		}
+		logger.InfoContext(r.Context(), "queued message purged", "message_id", id, "admin", r.RemoteAddr)
+		writeJSON(w, http.StatusOK, map[string]string{"id": id})
+	}))
+
+	s.mux.HandleFunc("DELETE /admin/queue", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		purged := q.PurgeAll()
+		logger.InfoContext(r.Context(), "queued messages purged", "count", purged, "admin", r.RemoteAddr)
+		writeJSON(w, http.StatusOK, map[string]int{"purged": purged})
+	}))
+}
+
+func toQueuedMessage(msg queue.Message) queuedMessage {
+	result := queuedMessage{
+		ID:          msg.ID,
+		SessionID:   msg.SessionID,
+		Provider:    msg.Provider,
+		Attempts:    msg.Attempts,
+		EnqueuedAt:  msg.EnqueuedAt,
+		NextAttempt: msg.NextAttempt,
+	}
+	if msg.Email != nil {
+		result.From = msg.Email.Envelope.From
+		result.To = msg.Email.Envelope.To
+		result.Subject = msg.Email.Headers.Subject
+	}
+	if msg.LastError != nil {
+		result.LastError = msg.LastError.Error()
+	}
+	return result
+}
+
+// writeQueueError maps queue errors to HTTP status codes
+func writeQueueError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, queue.ErrMessageNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, queue.ErrQueueClosed):
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// EnableCredentialsReload serves POST /admin/credentials/reload
+func (s *Server) EnableCredentialsReload(reloader Reloader) {
+	s.mux.HandleFunc("POST /admin/credentials/reload", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		if err := reloader.Load(); err != nil {
+			logger.ErrorContext(r.Context(), "credentials reload failed", "admin", r.RemoteAddr, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to reload credentials, keeping previous users")
+			return
+		}
+		logger.InfoContext(r.Context(), "credentials reloaded", "admin", r.RemoteAddr)
+		writeJSON(w, http.StatusOK, map[string]string{"status": "reloaded"})
+	}))
+}
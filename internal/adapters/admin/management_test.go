@@ -0,0 +1,208 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/core/requestctx"
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/provider"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+const testToken = "secret"
+
+func adminRequest(server *Server, method, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func newProviderServer() (*Server, *provider.Registry, *provider.MockProvider) {
+	registry := provider.NewRegistry()
+	primary := provider.NewMockProvider("primary")
+	backup := provider.NewMockProvider("backup")
+	_ = registry.Register(primary)
+	_ = registry.Register(backup)
+
+	server := NewServer(":0")
+	server.SetToken(testToken)
+	server.EnableProviders(func() *provider.Registry { return registry })
+	return server, registry, backup
+}
+
+func TestProviders_RequireToken(t *testing.T) {
+	server, _, _ := newProviderServer()
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/providers", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestProviders_List(t *testing.T) {
+	server, registry, backup := newProviderServer()
+	backup.SetHealthy(false)
+	_, _ = registry.Send(context.Background(), &entity.Email{}, "primary")
+
+	rec := adminRequest(server, http.MethodGet, "/admin/providers")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Providers []providerStatus `json:"providers"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Len(t, body.Providers, 2)
+
+	assert.Equal(t, "backup", body.Providers[0].Name)
+	assert.False(t, body.Providers[0].Default)
+	assert.False(t, body.Providers[0].Healthy)
+	assert.Equal(t, "provider unhealthy", body.Providers[0].HealthError)
+
+	assert.Equal(t, "primary", body.Providers[1].Name)
+	assert.True(t, body.Providers[1].Default)
+	assert.True(t, body.Providers[1].Enabled)
+	assert.True(t, body.Providers[1].Healthy)
+	assert.Equal(t, uint64(1), body.Providers[1].Stats.Sent)
+	assert.Equal(t, "closed", body.Providers[1].Circuit)
+}
+
+func TestProviders_HealthReportsCircuits(t *testing.T) {
+	server, registry, backup := newProviderServer()
+	registry.SetBreaker(provider.BreakerConfig{Threshold: 1, Cooldown: time.Minute, Probes: 1})
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.JSONEq(t, `{"status":"ok","circuits":{"backup":"closed","primary":"closed"}}`, rec.Body.String())
+
+	backup.SetSendError(context.DeadlineExceeded)
+	_, _ = registry.Send(context.Background(), &entity.Email{}, "backup")
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"status":"degraded","circuits":{"backup":"open","primary":"closed"}}`, rec.Body.String())
+}
+
+func TestProviders_SetDefault(t *testing.T) {
+	server, registry, _ := newProviderServer()
+
+	assert.Equal(t, http.StatusOK, adminRequest(server, http.MethodPost, "/admin/providers/backup/default").Code)
+	assert.Equal(t, "backup", registry.Default())
+
+	assert.Equal(t, http.StatusNotFound, adminRequest(server, http.MethodPost, "/admin/providers/missing/default").Code)
+}
+
+func TestProviders_EnableDisable(t *testing.T) {
+	server, registry, _ := newProviderServer()
+
+	assert.Equal(t, http.StatusOK, adminRequest(server, http.MethodPost, "/admin/providers/primary/disable").Code)
+	assert.False(t, registry.Enabled("primary"))
+
+	assert.Equal(t, http.StatusOK, adminRequest(server, http.MethodPost, "/admin/providers/primary/enable").Code)
+	assert.True(t, registry.Enabled("primary"))
+
+	assert.Equal(t, http.StatusNotFound, adminRequest(server, http.MethodPost, "/admin/providers/missing/disable").Code)
+}
+
+func newQueueServer(t *testing.T) (*Server, *queue.Queue) {
+	t.Helper()
+	q := queue.New(queue.Config{Workers: 1}, nil)
+	email := &entity.Email{
+		Headers:  entity.Headers{Subject: "Hello"},
+		Envelope: entity.Envelope{From: "app@example.com", To: []string{"bob@example.org"}},
+	}
+	for _, id := range []string{"m1", "m2"} {
+		_, err := q.Enqueue(requestctx.WithMessageID(context.Background(), id), email, "")
+		assert.NoError(t, err)
+	}
+
+	server := NewServer(":0")
+	server.SetToken(testToken)
+	server.EnableQueue(q)
+	return server, q
+}
+
+func TestQueue_List(t *testing.T) {
+	server, _ := newQueueServer(t)
+
+	rec := adminRequest(server, http.MethodGet, "/admin/queue")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Messages []queuedMessage `json:"messages"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Len(t, body.Messages, 2)
+	assert.Equal(t, "app@example.com", body.Messages[0].From)
+	assert.Equal(t, "Hello", body.Messages[0].Subject)
+}
+
+func TestQueue_Get(t *testing.T) {
+	server, _ := newQueueServer(t)
+
+	rec := adminRequest(server, http.MethodGet, "/admin/queue/m1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var msg queuedMessage
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &msg))
+	assert.Equal(t, "m1", msg.ID)
+	assert.Equal(t, []string{"bob@example.org"}, msg.To)
+
+	assert.Equal(t, http.StatusNotFound, adminRequest(server, http.MethodGet, "/admin/queue/missing").Code)
+}
+
+func TestQueue_Retry(t *testing.T) {
+	server, _ := newQueueServer(t)
+
+	assert.Equal(t, http.StatusOK, adminRequest(server, http.MethodPost, "/admin/queue/m1/retry").Code)
+	assert.Equal(t, http.StatusNotFound, adminRequest(server, http.MethodPost, "/admin/queue/missing/retry").Code)
+
+	rec := adminRequest(server, http.MethodPost, "/admin/queue/retry")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"retried":0}`, rec.Body.String())
+}
+
+func TestQueue_Purge(t *testing.T) {
+	server, q := newQueueServer(t)
+
+	assert.Equal(t, http.StatusOK, adminRequest(server, http.MethodDelete, "/admin/queue/m1").Code)
+	assert.Equal(t, 1, q.Len())
+	assert.Equal(t, http.StatusNotFound, adminRequest(server, http.MethodDelete, "/admin/queue/m1").Code)
+
+	rec := adminRequest(server, http.MethodDelete, "/admin/queue")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"purged":1}`, rec.Body.String())
+	assert.Equal(t, 0, q.Len())
+}
+
+// fakeReloader counts reloads and returns err
+type fakeReloader struct {
+	calls int
+	err   error
+}
+
+func (f *fakeReloader) Load() error {
+	f.calls++
+	return f.err
+}
+
+func TestCredentialsReload(t *testing.T) {
+	reloader := &fakeReloader{}
+	server := NewServer(":0")
+	server.SetToken(testToken)
+	server.EnableCredentialsReload(reloader)
+
+	assert.Equal(t, http.StatusOK, adminRequest(server, http.MethodPost, "/admin/credentials/reload").Code)
+	assert.Equal(t, 1, reloader.calls)
+
+	reloader.err = errors.New("parse error")
+	assert.Equal(t, http.StatusInternalServerError, adminRequest(server, http.MethodPost, "/admin/credentials/reload").Code)
+}
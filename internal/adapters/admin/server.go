@@ -0,0 +1,129 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/core/logger"
+	"github.com/itsLeonB/smtproxy/internal/core/metrics"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/provider"
+)
+
+// Server exposes metrics and health checks over HTTP, and management
+// endpoints that require a bearer token
+type Server struct {
+	server *http.Server
+	mux    *http.ServeMux
+	addr   string
+	token  string
+	// registry returns the providers whose circuits /healthz reports, if set
+	registry func() *provider.Registry
+}
+
+// NewServer creates an HTTP server listening on addr
+func NewServer(addr string) *Server {
+	mux := http.NewServeMux()
+	s := &Server{
+		server: &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+		mux:  mux,
+		addr: addr,
+	}
+
+	mux.Handle("GET /metrics", metrics.Handler())
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+
+	return s
+}
+
+// SetToken sets the bearer token required by management endpoints.
+// Without a token they reject every request.
+func (s *Server) SetToken(token string) {
+	s.token = token
+}
+
+// Handler returns the server's request handler
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Start listens on the configured address and serves in the background
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.addr, err)
+	}
+
+	go func() {
+		if err := s.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("HTTP server error: %v", err)
+		}
+	}()
+
+	logger.Infof("HTTP server started on %s", s.addr)
+	return nil
+}
+
+// Shutdown stops the server, waiting for active requests until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// handleHealth reports "ok", or "degraded" while a provider's circuit
+// breaker is not closed. The proxy keeps accepting mail either way, so the
+// status code stays 200.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if s.registry == nil {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		return
+	}
+
+	registry := s.registry()
+	status := "ok"
+	circuits := make(map[string]string)
+	for _, name := range registry.ListProviders() {
+		state := registry.Circuit(name)
+		if state != provider.CircuitClosed {
+			status = "degraded"
+		}
+		circuits[name] = state.String()
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status": status, "circuits": circuits})
+}
+
+// authenticated rejects requests without the configured bearer token
+func (s *Server) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if s.token == "" || !found || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="smtproxy"`)
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Errorf("failed to write HTTP response: %v", err)
+	}
+}
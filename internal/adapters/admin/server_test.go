@@ -0,0 +1,33 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/itsLeonB/smtproxy/internal/core/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_Health(t *testing.T) {
+	server := NewServer(":0")
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"status":"ok"}`, rec.Body.String())
+}
+
+func TestServer_Metrics(t *testing.T) {
+	server := NewServer(":0")
+	metrics.AuthFailures.Inc()
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "smtproxy_auth_failures_total")
+	assert.Contains(t, rec.Body.String(), "go_goroutines")
+}
@@ -0,0 +1,112 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/itsLeonB/smtproxy/internal/core/logger"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/suppression"
+)
+
+// maxImportSize bounds the CSV accepted by POST /admin/suppressions/import
+const maxImportSize = 16 << 20
+
+// SuppressionList manages the suppressed recipient addresses
+type SuppressionList interface {
+	Lookup(address string) (suppression.Entry, bool)
+	Add(e suppression.Entry) (suppression.Entry, error)
+	Remove(address string) error
+	Entries() ([]suppression.Entry, error)
+	Export(w io.Writer) error
+	Import(r io.Reader) (int, error)
+}
+
+// EnableSuppressions serves listing, lookup, addition, removal and CSV
+// export and import of suppressed addresses under /admin/suppressions
+func (s *Server) EnableSuppressions(list SuppressionList) {
+	s.mux.HandleFunc("GET /admin/suppressions", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		entries, err := list.Entries()
+		if err != nil {
+			logger.Errorf("failed to list suppressions: %v", err)
+			writeError(w, http.StatusInternalServerError, "failed to list suppressions")
+			return
+		}
+		if entries == nil {
+			entries = []suppression.Entry{}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"suppressions": entries})
+	}))
+
+	s.mux.HandleFunc("GET /admin/suppressions/{address}", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		entry, found := list.Lookup(r.PathValue("address"))
+		if !found {
+			writeError(w, http.StatusNotFound, suppression.ErrNotFound.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, entry)
+	}))
+
+	s.mux.HandleFunc("POST /admin/suppressions", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		var entry suppression.Entry
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportSize)).Decode(&entry); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		entry, err := list.Add(entry)
+		if err != nil {
+			writeSuppressionError(w, err)
+			return
+		}
+		logger.InfoContext(r.Context(), "recipient suppressed", "recipient", entry.Address, "reason", entry.Reason, "admin", r.RemoteAddr)
+		writeJSON(w, http.StatusCreated, entry)
+	}))
+
+	s.mux.HandleFunc("DELETE /admin/suppressions/{address}", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		address := suppression.Normalize(r.PathValue("address"))
+		if err := list.Remove(address); err != nil {
+			writeSuppressionError(w, err)
+			return
+		}
+		logger.InfoContext(r.Context(), "recipient suppression lifted", "recipient", address, "admin", r.RemoteAddr)
+		writeJSON(w, http.StatusOK, map[string]string{"address": address})
+	}))
+
+	s.mux.HandleFunc("GET /admin/suppressions/export", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="suppressions.csv"`)
+		if err := list.Export(w); err != nil {
+			// The status has been sent with the first row, so the export just ends early
+			logger.Errorf("failed to export suppressions: %v", err)
+		}
+	}))
+
+	s.mux.HandleFunc("POST /admin/suppressions/import", s.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		imported, err := list.Import(http.MaxBytesReader(w, r.Body, maxImportSize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+				return
+			}
+			writeSuppressionError(w, err)
+			return
+		}
+		logger.InfoContext(r.Context(), "suppressions imported", "count", imported, "admin", r.RemoteAddr)
+		writeJSON(w, http.StatusOK, map[string]int{"imported": imported})
+	}))
+}
+
+// writeSuppressionError maps suppression list errors to HTTP status codes
+func writeSuppressionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, suppression.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, suppression.ErrInvalidEntry):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		logger.Errorf("suppression list update failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "suppression list update failed")
+	}
+}
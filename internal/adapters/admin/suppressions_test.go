@@ -0,0 +1,159 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/itsLeonB/smtproxy/internal/domain/service/suppression"
+	"github.com/stretchr/testify/assert"
+)
+
+// mapStore is a suppression.Store in a map that fails with err
+type mapStore struct {
+	entries map[string]suppression.Entry
+	err     error
+}
+
+func (m *mapStore) Put(e suppression.Entry) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.entries[e.Address] = e
+	return nil
+}
+
+func (m *mapStore) Get(address string) (suppression.Entry, error) {
+	e, found := m.entries[address]
+	if !found {
+		return e, suppression.ErrNotFound
+	}
+	return e, nil
+}
+
+func (m *mapStore) Delete(address string) error {
+	if _, found := m.entries[address]; !found {
+		return suppression.ErrNotFound
+	}
+	delete(m.entries, address)
+	return nil
+}
+
+func (m *mapStore) List() ([]suppression.Entry, error) {
+	var entries []suppression.Entry
+	for _, address := range slices.Sorted(maps.Keys(m.entries)) {
+		entries = append(entries, m.entries[address])
+	}
+	return entries, nil
+}
+
+func (m *mapStore) Close() error { return nil }
+
+func newSuppressionServer(addresses ...string) (*Server, *mapStore) {
+	store := &mapStore{entries: map[string]suppression.Entry{}}
+	list := suppression.NewList(store, suppression.ModeReject)
+	for _, address := range addresses {
+		_, _ = list.Add(suppression.Entry{Address: address})
+	}
+
+	server := NewServer(":0")
+	server.SetToken(testToken)
+	server.EnableSuppressions(list)
+	return server, store
+}
+
+func suppressionRequest(server *Server, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSuppressions_RequireToken(t *testing.T) {
+	server, _ := newSuppressionServer()
+	rec := httptest.NewRecorder()
+
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/suppressions", nil))
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestSuppressions_List(t *testing.T) {
+	server, _ := newSuppressionServer("bob@example.org", "alice@example.org")
+
+	rec := adminRequest(server, http.MethodGet, "/admin/suppressions")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Suppressions []suppression.Entry `json:"suppressions"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	if assert.Len(t, body.Suppressions, 2) {
+		assert.Equal(t, "alice@example.org", body.Suppressions[0].Address)
+		assert.Equal(t, suppression.ReasonManual, body.Suppressions[0].Reason)
+	}
+}
+
+func TestSuppressions_Get(t *testing.T) {
+	server, _ := newSuppressionServer("bob@example.org")
+
+	rec := adminRequest(server, http.MethodGet, "/admin/suppressions/Bob@Example.org")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"address":"bob@example.org"`)
+
+	assert.Equal(t, http.StatusNotFound, adminRequest(server, http.MethodGet, "/admin/suppressions/carol@example.org").Code)
+}
+
+func TestSuppressions_Add(t *testing.T) {
+	server, store := newSuppressionServer()
+
+	rec := suppressionRequest(server, http.MethodPost, "/admin/suppressions", `{"address":"Carol@Example.org","reason":"complaint","details":"reported by support"}`)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, suppression.ReasonComplaint, store.entries["carol@example.org"].Reason)
+	assert.Equal(t, "reported by support", store.entries["carol@example.org"].Details)
+
+	assert.Equal(t, http.StatusBadRequest, suppressionRequest(server, http.MethodPost, "/admin/suppressions", `{"address":"carol"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, suppressionRequest(server, http.MethodPost, "/admin/suppressions", `{"address":`).Code)
+
+	store.err = errors.New("disk full")
+	assert.Equal(t, http.StatusInternalServerError, suppressionRequest(server, http.MethodPost, "/admin/suppressions", `{"address":"dave@example.org"}`).Code)
+}
+
+func TestSuppressions_Remove(t *testing.T) {
+	server, store := newSuppressionServer("bob@example.org")
+
+	assert.Equal(t, http.StatusOK, adminRequest(server, http.MethodDelete, "/admin/suppressions/bob@example.org").Code)
+	assert.Empty(t, store.entries)
+	assert.Equal(t, http.StatusNotFound, adminRequest(server, http.MethodDelete, "/admin/suppressions/bob@example.org").Code)
+}
+
+func TestSuppressions_ExportImport(t *testing.T) {
+	source, _ := newSuppressionServer("bob@example.org", "alice@example.org")
+	export := adminRequest(source, http.MethodGet, "/admin/suppressions/export")
+	assert.Equal(t, http.StatusOK, export.Code)
+	assert.Equal(t, "text/csv", export.Header().Get("Content-Type"))
+
+	target, store := newSuppressionServer()
+	rec := suppressionRequest(target, http.MethodPost, "/admin/suppressions/import", export.Body.String())
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"imported":2}`, rec.Body.String())
+	assert.Len(t, store.entries, 2)
+}
+
+func TestSuppressions_ImportInvalid(t *testing.T) {
+	server, store := newSuppressionServer()
+
+	rec := suppressionRequest(server, http.MethodPost, "/admin/suppressions/import", "bob@example.org\nnot an address\n")
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "line 2")
+	assert.Empty(t, store.entries)
+}
@@ -0,0 +1,111 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/itsLeonB/smtproxy/internal/core/logger"
+	"github.com/itsLeonB/smtproxy/internal/core/metrics"
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+)
+
+// maxWebhookBodySize caps the webhook bodies read into memory
+const maxWebhookBodySize = 1 << 20 // 1MB
+
+// WebhookAuth verifies that webhook requests come from the provider. Each
+// check applies when it is set.
+type WebhookAuth struct {
+	// Token must be sent as a bearer token or as the basic auth password
+	Token string
+	// Networks are the addresses requests must come from
+	Networks []netip.Prefix
+}
+
+// EventParser decodes a provider's webhook body into delivery events
+type EventParser func(body []byte) ([]entity.DeliveryEvent, error)
+
+// EventHandler takes the delivery events of verified webhooks
+type EventHandler interface {
+	HandleEvents(ctx context.Context, events []entity.DeliveryEvent) error
+}
+
+// EnableWebhook receives a provider's delivery events at POST
+// /webhooks/{provider}. Requests failing auth are refused, and events that
+// can't be handled are answered with 503 so that the provider sends them
+// again.
+func (s *Server) EnableWebhook(provider string, auth WebhookAuth, parse EventParser, handler EventHandler) {
+	s.mux.HandleFunc("POST /webhooks/"+provider, func(w http.ResponseWriter, r *http.Request) {
+		reject := func(status int, reason, message string) {
+			metrics.WebhookRejected.WithLabelValues(provider, reason).Inc()
+			logger.WarnContext(r.Context(), "webhook rejected", "provider", provider, "reason", reason, "remote_addr", r.RemoteAddr)
+			writeError(w, status, message)
+		}
+
+		if !auth.allowsAddr(r.RemoteAddr) {
+			reject(http.StatusForbidden, "forbidden", "forbidden")
+			return
+		}
+		if !auth.allowsToken(r) {
+			reject(http.StatusUnauthorized, "unauthorized", "unauthorized")
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				reject(http.StatusRequestEntityTooLarge, "invalid", "request body too large")
+				return
+			}
+			reject(http.StatusBadRequest, "invalid", "failed to read request body")
+			return
+		}
+		events, err := parse(body)
+		if err != nil {
+			reject(http.StatusBadRequest, "invalid", err.Error())
+			return
+		}
+
+		if err := handler.HandleEvents(r.Context(), events); err != nil {
+			writeError(w, http.StatusServiceUnavailable, "events could not be handled, try again later")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"received": len(events)})
+	})
+}
+
+// allowsAddr reports whether remoteAddr is in one of the allowed networks
+func (a WebhookAuth) allowsAddr(remoteAddr string) bool {
+	if len(a.Networks) == 0 {
+		return true
+	}
+	addrPort, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	addr := addrPort.Addr().Unmap()
+	for _, network := range a.Networks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsToken reports whether r carries the token as a bearer token or as
+// the basic auth password
+func (a WebhookAuth) allowsToken(r *http.Request) bool {
+	if a.Token == "" {
+		return true
+	}
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		_, token, found = r.BasicAuth()
+	}
+	return found && subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) == 1
+}
@@ -0,0 +1,98 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeEventHandler collects events and fails with err
+type fakeEventHandler struct {
+	events []entity.DeliveryEvent
+	err    error
+}
+
+func (f *fakeEventHandler) HandleEvents(ctx context.Context, events []entity.DeliveryEvent) error {
+	f.events = append(f.events, events...)
+	return f.err
+}
+
+// parseTestEvents decodes a JSON array of events
+func parseTestEvents(body []byte) ([]entity.DeliveryEvent, error) {
+	var events []entity.DeliveryEvent
+	return events, json.Unmarshal(body, &events)
+}
+
+func newWebhookServer(auth WebhookAuth) (*Server, *fakeEventHandler) {
+	handler := &fakeEventHandler{}
+	server := NewServer(":0")
+	server.EnableWebhook("test", auth, parseTestEvents, handler)
+	return server, handler
+}
+
+func webhookRequest(server *Server, remoteAddr, body string, setAuth func(r *http.Request)) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/test", strings.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	if setAuth != nil {
+		setAuth(req)
+	}
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+const testEvents = `[{"type": "delivered", "provider": "test", "message_id": "<m1@example.com>"}]`
+
+func TestWebhook_Token(t *testing.T) {
+	server, handler := newWebhookServer(WebhookAuth{Token: "hook"})
+
+	assert.Equal(t, http.StatusUnauthorized, webhookRequest(server, "192.0.2.1:1234", testEvents, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, webhookRequest(server, "192.0.2.1:1234", testEvents, func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer wrong")
+	}).Code)
+	assert.Empty(t, handler.events)
+
+	rec := webhookRequest(server, "192.0.2.1:1234", testEvents, func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer hook")
+	})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"received": 1}`, rec.Body.String())
+
+	rec = webhookRequest(server, "192.0.2.1:1234", testEvents, func(r *http.Request) {
+		r.SetBasicAuth("brevo", "hook")
+	})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, handler.events, 2)
+	assert.Equal(t, "<m1@example.com>", handler.events[0].MessageID)
+}
+
+func TestWebhook_Networks(t *testing.T) {
+	server, handler := newWebhookServer(WebhookAuth{Networks: []netip.Prefix{netip.MustParsePrefix("1.179.112.0/20")}})
+
+	assert.Equal(t, http.StatusForbidden, webhookRequest(server, "192.0.2.1:1234", testEvents, nil).Code)
+	assert.Equal(t, http.StatusOK, webhookRequest(server, "1.179.113.9:1234", testEvents, nil).Code)
+	assert.Equal(t, http.StatusOK, webhookRequest(server, "[::ffff:1.179.113.9]:1234", testEvents, nil).Code)
+	assert.Len(t, handler.events, 2)
+}
+
+func TestWebhook_InvalidBody(t *testing.T) {
+	server, handler := newWebhookServer(WebhookAuth{})
+
+	assert.Equal(t, http.StatusBadRequest, webhookRequest(server, "192.0.2.1:1234", `{"type":`, nil).Code)
+	assert.Empty(t, handler.events)
+}
+
+func TestWebhook_HandlerFailure(t *testing.T) {
+	server, handler := newWebhookServer(WebhookAuth{})
+	handler.err = errors.New("callback unavailable")
+
+	assert.Equal(t, http.StatusServiceUnavailable, webhookRequest(server, "192.0.2.1:1234", testEvents, nil).Code)
+}
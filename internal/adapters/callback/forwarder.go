@@ -0,0 +1,95 @@
+package callback
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/core/tracing"
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+)
+
+// Headers set on forwarded requests so that receivers can verify them
+const (
+	TimestampHeader = "X-Smtproxy-Timestamp"
+	SignatureHeader = "X-Smtproxy-Signature"
+)
+
+// Config configures where delivery events are forwarded
+type Config struct {
+	URL string
+	// Secret signs each request, if set
+	Secret  string
+	Timeout time.Duration
+}
+
+// Forwarder posts delivery events as JSON to an application's callback URL
+type Forwarder struct {
+	config Config
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewForwarder creates a forwarder posting to config.URL
+func NewForwarder(config Config) *Forwarder {
+	return &Forwarder{
+		config: config,
+		client: &http.Client{
+			Timeout:   config.Timeout,
+			Transport: tracing.Transport(nil),
+		},
+		now: time.Now,
+	}
+}
+
+// Forward posts {"events": [...]} to the callback URL. With a secret, the
+// request carries the Unix time it was sent and an HMAC-SHA256 of that time,
+// a dot and the body, as sha256=<hex>. Any status but 2xx is an error.
+func (f *Forwarder) Forward(ctx context.Context, events []entity.DeliveryEvent) error {
+	body, err := json.Marshal(map[string]any{"events": events})
+	if err != nil {
+		return fmt.Errorf("failed to marshal events: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if f.config.Secret != "" {
+		timestamp := strconv.FormatInt(f.now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, "sha256="+Sign(f.config.Secret, timestamp, body))
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post events: %w", err)
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("callback returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the hex HMAC-SHA256 of timestamp, a dot and body under secret
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
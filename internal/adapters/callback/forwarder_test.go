@@ -0,0 +1,60 @@
+package callback
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwarder_Forward(t *testing.T) {
+	var received struct {
+		Events []entity.DeliveryEvent `json:"events"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "1792400000", r.Header.Get(TimestampHeader))
+		assert.Equal(t, "sha256="+Sign("s3cret", "1792400000", body), r.Header.Get(SignatureHeader))
+		assert.NoError(t, json.Unmarshal(body, &received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	forwarder := NewForwarder(Config{URL: server.URL, Secret: "s3cret", Timeout: time.Second})
+	forwarder.now = func() time.Time { return time.Unix(1792400000, 0) }
+	event := entity.DeliveryEvent{Type: entity.EventDelivered, Provider: "brevo", MessageID: "<m1@example.com>", At: time.Unix(1792400000, 0).UTC()}
+
+	assert.NoError(t, forwarder.Forward(context.Background(), []entity.DeliveryEvent{event}))
+	assert.Equal(t, []entity.DeliveryEvent{event}, received.Events)
+}
+
+func TestForwarder_Unsigned(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get(SignatureHeader))
+	}))
+	defer server.Close()
+
+	forwarder := NewForwarder(Config{URL: server.URL, Timeout: time.Second})
+
+	assert.NoError(t, forwarder.Forward(context.Background(), []entity.DeliveryEvent{{Type: entity.EventOpened}}))
+}
+
+func TestForwarder_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	forwarder := NewForwarder(Config{URL: server.URL, Timeout: time.Second})
+
+	err := forwarder.Forward(context.Background(), []entity.DeliveryEvent{{Type: entity.EventOpened}})
+	assert.ErrorContains(t, err, "callback returned status 502")
+}
@@ -8,9 +8,13 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/itsLeonB/smtproxy/internal/core/logger"
+	"github.com/itsLeonB/smtproxy/internal/core/requestctx"
+	"github.com/itsLeonB/smtproxy/internal/core/tracing"
 	"github.com/itsLeonB/smtproxy/internal/domain/entity"
 )
 
@@ -36,6 +40,9 @@ func previewBody(body []byte) string {
 type Provider struct {
 	config *Config
 	client *http.Client
+	// onRateLimit receives the quota reported by each response
+	onRateLimit func(remaining int, reset time.Duration)
+	now         func() time.Time
 }
 
 // NewProvider creates a new Brevo provider
@@ -43,45 +50,54 @@ func NewProvider(config *Config) *Provider {
 	return &Provider{
 		config: config,
 		client: &http.Client{
-			Timeout: config.Timeout,
+			Timeout:   config.Timeout,
+			Transport: tracing.Transport(nil),
 		},
+		now: time.Now,
 	}
 }
 
-// Name returns the provider name
+// Name returns the instance name, which defaults to "brevo"
 func (p *Provider) Name() string {
+	if p.config.Name != "" {
+		return p.config.Name
+	}
 	return "brevo"
 }
 
-// Send sends an email via Brevo API
-func (p *Provider) Send(ctx context.Context, email *entity.Email) error {
+// Send sends an email via Brevo API and returns the messageId Brevo assigned to it
+func (p *Provider) Send(ctx context.Context, email *entity.Email) (string, error) {
 	// Convert entity.Email to Brevo request
 	request := p.buildRequest(email)
 
 	// Marshal request
 	payload, err := json.Marshal(request)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		return "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	logger.Debugf("brevo request built: to=%d cc=%d bcc=%d attachments=%d payload_bytes=%d",
-		len(request.To), len(request.CC), len(request.BCC), len(request.Attachments), len(payload))
+	messageID := requestctx.MessageID(ctx)
+	logger.DebugContext(ctx, "brevo request built", "provider", p.Name(), "to", len(request.To), "cc", len(request.CC), "bcc", len(request.BCC),
+		"attachments", len(request.Attachments), "payload_bytes", len(payload))
 
 	// Create HTTP request
 	url := p.config.BaseURL + "/smtp/email"
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(payload))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return "", fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set headers
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("api-key", p.config.APIKey)
+	if messageID != "" {
+		req.Header.Set("X-Request-Id", messageID)
+	}
 
 	// Send request
 	resp, err := p.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
+		return "", fmt.Errorf("request failed: %w", err)
 	}
 	defer func() {
 		if e := resp.Body.Close(); e != nil {
@@ -94,25 +110,77 @@ func (p *Provider) Send(ctx context.Context, email *entity.Email) error {
 	// without buffering unbounded data into memory.
 	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBodySize+1))
 	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
+		return "", fmt.Errorf("failed to read response body: %w", err)
 	}
 	if len(respBody) > maxResponseBodySize {
-		return fmt.Errorf("brevo response body exceeds maximum allowed size of %d bytes", maxResponseBodySize)
+		return "", fmt.Errorf("brevo response body exceeds maximum allowed size of %d bytes", maxResponseBodySize)
 	}
-	logger.Debugf("brevo response status=%d body_bytes=%d preview=%s", resp.StatusCode, len(respBody), previewBody(respBody))
+	logger.DebugContext(ctx, "brevo response", "provider", p.Name(), "status", resp.StatusCode, "body_bytes", len(respBody), "preview", previewBody(respBody))
+	p.reportRateLimit(resp.Header)
 
 	// Handle response
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		return nil
+		// The message was sent even if its ID can't be read
+		var sendResp SendResponse
+		if len(respBody) > 0 {
+			if err := json.Unmarshal(respBody, &sendResp); err != nil {
+				logger.WarnContext(ctx, "failed to parse brevo response", "provider", p.Name(), "error", err)
+			}
+		}
+		return sendResp.MessageID, nil
 	}
 
 	// Parse error response
 	var errorResp ErrorResponse
 	if err := json.Unmarshal(respBody, &errorResp); err != nil {
-		return fmt.Errorf("HTTP %d: failed to parse error response", resp.StatusCode)
+		return "", &APIError{StatusCode: resp.StatusCode, Err: fmt.Errorf("HTTP %d: failed to parse error response", resp.StatusCode), Wait: p.retryAfter(resp)}
+	}
+
+	return "", &APIError{StatusCode: resp.StatusCode, Err: p.mapError(resp.StatusCode, &errorResp), Wait: p.retryAfter(resp)}
+}
+
+// OnRateLimit registers a function called with the x-sib-ratelimit-remaining
+// and x-sib-ratelimit-reset headers of each response that has them
+func (p *Provider) OnRateLimit(fn func(remaining int, reset time.Duration)) {
+	p.onRateLimit = fn
+}
+
+// reportRateLimit passes the quota headers of a response to onRateLimit
+func (p *Provider) reportRateLimit(header http.Header) {
+	if p.onRateLimit == nil {
+		return
+	}
+	remaining, err := strconv.Atoi(header.Get("x-sib-ratelimit-remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.Atoi(header.Get("x-sib-ratelimit-reset"))
+	if err != nil {
+		return
 	}
+	p.onRateLimit(remaining, time.Duration(reset)*time.Second)
+}
 
-	return p.mapError(resp.StatusCode, &errorResp)
+// retryAfter returns how long a 429 or 503 response asks to wait, from
+// Retry-After in seconds or as a date, else from x-sib-ratelimit-reset
+func (p *Provider) retryAfter(resp *http.Response) time.Duration {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0
+	}
+	if value := resp.Header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			return time.Duration(max(seconds, 0)) * time.Second
+		}
+		if date, err := http.ParseTime(value); err == nil {
+			return max(date.Sub(p.now()), 0)
+		}
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if seconds, err := strconv.Atoi(resp.Header.Get("x-sib-ratelimit-reset")); err == nil {
+			return time.Duration(max(seconds, 0)) * time.Second
+		}
+	}
+	return 0
 }
 
 // IsHealthy checks if the provider is available
@@ -194,14 +262,9 @@ func (p *Provider) buildRequest(email *entity.Email) *SendRequest {
 
 	// Set attachments
 	for _, attachment := range email.Attachments {
-		content, err := io.ReadAll(attachment.Content)
-		if err != nil {
-			continue // Skip invalid attachments
-		}
-		
 		request.Attachments = append(request.Attachments, Attachment{
 			Name:    attachment.Filename,
-			Content: base64.StdEncoding.EncodeToString(content),
+			Content: base64.StdEncoding.EncodeToString(attachment.Content),
 		})
 	}
 
@@ -3,7 +3,7 @@ package brevo
 import (
 	"context"
 	"encoding/base64"
-	"io"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"net/mail"
@@ -11,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/itsLeonB/smtproxy/internal/core/requestctx"
 	"github.com/itsLeonB/smtproxy/internal/domain/entity"
 	"github.com/stretchr/testify/assert"
 )
@@ -22,6 +23,12 @@ func TestProvider_Name(t *testing.T) {
 	assert.Equal(t, "brevo", provider.Name())
 }
 
+func TestProvider_Name_Instance(t *testing.T) {
+	provider := NewProvider(&Config{Name: "brevo-tx", APIKey: "test-key"})
+
+	assert.Equal(t, "brevo-tx", provider.Name())
+}
+
 func TestProvider_Send_Success(t *testing.T) {
 	// Mock server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -52,7 +59,28 @@ func TestProvider_Send_Success(t *testing.T) {
 		HTMLBody: "<p>Test body</p>",
 	}
 
-	err := provider.Send(context.Background(), email)
+	messageID, err := provider.Send(context.Background(), email)
+	assert.NoError(t, err)
+	assert.Equal(t, "test-message-id", messageID)
+}
+
+func TestProvider_Send_RequestID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "message-1", r.Header.Get("X-Request-Id"))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	provider := NewProvider(&Config{APIKey: "test-api-key", BaseURL: server.URL, Timeout: 30 * time.Second})
+	email := &entity.Email{
+		Headers: entity.Headers{
+			From: &mail.Address{Address: "sender@example.com"},
+			To:   []*mail.Address{{Address: "recipient@example.com"}},
+		},
+		TextBody: "Test body",
+	}
+
+	_, err := provider.Send(requestctx.WithMessageID(context.Background(), "message-1"), email)
 	assert.NoError(t, err)
 }
 
@@ -78,7 +106,7 @@ func TestProvider_Send_BadRequest(t *testing.T) {
 		},
 	}
 
-	err := provider.Send(context.Background(), email)
+	_, err := provider.Send(context.Background(), email)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "invalid email address")
 }
@@ -105,7 +133,7 @@ func TestProvider_Send_Unauthorized(t *testing.T) {
 		},
 	}
 
-	err := provider.Send(context.Background(), email)
+	_, err := provider.Send(context.Background(), email)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "authentication failed")
 }
@@ -132,11 +160,71 @@ func TestProvider_Send_RateLimit(t *testing.T) {
 		},
 	}
 
-	err := provider.Send(context.Background(), email)
+	_, err := provider.Send(context.Background(), email)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "rate limit exceeded")
 }
 
+func TestProvider_Send_RetryAfter(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		headers map[string]string
+		want    time.Duration
+	}{
+		{"seconds", http.StatusTooManyRequests, map[string]string{"Retry-After": "30"}, 30 * time.Second},
+		{"date", http.StatusServiceUnavailable, map[string]string{"Retry-After": "Thu, 01 Jan 2026 00:01:00 GMT"}, time.Minute},
+		{"reset header", http.StatusTooManyRequests, map[string]string{"x-sib-ratelimit-reset": "12"}, 12 * time.Second},
+		{"no hint", http.StatusTooManyRequests, nil, 0},
+		{"not throttled", http.StatusBadRequest, map[string]string{"Retry-After": "30"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for key, value := range tt.headers {
+					w.Header().Set(key, value)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(`{"message": "Too many requests"}`))
+			}))
+			defer server.Close()
+
+			provider := NewProvider(&Config{APIKey: "test-api-key", BaseURL: server.URL, Timeout: 30 * time.Second})
+			provider.now = func() time.Time { return time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+			_, err := provider.Send(context.Background(), &entity.Email{})
+
+			var apiErr *APIError
+			assert.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, tt.want, apiErr.RetryAfter())
+		})
+	}
+}
+
+func TestProvider_OnRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-sib-ratelimit-limit", "100")
+		w.Header().Set("x-sib-ratelimit-remaining", "42")
+		w.Header().Set("x-sib-ratelimit-reset", "7")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"messageId": "<id@smtp-relay.mailin.fr>"}`))
+	}))
+	defer server.Close()
+
+	provider := NewProvider(&Config{APIKey: "test-api-key", BaseURL: server.URL, Timeout: 30 * time.Second})
+	var remaining int
+	var reset time.Duration
+	provider.OnRateLimit(func(r int, d time.Duration) {
+		remaining, reset = r, d
+	})
+
+	_, err := provider.Send(context.Background(), &entity.Email{})
+	assert.NoError(t, err)
+	assert.Equal(t, 42, remaining)
+	assert.Equal(t, 7*time.Second, reset)
+}
+
 func TestProvider_Send_ServiceUnavailable(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusServiceUnavailable)
@@ -159,9 +247,13 @@ func TestProvider_Send_ServiceUnavailable(t *testing.T) {
 		},
 	}
 
-	err := provider.Send(context.Background(), email)
+	_, err := provider.Send(context.Background(), email)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "service unavailable")
+
+	var apiErr *APIError
+	assert.ErrorAs(t, err, &apiErr)
+	assert.True(t, apiErr.Transient())
 }
 
 func TestProvider_IsHealthy_Success(t *testing.T) {
@@ -295,13 +387,13 @@ func TestProvider_BuildRequest_WithAttachments(t *testing.T) {
 				Filename:    "test.txt",
 				ContentType: "text/plain",
 				Size:        11,
-				Content:     strings.NewReader("Hello World"),
+				Content:     []byte("Hello World"),
 			},
 			{
 				Filename:    "data.json",
 				ContentType: "application/json",
 				Size:        13,
-				Content:     strings.NewReader(`{"key":"value"}`),
+				Content:     []byte(`{"key":"value"}`),
 			},
 		},
 	}
@@ -339,46 +431,38 @@ func TestProvider_BuildRequest_EmptyAttachments(t *testing.T) {
 	assert.Empty(t, request.Attachments)
 }
 
-type errorReader struct{}
-
-func (e errorReader) Read(p []byte) (n int, err error) {
-	return 0, io.ErrUnexpectedEOF
-}
-
-func TestProvider_BuildRequest_AttachmentReadError(t *testing.T) {
-	config := &Config{APIKey: "test-key"}
-	provider := NewProvider(config)
+func TestProvider_Send_SameEmailTwice(t *testing.T) {
+	var attachments []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request SendRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		if assert.Len(t, request.Attachments, 1) {
+			attachments = append(attachments, request.Attachments[0].Content)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"messageId": "test-message-id"}`))
+	}))
+	defer server.Close()
 
+	provider := NewProvider(&Config{APIKey: "test-api-key", BaseURL: server.URL, Timeout: 30 * time.Second})
 	email := &entity.Email{
 		Headers: entity.Headers{
 			From:    &mail.Address{Address: "sender@example.com"},
 			To:      []*mail.Address{{Address: "recipient@example.com"}},
-			Subject: "Test with invalid attachment",
-		},
-		TextBody: "Email with invalid attachment",
-		Attachments: []entity.Attachment{
-			{
-				Filename:    "valid.txt",
-				ContentType: "text/plain",
-				Size:        5,
-				Content:     strings.NewReader("valid"),
-			},
-			{
-				Filename:    "invalid.txt",
-				ContentType: "text/plain",
-				Size:        0,
-				Content:     errorReader{},
-			},
+			Subject: "Retried with attachment",
 		},
+		TextBody:    "Email with attachment",
+		Attachments: []entity.Attachment{{Filename: "test.txt", ContentType: "text/plain", Size: 11, Content: []byte("Hello World")}},
 	}
 
-	request := provider.buildRequest(email)
+	// Retries and failover send the same email again
+	_, err := provider.Send(context.Background(), email)
+	assert.NoError(t, err)
+	_, err = provider.Send(context.Background(), email)
+	assert.NoError(t, err)
 
-	// Should only include the valid attachment
-	assert.Len(t, request.Attachments, 1)
-	assert.Equal(t, "valid.txt", request.Attachments[0].Name)
-	expectedContent := base64.StdEncoding.EncodeToString([]byte("valid"))
-	assert.Equal(t, expectedContent, request.Attachments[0].Content)
+	expected := base64.StdEncoding.EncodeToString([]byte("Hello World"))
+	assert.Equal(t, []string{expected, expected}, attachments)
 }
 
 func TestProvider_Send_WithAttachments(t *testing.T) {
@@ -418,11 +502,11 @@ func TestProvider_Send_WithAttachments(t *testing.T) {
 				Filename:    "test.txt",
 				ContentType: "text/plain",
 				Size:        11,
-				Content:     strings.NewReader("Hello World"),
+				Content:     []byte("Hello World"),
 			},
 		},
 	}
 
-	err := provider.Send(context.Background(), email)
+	_, err := provider.Send(context.Background(), email)
 	assert.NoError(t, err)
 }
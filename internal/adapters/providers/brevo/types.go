@@ -6,6 +6,8 @@ import (
 
 // Config holds Brevo provider configuration
 type Config struct {
+	// Name identifies this instance in the registry, "brevo" when empty
+	Name    string
 	APIKey  string        `envconfig:"BREVO_API_KEY"`
 	BaseURL string        `envconfig:"BREVO_BASE_URL" default:"https://api.brevo.com/v3"`
 	Timeout time.Duration `envconfig:"BREVO_TIMEOUT" default:"30s"`
@@ -45,3 +47,31 @@ type ErrorResponse struct {
 	Message string `json:"message"`
 	Code    string `json:"code"`
 }
+
+// APIError is an error response from the Brevo API
+type APIError struct {
+	StatusCode int
+	Err        error
+	// Wait is how long Brevo asked to wait before retrying, if it did
+	Wait time.Duration
+}
+
+// Error returns the mapped error message
+func (e *APIError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the mapped error
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfter returns how long Brevo asked to wait before retrying
+func (e *APIError) RetryAfter() time.Duration {
+	return e.Wait
+}
+
+// Transient reports whether Brevo itself failed, so that the request may succeed later
+func (e *APIError) Transient() bool {
+	return e.StatusCode >= 500
+}
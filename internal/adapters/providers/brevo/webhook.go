@@ -0,0 +1,95 @@
+package brevo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+)
+
+// WebhookEvent is a transactional email event posted by Brevo
+type WebhookEvent struct {
+	Event     string `json:"event"`
+	Email     string `json:"email"`
+	MessageID string `json:"message-id"`
+	Reason    string `json:"reason"`
+	Link      string `json:"link"`
+	// TS is when the message was sent, TSEvent when the event happened, both
+	// in seconds, and TSEpoch the event time in milliseconds
+	TS      int64 `json:"ts"`
+	TSEvent int64 `json:"ts_event"`
+	TSEpoch int64 `json:"ts_epoch"`
+}
+
+// eventTypes maps Brevo event names to normalized types. Events missing
+// here, such as request, are not reported.
+var eventTypes = map[string]entity.EventType{
+	"delivered":         entity.EventDelivered,
+	"deferred":          entity.EventDeferred,
+	"soft_bounce":       entity.EventBounced,
+	"hard_bounce":       entity.EventBounced,
+	"invalid_email":     entity.EventRejected,
+	"blocked":           entity.EventRejected,
+	"error":             entity.EventRejected,
+	"spam":              entity.EventComplained,
+	"complaint":         entity.EventComplained,
+	"opened":            entity.EventOpened,
+	"unique_opened":     entity.EventOpened,
+	"proxy_open":        entity.EventOpened,
+	"unique_proxy_open": entity.EventOpened,
+	"click":             entity.EventClicked,
+	"unsubscribed":      entity.EventUnsubscribed,
+}
+
+// ParseWebhook decodes a Brevo webhook body, a single event or a batch of
+// them, into normalized delivery events reported by the named provider
+// instance
+func ParseWebhook(provider string, body []byte) ([]entity.DeliveryEvent, error) {
+	var raw []WebhookEvent
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &raw); err != nil {
+			return nil, fmt.Errorf("invalid Brevo webhook: %w", err)
+		}
+	} else {
+		var event WebhookEvent
+		if err := json.Unmarshal(trimmed, &event); err != nil {
+			return nil, fmt.Errorf("invalid Brevo webhook: %w", err)
+		}
+		raw = append(raw, event)
+	}
+
+	events := make([]entity.DeliveryEvent, 0, len(raw))
+	for _, e := range raw {
+		eventType, known := eventTypes[e.Event]
+		if !known || e.MessageID == "" {
+			continue
+		}
+		events = append(events, entity.DeliveryEvent{
+			Type:      eventType,
+			Provider:  provider,
+			MessageID: e.MessageID,
+			Recipient: e.Email,
+			At:        e.time(),
+			Permanent: e.Event == "hard_bounce",
+			Reason:    e.Reason,
+			URL:       e.Link,
+		})
+	}
+	return events, nil
+}
+
+// time returns when the event happened, as precisely as Brevo reported it
+func (e WebhookEvent) time() time.Time {
+	switch {
+	case e.TSEpoch > 0:
+		return time.UnixMilli(e.TSEpoch).UTC()
+	case e.TSEvent > 0:
+		return time.Unix(e.TSEvent, 0).UTC()
+	case e.TS > 0:
+		return time.Unix(e.TS, 0).UTC()
+	default:
+		return time.Now().UTC()
+	}
+}
@@ -0,0 +1,64 @@
+package brevo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWebhook(t *testing.T) {
+	body := []byte(`{
+		"event": "hard_bounce",
+		"email": "bob@example.org",
+		"id": 26224,
+		"date": "2026-10-19 09:12:03",
+		"ts": 1792400000,
+		"message-id": "<202610190912.41d8a0e6c2b97f35@smtp-relay.mailin.fr>",
+		"ts_event": 1792400123,
+		"subject": "Invoice",
+		"reason": "550 5.1.1 mailbox unavailable",
+		"ts_epoch": 1792400123456
+	}`)
+
+	events, err := ParseWebhook("brevo-marketing", body)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []entity.DeliveryEvent{{
+		Type:      entity.EventBounced,
+		Provider:  "brevo-marketing",
+		MessageID: "<202610190912.41d8a0e6c2b97f35@smtp-relay.mailin.fr>",
+		Recipient: "bob@example.org",
+		At:        time.UnixMilli(1792400123456).UTC(),
+		Permanent: true,
+		Reason:    "550 5.1.1 mailbox unavailable",
+	}}, events)
+}
+
+func TestParseWebhook_Batch(t *testing.T) {
+	body := []byte(`[
+		{"event": "request", "message-id": "<m1@smtp-relay.mailin.fr>", "ts_event": 1792400000},
+		{"event": "unique_opened", "message-id": "<m1@smtp-relay.mailin.fr>", "ts_event": 1792400100},
+		{"event": "click", "message-id": "<m1@smtp-relay.mailin.fr>", "link": "https://example.com/", "ts_event": 1792400200},
+		{"event": "spam", "message-id": "<m2@smtp-relay.mailin.fr>", "ts": 1792400300},
+		{"event": "delivered"}
+	]`)
+
+	events, err := ParseWebhook("brevo", body)
+
+	assert.NoError(t, err)
+	assert.Len(t, events, 3)
+	assert.Equal(t, entity.EventOpened, events[0].Type)
+	assert.Equal(t, time.Unix(1792400100, 0).UTC(), events[0].At)
+	assert.Equal(t, entity.EventClicked, events[1].Type)
+	assert.Equal(t, "https://example.com/", events[1].URL)
+	assert.Equal(t, entity.EventComplained, events[2].Type)
+	assert.Equal(t, "<m2@smtp-relay.mailin.fr>", events[2].MessageID)
+}
+
+func TestParseWebhook_Invalid(t *testing.T) {
+	_, err := ParseWebhook("brevo", []byte(`{"event": `))
+
+	assert.ErrorContains(t, err, "invalid Brevo webhook")
+}
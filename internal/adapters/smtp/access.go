@@ -0,0 +1,104 @@
+package smtp
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// AccessList decides which clients may connect and which may relay without
+// authentication, similar to Postfix's mynetworks
+type AccessList struct {
+	allow   []netip.Prefix
+	deny    []netip.Prefix
+	trusted []netip.Prefix
+}
+
+// NewAccessList parses CIDR ranges or single addresses. An empty allow list
+// admits every client that is not denied. Trusted networks are implicitly
+// allowed, and deny always takes precedence.
+func NewAccessList(allow, deny, trusted []string) (*AccessList, error) {
+	var (
+		list AccessList
+		err  error
+	)
+	if list.allow, err = parsePrefixes(allow); err != nil {
+		return nil, err
+	}
+	if list.deny, err = parsePrefixes(deny); err != nil {
+		return nil, err
+	}
+	if list.trusted, err = parsePrefixes(trusted); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// Allowed reports whether a client at addr may open a session
+func (a *AccessList) Allowed(addr netip.Addr) bool {
+	if containsAddr(a.deny, addr) {
+		return false
+	}
+	if len(a.allow) == 0 {
+		return true
+	}
+	return containsAddr(a.allow, addr) || containsAddr(a.trusted, addr)
+}
+
+// Trusted reports whether a client at addr may relay without authentication
+func (a *AccessList) Trusted(addr netip.Addr) bool {
+	return !containsAddr(a.deny, addr) && containsAddr(a.trusted, addr)
+}
+
+// parsePrefixes parses entries such as "10.0.0.0/8", "192.168.1.10" or "::1"
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q: %w", entry, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteAddr extracts the IP address of a connected client
+func remoteAddr(addr net.Addr) (netip.Addr, bool) {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		ip, ok := netip.AddrFromSlice(tcpAddr.IP)
+		return ip.Unmap(), ok
+	}
+
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addrPort.Addr().Unmap(), true
+}
@@ -0,0 +1,67 @@
+package smtp
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessList_Allowed(t *testing.T) {
+	access, err := NewAccessList(
+		[]string{"10.0.0.0/8", "2001:db8::/32"},
+		[]string{"10.0.5.0/24"},
+		[]string{"192.168.1.10"},
+	)
+	assert.NoError(t, err)
+
+	assert.True(t, access.Allowed(netip.MustParseAddr("10.1.2.3")))
+	assert.True(t, access.Allowed(netip.MustParseAddr("2001:db8::1")))
+	assert.True(t, access.Allowed(netip.MustParseAddr("::ffff:10.1.2.3")))
+	assert.False(t, access.Allowed(netip.MustParseAddr("10.0.5.7")), "deny takes precedence")
+	assert.False(t, access.Allowed(netip.MustParseAddr("172.16.0.1")))
+
+	// Trusted networks are implicitly allowed
+	assert.True(t, access.Allowed(netip.MustParseAddr("192.168.1.10")))
+	assert.False(t, access.Allowed(netip.MustParseAddr("192.168.1.11")))
+}
+
+func TestAccessList_EmptyAllowAdmitsAll(t *testing.T) {
+	access, err := NewAccessList(nil, []string{"203.0.113.0/24"}, nil)
+	assert.NoError(t, err)
+
+	assert.True(t, access.Allowed(netip.MustParseAddr("198.51.100.1")))
+	assert.False(t, access.Allowed(netip.MustParseAddr("203.0.113.9")))
+}
+
+func TestAccessList_Trusted(t *testing.T) {
+	access, err := NewAccessList(nil, []string{"127.0.0.2"}, []string{"127.0.0.0/8", "::1"})
+	assert.NoError(t, err)
+
+	assert.True(t, access.Trusted(netip.MustParseAddr("127.0.0.1")))
+	assert.True(t, access.Trusted(netip.MustParseAddr("::1")))
+	assert.False(t, access.Trusted(netip.MustParseAddr("127.0.0.2")))
+	assert.False(t, access.Trusted(netip.MustParseAddr("10.0.0.1")))
+}
+
+func TestNewAccessList_Invalid(t *testing.T) {
+	_, err := NewAccessList([]string{"10.0.0.0/33"}, nil, nil)
+	assert.Error(t, err)
+
+	_, err = NewAccessList(nil, []string{"not-an-ip"}, nil)
+	assert.Error(t, err)
+}
+
+func TestRemoteAddr(t *testing.T) {
+	ip, ok := remoteAddr(&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 2525})
+	assert.True(t, ok)
+	assert.Equal(t, netip.MustParseAddr("192.0.2.1"), ip)
+
+	ip, ok = remoteAddr(&net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 2525})
+	assert.True(t, ok)
+	assert.Equal(t, netip.MustParseAddr("2001:db8::1"), ip)
+
+	_, ok = remoteAddr(&net.UnixAddr{Name: "/tmp/smtp.sock", Net: "unix"})
+	assert.False(t, ok)
+}
@@ -1,49 +1,144 @@
 package smtp
 
 import (
+	"bufio"
 	"encoding/base64"
 	"errors"
+	"fmt"
+	"os"
 	"strings"
+	"sync"
 
+	"github.com/emersion/go-sasl"
 	"github.com/emersion/go-smtp"
+	"github.com/itsLeonB/smtproxy/internal/core/password"
 )
 
+// dummyHash is verified for unknown users so that lookups take as long as real checks
+const dummyHash = "$2a$10$ISv7e6G89czuP0Bvx.45UO/bNor8UbADGlKihKxVgEV3dmyKltLrC"
+
 // AuthHandler handles SMTP authentication
 type AuthHandler struct {
+	mu    sync.RWMutex
 	users map[string]string
 }
 
-// NewAuthHandler creates a new authentication handler
+// NewAuthHandler creates a new authentication handler. Passwords may be
+// plaintext or bcrypt, argon2id or SHA-512-crypt hashes.
 func NewAuthHandler(users map[string]string) *AuthHandler {
 	return &AuthHandler{
 		users: users,
 	}
 }
 
+// Reload atomically replaces the set of known users
+func (a *AuthHandler) Reload(users map[string]string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.users = users
+}
+
 // AuthPlain handles AUTH PLAIN mechanism
-func (a *AuthHandler) AuthPlain(conn *smtp.Conn, username, password string) error {
-	if expectedPassword, exists := a.users[username]; exists && expectedPassword == password {
-		return nil
+func (a *AuthHandler) AuthPlain(conn *smtp.Conn, username, secret string) error {
+	a.mu.RLock()
+	encoded, exists := a.users[username]
+	a.mu.RUnlock()
+
+	if !exists {
+		password.Verify(dummyHash, secret)
+		return errors.New("invalid credentials")
+	}
+	if !password.Verify(encoded, secret) {
+		return errors.New("invalid credentials")
 	}
-	return errors.New("invalid credentials")
+	return nil
 }
 
 // AuthLogin handles AUTH LOGIN mechanism
-func (a *AuthHandler) AuthLogin(conn *smtp.Conn, username, password string) error {
-	return a.AuthPlain(conn, username, password)
+func (a *AuthHandler) AuthLogin(conn *smtp.Conn, username, secret string) error {
+	return a.AuthPlain(conn, username, secret)
 }
 
+// LoadCredentialsFile reads htpasswd-style "user:hash" lines, ignoring blanks and # comments
+func LoadCredentialsFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		username, hash, found := strings.Cut(line, ":")
+		if !found || username == "" || hash == "" {
+			return nil, fmt.Errorf("%s:%d: expected user:hash", path, lineNo)
+		}
+		if !password.IsHashed(hash) {
+			return nil, fmt.Errorf("%s:%d: password for %q is not a supported hash", path, lineNo, username)
+		}
+		users[username] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// loginServer implements the server side of the SASL LOGIN mechanism,
+// which go-sasl only provides as a client
+type loginServer struct {
+	step         int
+	username     string
+	authenticate func(username, password string) error
+}
+
+// Next handles one client response in the LOGIN exchange
+func (l *loginServer) Next(response []byte) (challenge []byte, done bool, err error) {
+	switch l.step {
+	case 0:
+		l.step++
+		if len(response) == 0 {
+			return []byte("Username:"), false, nil
+		}
+		// Initial response carries the username
+		fallthrough
+	case 1:
+		l.username = string(response)
+		l.step = 2
+		return []byte("Password:"), false, nil
+	case 2:
+		l.step++
+		return nil, true, l.authenticate(l.username, string(response))
+	default:
+		return nil, true, errors.New("unexpected LOGIN response")
+	}
+}
+
+var _ sasl.Server = (*loginServer)(nil)
+
 // ParseAuthPlain parses AUTH PLAIN credentials from base64 encoded string
 func ParseAuthPlain(encoded string) (username, password string, err error) {
 	decoded, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
 		return "", "", err
 	}
-	
+
 	parts := strings.Split(string(decoded), "\x00")
 	if len(parts) != 3 {
 		return "", "", errors.New("invalid AUTH PLAIN format")
 	}
-	
+
 	return parts[1], parts[2], nil
 }
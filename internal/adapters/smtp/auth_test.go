@@ -1,8 +1,13 @@
 package smtp
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/itsLeonB/smtproxy/internal/core/password"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -73,3 +78,92 @@ func TestParseAuthPlain_InvalidFormat(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "invalid AUTH PLAIN format")
 }
+
+func TestAuthHandler_AuthPlain_HashedPassword(t *testing.T) {
+	hash, err := password.Hash(password.SchemeBcrypt, "testpass")
+	assert.NoError(t, err)
+	handler := NewAuthHandler(map[string]string{"testuser": hash})
+
+	assert.NoError(t, handler.AuthPlain(nil, "testuser", "testpass"))
+	assert.Error(t, handler.AuthPlain(nil, "testuser", "wrongpass"))
+	assert.Error(t, handler.AuthPlain(nil, "unknown", "testpass"))
+}
+
+func TestAuthHandler_Reload(t *testing.T) {
+	handler := NewAuthHandler(map[string]string{"old": "pass"})
+
+	handler.Reload(map[string]string{"new": "pass"})
+
+	assert.Error(t, handler.AuthPlain(nil, "old", "pass"))
+	assert.NoError(t, handler.AuthPlain(nil, "new", "pass"))
+}
+
+func TestLoadCredentialsFile(t *testing.T) {
+	hash, err := password.Hash(password.SchemeSHA512Crypt, "secret")
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "credentials")
+	content := "# app users\n\nalice:" + hash + "\n"
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	users, err := LoadCredentialsFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"alice": hash}, users)
+}
+
+func TestLoadCredentialsFile_RejectsPlaintext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	assert.NoError(t, os.WriteFile(path, []byte("alice:secret\n"), 0o600))
+
+	_, err := LoadCredentialsFile(path)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not a supported hash")
+}
+
+func TestLoadCredentialsFile_MalformedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	assert.NoError(t, os.WriteFile(path, []byte("alice\n"), 0o600))
+
+	_, err := LoadCredentialsFile(path)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), ":1: expected user:hash")
+}
+
+func TestLoginServer(t *testing.T) {
+	var gotUser, gotPass string
+	server := &loginServer{authenticate: func(username, password string) error {
+		gotUser, gotPass = username, password
+		return nil
+	}}
+
+	challenge, done, err := server.Next(nil)
+	assert.NoError(t, err)
+	assert.False(t, done)
+	assert.Equal(t, "Username:", string(challenge))
+
+	challenge, done, err = server.Next([]byte("testuser"))
+	assert.NoError(t, err)
+	assert.False(t, done)
+	assert.Equal(t, "Password:", string(challenge))
+
+	_, done, err = server.Next([]byte("testpass"))
+	assert.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, "testuser", gotUser)
+	assert.Equal(t, "testpass", gotPass)
+}
+
+func TestLoginServer_InitialResponse(t *testing.T) {
+	server := &loginServer{authenticate: func(username, password string) error {
+		return errors.New("invalid credentials")
+	}}
+
+	challenge, done, err := server.Next([]byte("testuser"))
+	assert.NoError(t, err)
+	assert.False(t, done)
+	assert.Equal(t, "Password:", string(challenge))
+
+	_, done, err = server.Next([]byte("wrong"))
+	assert.Error(t, err)
+	assert.True(t, done)
+}
@@ -1,20 +1,73 @@
 package smtp
 
 import (
+	"context"
+	"sync/atomic"
+	"time"
+
 	"github.com/emersion/go-smtp"
+	"github.com/itsLeonB/smtproxy/internal/core/logger"
+	"github.com/itsLeonB/smtproxy/internal/core/metrics"
+	"github.com/itsLeonB/smtproxy/internal/core/requestctx"
+	"github.com/itsLeonB/smtproxy/internal/core/tracing"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/audit"
 	"github.com/itsLeonB/smtproxy/internal/domain/service/dispatcher"
 	"github.com/itsLeonB/smtproxy/internal/domain/service/parser"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/policy"
 	"github.com/itsLeonB/smtproxy/internal/domain/service/provider"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/queue"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/routing"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/suppression"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Backend implements smtp.Backend interface
 type Backend struct {
 	maxMessageSize int64
-	authHandler    *AuthHandler
 	authEnabled    bool
 	dispatcher     *dispatcher.Dispatcher
+	queue          *queue.Queue
+	audit          *audit.Trail
+	suppressions   *suppression.List
+	access         *AccessList
+	limiter        *RateLimiter
+	transactions   *transactions
+
+	// authHandler, policies and router are swapped on configuration reloads
+	// and apply to sessions created afterwards
+	authHandler atomic.Pointer[AuthHandler]
+	policies    atomic.Pointer[policy.Manager]
+	router      atomic.Pointer[routing.Router]
+
+	// dispatchTimeout bounds each synchronous dispatch; zero means no limit
+	dispatchTimeout time.Duration
+
+	// ctx is the parent of every session context and is cancelled when
+	// shutdown gives up on draining
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
+var (
+	// errClientDenied is returned to clients outside the configured networks
+	errClientDenied = &smtp.SMTPError{
+		Code:         554,
+		EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+		Message:      "Client host rejected: access denied",
+	}
+	errTooManyConnections = &smtp.SMTPError{
+		Code:         421,
+		EnhancedCode: smtp.EnhancedCode{4, 7, 0},
+		Message:      "Too many connections, try again later",
+	}
+	errAuthLocked = &smtp.SMTPError{
+		Code:         421,
+		EnhancedCode: smtp.EnhancedCode{4, 7, 0},
+		Message:      "Too many authentication failures, try again later",
+	}
+)
+
 // NewBackend creates a new SMTP backend
 func NewBackend(maxMessageSize int64, authHandler *AuthHandler, authEnabled bool, registry *provider.Registry) *Backend {
 	var disp *dispatcher.Dispatcher
@@ -22,34 +75,143 @@ func NewBackend(maxMessageSize int64, authHandler *AuthHandler, authEnabled bool
 		disp = dispatcher.NewDispatcher(registry)
 	}
 
-	return &Backend{
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Backend{
 		maxMessageSize: maxMessageSize,
-		authHandler:    authHandler,
 		authEnabled:    authEnabled,
 		dispatcher:     disp,
+		transactions:   newTransactions(),
+		ctx:            ctx,
+		cancel:         cancel,
 	}
+	b.authHandler.Store(authHandler)
+	return b
+}
+
+// SetDispatchTimeout bounds how long a synchronous dispatch may take
+func (b *Backend) SetDispatchTimeout(timeout time.Duration) {
+	b.dispatchTimeout = timeout
+}
+
+// SetQueue switches the backend to asynchronous delivery through q
+func (b *Backend) SetQueue(q *queue.Queue) {
+	b.queue = q
+}
+
+// SetPolicies enforces per-user sending policies in new sessions
+func (b *Backend) SetPolicies(policies *policy.Manager) {
+	b.policies.Store(policies)
+}
+
+// SetRouter chooses providers for messages that no policy binds to one
+func (b *Backend) SetRouter(router *routing.Router) {
+	b.router.Store(router)
+}
+
+// SetAuthHandler replaces the users that new sessions authenticate against
+func (b *Backend) SetAuthHandler(handler *AuthHandler) {
+	b.authHandler.Store(handler)
+}
+
+// SetAudit records accepted messages and their delivery history in trail
+func (b *Backend) SetAudit(trail *audit.Trail) {
+	b.audit = trail
+	if b.dispatcher != nil {
+		b.dispatcher.SetAudit(trail)
+	}
+}
+
+// SetSuppressions checks recipients against list
+func (b *Backend) SetSuppressions(list *suppression.List) {
+	b.suppressions = list
+}
+
+// SetAccessList restricts which clients may connect and which may relay without AUTH
+func (b *Backend) SetAccessList(access *AccessList) {
+	b.access = access
+}
+
+// SetRateLimiter limits concurrent sessions, message rates and AUTH failures
+func (b *Backend) SetRateLimiter(limiter *RateLimiter) {
+	b.limiter = limiter
 }
 
 // NewSession creates a new SMTP session
 func (b *Backend) NewSession(c *smtp.Conn) (smtp.Session, error) {
+	if b.transactions.isDraining() {
+		return nil, errShuttingDown
+	}
+
+	session := b.newSession()
+	if c == nil {
+		return session, nil
+	}
+
+	session.conn = c.Conn()
+	addr := session.conn.RemoteAddr()
+	ip, ok := remoteAddr(addr)
+	session.remoteIP = ip
+	if ok {
+		session.ctx = requestctx.WithRemoteIP(session.ctx, ip.String())
+	}
+	session.ctx, session.span = tracing.Start(session.ctx, "smtp.session",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.String("smtp.session_id", session.id), attribute.String("client.address", addr.String())))
+
+	if b.access != nil {
+		if !ok || !b.access.Allowed(ip) {
+			logger.WarnContext(session.ctx, "rejected connection", "reason", "access_denied", "addr", addr.String())
+			metrics.ConnectionsRejected.WithLabelValues("access_denied").Inc()
+			return nil, session.reject(errClientDenied)
+		}
+		session.trusted = b.access.Trusted(ip)
+	}
+
+	if b.limiter != nil {
+		release, reason := b.limiter.Acquire(ip)
+		if release == nil {
+			logger.WarnContext(session.ctx, "rejected connection", "reason", reason, "addr", addr.String())
+			metrics.ConnectionsRejected.WithLabelValues(reason).Inc()
+			if reason == reasonAuthLockout {
+				return nil, session.reject(errAuthLocked)
+			}
+			return nil, session.reject(errTooManyConnections)
+		}
+		session.release = release
+	}
+
+	return session, nil
+}
+
+// newSession creates a session with the backend's settings and its own
+// context, which is cancelled when the session ends
+func (b *Backend) newSession() *Session {
+	id := requestctx.NewID()
+	ctx, cancel := context.WithCancel(requestctx.WithSessionID(b.ctx, id))
+
 	return &Session{
-		maxMessageSize: b.maxMessageSize,
-		authHandler:    b.authHandler,
-		authEnabled:    b.authEnabled,
-		parser:         parser.New(b.maxMessageSize),
-		dispatcher:     b.dispatcher,
-	}, nil
+		id:              id,
+		ctx:             ctx,
+		cancel:          cancel,
+		dispatchTimeout: b.dispatchTimeout,
+		maxMessageSize:  b.maxMessageSize,
+		authHandler:     b.authHandler.Load(),
+		authEnabled:     b.authEnabled,
+		parser:          parser.New(b.maxMessageSize),
+		dispatcher:      b.dispatcher,
+		queue:           b.queue,
+		policies:        b.policies.Load(),
+		router:          b.router.Load(),
+		audit:           b.audit,
+		suppressions:    b.suppressions,
+		limiter:         b.limiter,
+		transactions:    b.transactions,
+	}
 }
 
 // AuthPlain implements SMTP AUTH PLAIN for the backend
 func (b *Backend) AuthPlain(conn *smtp.Conn, username, password string) (smtp.Session, error) {
-	session := &Session{
-		maxMessageSize: b.maxMessageSize,
-		authHandler:    b.authHandler,
-		authEnabled:    b.authEnabled,
-		parser:         parser.New(b.maxMessageSize),
-		dispatcher:     b.dispatcher,
-	}
+	session := b.newSession()
 
 	if err := session.AuthPlain(username, password); err != nil {
 		return nil, err
@@ -60,13 +222,7 @@ func (b *Backend) AuthPlain(conn *smtp.Conn, username, password string) (smtp.Se
 
 // AuthLogin implements SMTP AUTH LOGIN for the backend
 func (b *Backend) AuthLogin(conn *smtp.Conn, username, password string) (smtp.Session, error) {
-	session := &Session{
-		maxMessageSize: b.maxMessageSize,
-		authHandler:    b.authHandler,
-		authEnabled:    b.authEnabled,
-		parser:         parser.New(b.maxMessageSize),
-		dispatcher:     b.dispatcher,
-	}
+	session := b.newSession()
 
 	if err := session.AuthLogin(username, password); err != nil {
 		return nil, err
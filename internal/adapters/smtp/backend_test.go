@@ -1,8 +1,12 @@
 package smtp
 
 import (
+	"net"
+	netsmtp "net/smtp"
 	"testing"
+	"time"
 
+	"github.com/emersion/go-smtp"
 	"github.com/itsLeonB/smtproxy/internal/domain/service/provider"
 	"github.com/stretchr/testify/assert"
 )
@@ -17,7 +21,7 @@ func TestNewBackend(t *testing.T) {
 
 	assert.NotNil(t, backend)
 	assert.Equal(t, maxSize, backend.maxMessageSize)
-	assert.Equal(t, authHandler, backend.authHandler)
+	assert.Equal(t, authHandler, backend.authHandler.Load())
 	assert.True(t, backend.authEnabled)
 	assert.NotNil(t, backend.dispatcher)
 }
@@ -30,3 +34,125 @@ func TestBackend_NewSession(t *testing.T) {
 	assert.NotNil(t, session)
 	assert.IsType(t, &Session{}, session)
 }
+
+// serveBackend runs backend on a loopback listener and returns its address
+func serveBackend(t *testing.T, backend *Backend) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	server := smtp.NewServer(backend)
+	server.Domain = "localhost"
+	server.AllowInsecureAuth = true
+	go func() {
+		_ = server.Serve(ln)
+	}()
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+
+	return ln.Addr().String()
+}
+
+func TestBackend_NewSession_DeniedClient(t *testing.T) {
+	backend := NewBackend(1024, NewAuthHandler(map[string]string{}), true, nil)
+	access, err := NewAccessList(nil, []string{"127.0.0.0/8"}, nil)
+	assert.NoError(t, err)
+	backend.SetAccessList(access)
+
+	client, err := netsmtp.Dial(serveBackend(t, backend))
+	assert.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+
+	err = client.Hello("client.example.com")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "554")
+}
+
+func TestBackend_NewSession_TrustedNetworkRelaysWithoutAuth(t *testing.T) {
+	registry := provider.NewRegistry()
+	_ = registry.Register(provider.NewMockProvider("mock"))
+
+	backend := NewBackend(1024, NewAuthHandler(map[string]string{}), true, registry)
+	access, err := NewAccessList(nil, nil, []string{"127.0.0.0/8"})
+	assert.NoError(t, err)
+	backend.SetAccessList(access)
+
+	err = netsmtp.SendMail(serveBackend(t, backend), nil, "app@example.com", []string{"user@example.com"}, []byte("Subject: Test\r\n\r\nHello\r\n"))
+	assert.NoError(t, err)
+}
+
+func TestBackend_NewSession_UntrustedClientNeedsAuth(t *testing.T) {
+	registry := provider.NewRegistry()
+	_ = registry.Register(provider.NewMockProvider("mock"))
+
+	backend := NewBackend(1024, NewAuthHandler(map[string]string{}), true, registry)
+	access, err := NewAccessList(nil, nil, []string{"10.0.0.0/8"})
+	assert.NoError(t, err)
+	backend.SetAccessList(access)
+
+	err = netsmtp.SendMail(serveBackend(t, backend), nil, "app@example.com", []string{"user@example.com"}, []byte("Subject: Test\r\n\r\nHello\r\n"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "authentication required")
+}
+
+func TestBackend_NewSession_MaxConnections(t *testing.T) {
+	backend := NewBackend(1024, nil, false, nil)
+	backend.SetRateLimiter(NewRateLimiter(Limits{MaxConnections: 1}))
+	addr := serveBackend(t, backend)
+
+	first, err := netsmtp.Dial(addr)
+	assert.NoError(t, err)
+	assert.NoError(t, first.Hello("client.example.com"))
+
+	second, err := netsmtp.Dial(addr)
+	assert.NoError(t, err)
+	err = second.Hello("client.example.com")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "421")
+	_ = second.Close()
+
+	// The slot is released when the first session ends
+	assert.NoError(t, first.Quit())
+	assert.Eventually(t, func() bool {
+		third, err := netsmtp.Dial(addr)
+		if err != nil {
+			return false
+		}
+		defer func() {
+			_ = third.Close()
+		}()
+		return third.Hello("client.example.com") == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestBackend_AuthLockout(t *testing.T) {
+	backend := NewBackend(1024, NewAuthHandler(map[string]string{"user": "pass"}), true, nil)
+	backend.SetRateLimiter(NewRateLimiter(Limits{AuthMaxFailures: 2, AuthLockout: time.Minute}))
+	addr := serveBackend(t, backend)
+
+	// net/smtp hangs up after a failed AUTH, so each attempt uses a new connection
+	for range 2 {
+		client, err := netsmtp.Dial(addr)
+		assert.NoError(t, err)
+		assert.NoError(t, client.Hello("client.example.com"))
+
+		err = client.Auth(netsmtp.PlainAuth("", "user", "wrong", "127.0.0.1"))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "535")
+		_ = client.Close()
+	}
+
+	// The banned address cannot open another session
+	client, err := netsmtp.Dial(addr)
+	assert.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+	err = client.Hello("client.example.com")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "421")
+}
@@ -0,0 +1,133 @@
+package smtp
+
+import (
+	"maps"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/core/logger"
+)
+
+// CredentialsWatcher reloads an AuthHandler when its credentials file changes
+type CredentialsWatcher struct {
+	path     string
+	interval time.Duration
+	handler  *AuthHandler
+	base     map[string]string
+
+	// mu serializes reloads from the poller and from the admin API
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewCredentialsWatcher creates a watcher that merges the file's users over base
+func NewCredentialsWatcher(path string, interval time.Duration, handler *AuthHandler, base map[string]string) *CredentialsWatcher {
+	return &CredentialsWatcher{
+		path:     path,
+		interval: interval,
+		handler:  handler,
+		base:     base,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Load reads the credentials file and applies it to the handler
+func (w *CredentialsWatcher) Load() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.load()
+}
+
+// load reads and applies the credentials file. Callers must hold w.mu.
+func (w *CredentialsWatcher) load() error {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return err
+	}
+
+	users, err := w.Users(w.base)
+	if err != nil {
+		return err
+	}
+	w.handler.Reload(users)
+
+	w.modTime = info.ModTime()
+	w.size = info.Size()
+	return nil
+}
+
+// Users reads the credentials file and merges its users over base
+func (w *CredentialsWatcher) Users(base map[string]string) (map[string]string, error) {
+	fileUsers, err := LoadCredentialsFile(w.path)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make(map[string]string, len(base)+len(fileUsers))
+	maps.Copy(users, base)
+	maps.Copy(users, fileUsers)
+	return users, nil
+}
+
+// Rebind makes later changes to the file apply to handler, merged over base
+func (w *CredentialsWatcher) Rebind(handler *AuthHandler, base map[string]string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.handler = handler
+	w.base = base
+}
+
+// Start polls the file for changes until Stop is called
+func (w *CredentialsWatcher) Start() {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				w.check()
+			}
+		}
+	}()
+}
+
+// Stop ends polling
+func (w *CredentialsWatcher) Stop() {
+	close(w.stop)
+	w.wg.Wait()
+}
+
+// check reloads the file if its modification time or size changed.
+// A file that fails to parse keeps the previously loaded users.
+func (w *CredentialsWatcher) check() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	info, err := os.Stat(w.path)
+	if err != nil {
+		logger.Errorf("failed to stat credentials file %s: %v", w.path, err)
+		return
+	}
+	if info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		return
+	}
+
+	if err := w.load(); err != nil {
+		logger.Errorf("failed to reload credentials file, keeping previous users: %v", err)
+		return
+	}
+	logger.Infof("reloaded credentials file %s", w.path)
+}
@@ -0,0 +1,63 @@
+package smtp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/core/password"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeCredentials(t *testing.T, path, user, secret string) {
+	t.Helper()
+	hash, err := password.Hash(password.SchemeSHA512Crypt, secret)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, []byte(user+":"+hash+"\n"), 0o600))
+}
+
+func TestCredentialsWatcher_LoadMergesBaseUsers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	writeCredentials(t, path, "alice", "secret")
+
+	handler := NewAuthHandler(nil)
+	watcher := NewCredentialsWatcher(path, time.Hour, handler, map[string]string{"env": "pass"})
+
+	assert.NoError(t, watcher.Load())
+	assert.NoError(t, handler.AuthPlain(nil, "alice", "secret"))
+	assert.NoError(t, handler.AuthPlain(nil, "env", "pass"))
+}
+
+func TestCredentialsWatcher_ReloadsOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	writeCredentials(t, path, "alice", "secret")
+
+	handler := NewAuthHandler(nil)
+	watcher := NewCredentialsWatcher(path, 10*time.Millisecond, handler, nil)
+	assert.NoError(t, watcher.Load())
+
+	watcher.Start()
+	defer watcher.Stop()
+
+	writeCredentials(t, path, "bob", "other-secret")
+
+	assert.Eventually(t, func() bool {
+		return handler.AuthPlain(nil, "bob", "other-secret") == nil
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Error(t, handler.AuthPlain(nil, "alice", "secret"))
+}
+
+func TestCredentialsWatcher_KeepsUsersOnInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	writeCredentials(t, path, "alice", "secret")
+
+	handler := NewAuthHandler(nil)
+	watcher := NewCredentialsWatcher(path, time.Hour, handler, nil)
+	assert.NoError(t, watcher.Load())
+
+	assert.NoError(t, os.WriteFile(path, []byte("broken line\n"), 0o600))
+	watcher.check()
+
+	assert.NoError(t, handler.AuthPlain(nil, "alice", "secret"))
+}
@@ -0,0 +1,69 @@
+//go:build unix
+
+package smtp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// watchDisconnect calls cancel if the client closes conn before the returned
+// stop function is called. go-smtp doesn't read from the connection while
+// Data runs, so the socket is peeked instead: a read of zero bytes means the
+// client has gone, while pending data, such as a pipelined QUIT, is left for
+// go-smtp and ends the watch.
+func watchDisconnect(conn net.Conn, cancel context.CancelFunc) (stop func()) {
+	conn = rawConn(conn)
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return func() {}
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		closed := false
+		buf := make([]byte, 1)
+		err := rc.Read(func(fd uintptr) bool {
+			n, _, err := syscall.Recvfrom(int(fd), buf, syscall.MSG_PEEK)
+			if errors.Is(err, syscall.EAGAIN) {
+				return false
+			}
+			closed = n == 0 || err != nil
+			return true
+		})
+		// An expired deadline is how stop ends the watch
+		if closed || (err != nil && !errors.Is(err, os.ErrDeadlineExceeded)) {
+			cancel()
+		}
+	}()
+
+	return func() {
+		_ = conn.SetReadDeadline(time.Now())
+		<-done
+		_ = conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// rawConn returns the connection underneath TLS and PROXY protocol wrappers
+func rawConn(conn net.Conn) net.Conn {
+	for {
+		switch c := conn.(type) {
+		case *tls.Conn:
+			conn = c.NetConn()
+		case interface{ Raw() net.Conn }:
+			conn = c.Raw()
+		default:
+			return conn
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package smtp
+
+import (
+	"context"
+	"net"
+)
+
+// watchDisconnect does nothing on platforms where the socket can't be
+// peeked; DISPATCH_TIMEOUT alone bounds the dispatch there
+func watchDisconnect(conn net.Conn, cancel context.CancelFunc) (stop func()) {
+	return func() {}
+}
@@ -0,0 +1,114 @@
+//go:build unix
+
+package smtp
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/domain/service/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+// tcpPair returns both ends of a loopback TCP connection
+func tcpPair(t *testing.T) (server, client net.Conn) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	client, err = net.Dial("tcp", listener.Addr().String())
+	assert.NoError(t, err)
+	server, err = listener.Accept()
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		_ = server.Close()
+		_ = client.Close()
+	})
+	return server, client
+}
+
+func TestWatchDisconnect_CancelsWhenClientCloses(t *testing.T) {
+	server, client := tcpPair(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := watchDisconnect(server, cancel)
+	defer stop()
+
+	assert.NoError(t, client.Close())
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("client disconnect did not cancel the context")
+	}
+}
+
+func TestWatchDisconnect_StopLeavesConnection(t *testing.T) {
+	server, client := tcpPair(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := watchDisconnect(server, cancel)
+
+	// Pipelined data ends the watch without being consumed
+	_, err := client.Write([]byte("QUIT\r\n"))
+	assert.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	stop()
+	assert.NoError(t, ctx.Err())
+
+	buf := make([]byte, 6)
+	_, err = server.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "QUIT\r\n", string(buf))
+
+	// Stopping an idle watch doesn't cancel or leave a deadline behind
+	stop = watchDisconnect(server, cancel)
+	stop()
+	assert.NoError(t, ctx.Err())
+	_, err = client.Write([]byte("NOOP\r\n"))
+	assert.NoError(t, err)
+	_, err = server.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "NOOP\r\n", string(buf))
+}
+
+func TestServer_DisconnectCancelsDispatch(t *testing.T) {
+	recorder := &contextProvider{contexts: make(chan context.Context, 1), block: true}
+	registry := provider.NewRegistry()
+	assert.NoError(t, registry.Register(recorder))
+	server := NewServer("0", 1024, nil, false, false, registry)
+	assert.NoError(t, server.Start())
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}()
+
+	conn, err := textproto.Dial("tcp", server.listener.Addr().String())
+	assert.NoError(t, err)
+	_, _, err = conn.ReadResponse(220)
+	assert.NoError(t, err)
+	for _, cmd := range []string{"EHLO client.example.com", "MAIL FROM:<app@example.com>", "RCPT TO:<user@example.com>", "DATA"} {
+		_, err = conn.Cmd("%s", cmd)
+		assert.NoError(t, err)
+		_, _, err = conn.ReadResponse(0)
+		assert.NoError(t, err, cmd)
+	}
+	_, err = conn.Cmd("Subject: Test\r\n\r\nHello\r\n.")
+	assert.NoError(t, err)
+	ctx := <-recorder.contexts
+
+	// The client gives up waiting for the reply, so the provider call is cancelled
+	assert.NoError(t, conn.Close())
+	select {
+	case <-ctx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("client disconnect did not cancel the dispatch")
+	}
+}
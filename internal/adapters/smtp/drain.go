@@ -0,0 +1,92 @@
+package smtp
+
+import (
+	"context"
+	"net/netip"
+	"sync"
+
+	"github.com/emersion/go-smtp"
+)
+
+// errShuttingDown is returned for new sessions and transactions while draining
+var errShuttingDown = &smtp.SMTPError{
+	Code:         421,
+	EnhancedCode: smtp.EnhancedCode{4, 3, 2},
+	Message:      "Service shutting down, try again later",
+}
+
+// transactions tracks mail transactions in progress so that shutdown can
+// wait for them to finish
+type transactions struct {
+	mu       sync.Mutex
+	draining bool
+	active   map[*Session]netip.Addr
+	idle     chan struct{}
+}
+
+func newTransactions() *transactions {
+	return &transactions{active: make(map[*Session]netip.Addr)}
+}
+
+// begin records a transaction started by s. It returns false while draining.
+func (t *transactions) begin(s *Session) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.draining {
+		return false
+	}
+	t.active[s] = s.remoteIP
+	return true
+}
+
+// end records that the transaction of s completed or was abandoned
+func (t *transactions) end(s *Session) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.active, s)
+	if t.draining && len(t.active) == 0 && t.idle != nil {
+		close(t.idle)
+		t.idle = nil
+	}
+}
+
+// isDraining reports whether new transactions are refused
+func (t *transactions) isDraining() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.draining
+}
+
+// drain refuses new transactions and waits until those in progress finish or
+// ctx is done. It returns the client addresses of transactions still active.
+func (t *transactions) drain(ctx context.Context) []netip.Addr {
+	t.mu.Lock()
+	t.draining = true
+	if len(t.active) == 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	if t.idle == nil {
+		t.idle = make(chan struct{})
+	}
+	idle := t.idle
+	t.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	remaining := make([]netip.Addr, 0, len(t.active))
+	for _, addr := range t.active {
+		remaining = append(remaining, addr)
+	}
+	return remaining
+}
@@ -0,0 +1,46 @@
+package smtp
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransactions_DrainWaitsForActive(t *testing.T) {
+	tracker := newTransactions()
+	session := &Session{remoteIP: netip.MustParseAddr("192.0.2.1")}
+	assert.True(t, tracker.begin(session))
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		tracker.end(session)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	assert.Empty(t, tracker.drain(ctx))
+
+	assert.False(t, tracker.begin(&Session{}), "new transactions are refused while draining")
+}
+
+func TestTransactions_DrainDeadline(t *testing.T) {
+	tracker := newTransactions()
+	assert.True(t, tracker.begin(&Session{remoteIP: netip.MustParseAddr("192.0.2.1")}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, []netip.Addr{netip.MustParseAddr("192.0.2.1")}, tracker.drain(ctx))
+}
+
+func TestTransactions_EndIsIdempotent(t *testing.T) {
+	tracker := newTransactions()
+	session := &Session{}
+	assert.True(t, tracker.begin(session))
+
+	tracker.end(session)
+	tracker.end(session)
+	assert.Empty(t, tracker.drain(context.Background()))
+}
@@ -0,0 +1,24 @@
+package smtp
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// proxyListener wraps ln so that connections from trusted upstreams must open
+// with a PROXY protocol v1 or v2 header, whose source address then becomes the
+// connection's remote address. Other peers are served as plain connections and
+// cannot spoof their address.
+func proxyListener(ln net.Listener, trusted []netip.Prefix) net.Listener {
+	return &proxyproto.Listener{
+		Listener: ln,
+		ConnPolicy: func(opts proxyproto.ConnPolicyOptions) (proxyproto.Policy, error) {
+			if ip, ok := remoteAddr(opts.Upstream); ok && containsAddr(trusted, ip) {
+				return proxyproto.REQUIRE, nil
+			}
+			return proxyproto.SKIP, nil
+		},
+	}
+}
@@ -0,0 +1,137 @@
+package smtp
+
+import (
+	"bufio"
+	"net"
+	"net/netip"
+	"net/textproto"
+	"testing"
+
+	"github.com/emersion/go-smtp"
+	"github.com/pires/go-proxyproto"
+	"github.com/stretchr/testify/assert"
+)
+
+// serveProxied runs backend behind a PROXY protocol listener trusting upstreams
+func serveProxied(t *testing.T, backend *Backend, upstreams ...string) string {
+	t.Helper()
+
+	trusted, err := parsePrefixes(upstreams)
+	assert.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	server := smtp.NewServer(backend)
+	server.Domain = "localhost"
+	go func() {
+		_ = server.Serve(proxyListener(ln, trusted))
+	}()
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+
+	return ln.Addr().String()
+}
+
+// ehlo sends header, reads the greeting and returns the EHLO reply code
+func ehlo(t *testing.T, addr string, header []byte) int {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	assert.NoError(t, err)
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if header != nil {
+		_, err = conn.Write(header)
+		assert.NoError(t, err)
+	}
+
+	text := textproto.NewConn(conn)
+	_, _, err = text.ReadResponse(220)
+	assert.NoError(t, err)
+
+	assert.NoError(t, text.PrintfLine("EHLO client.example.com"))
+	code, _, _ := text.ReadResponse(250)
+	return code
+}
+
+func deniedBackend(t *testing.T, deny string) *Backend {
+	backend := NewBackend(1024, nil, false, nil)
+	access, err := NewAccessList(nil, []string{deny}, nil)
+	assert.NoError(t, err)
+	backend.SetAccessList(access)
+	return backend
+}
+
+func TestProxyListener_V1(t *testing.T) {
+	addr := serveProxied(t, deniedBackend(t, "203.0.113.7"), "127.0.0.0/8")
+
+	// The client address from the header is subject to the access list
+	assert.Equal(t, 554, ehlo(t, addr, []byte("PROXY TCP4 203.0.113.7 10.0.0.1 40000 25\r\n")))
+	assert.Equal(t, 250, ehlo(t, addr, []byte("PROXY TCP4 198.51.100.1 10.0.0.1 40000 25\r\n")))
+}
+
+func TestProxyListener_V2(t *testing.T) {
+	addr := serveProxied(t, deniedBackend(t, "2001:db8::7"), "127.0.0.1")
+
+	header := proxyproto.HeaderProxyFromAddrs(2,
+		net.TCPAddrFromAddrPort(netip.MustParseAddrPort("[2001:db8::7]:40000")),
+		net.TCPAddrFromAddrPort(netip.MustParseAddrPort("[2001:db8::1]:25")),
+	)
+	raw, err := header.Format()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 554, ehlo(t, addr, raw))
+}
+
+func TestProxyListener_TrustedUpstreamRequiresHeader(t *testing.T) {
+	addr := serveProxied(t, NewBackend(1024, nil, false, nil), "127.0.0.0/8")
+
+	conn, err := net.Dial("tcp", addr)
+	assert.NoError(t, err)
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	// Without a header the server hangs up instead of greeting
+	_, err = conn.Write([]byte("EHLO client.example.com\r\n"))
+	assert.NoError(t, err)
+	_, err = bufio.NewReader(conn).ReadString('\n')
+	assert.Error(t, err)
+}
+
+func TestProxyListener_UntrustedUpstreamCannotSpoof(t *testing.T) {
+	// Only 10.0.0.0/8 is trusted, so a header from loopback is not interpreted
+	addr := serveProxied(t, deniedBackend(t, "127.0.0.1"), "10.0.0.0/8")
+
+	conn, err := net.Dial("tcp", addr)
+	assert.NoError(t, err)
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	text := textproto.NewConn(conn)
+	_, _, err = text.ReadResponse(220)
+	assert.NoError(t, err)
+
+	// The header is just an unknown command, and the real address is still denied
+	assert.NoError(t, text.PrintfLine("PROXY TCP4 198.51.100.1 10.0.0.1 40000 25"))
+	code, _, _ := text.ReadResponse(250)
+	assert.GreaterOrEqual(t, code, 500)
+
+	assert.NoError(t, text.PrintfLine("EHLO client.example.com"))
+	code, _, _ = text.ReadResponse(250)
+	assert.Equal(t, 554, code)
+}
+
+func TestServer_EnableProxyProtocol(t *testing.T) {
+	server := NewServer("0", 1024, nil, false, false, nil)
+
+	assert.Error(t, server.EnableProxyProtocol(nil))
+	assert.Error(t, server.EnableProxyProtocol([]string{"not-a-network"}))
+	assert.NoError(t, server.EnableProxyProtocol([]string{"10.0.0.0/8", "192.0.2.10"}))
+	assert.Len(t, server.proxyUpstreams, 2)
+}
@@ -0,0 +1,233 @@
+package smtp
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/core/metrics"
+	"golang.org/x/time/rate"
+)
+
+// maxAuthFailureDelay caps the progressive delay after failed AUTH attempts
+const maxAuthFailureDelay = 10 * time.Second
+
+// sweepInterval is how often idle per-client state is discarded
+const sweepInterval = time.Minute
+
+// Limits configures connection, message and authentication limits. Zero disables a limit.
+type Limits struct {
+	MaxConnections        int
+	MaxConnectionsPerIP   int
+	ConnectionsPerMinute  int // per client IP
+	MessagesPerMinute     int // per client IP
+	UserMessagesPerMinute int // per authenticated user
+	AuthMaxFailures       int
+	AuthLockout           time.Duration
+	AuthFailureDelay      time.Duration
+}
+
+// Rejection reasons reported in metrics
+const (
+	reasonMaxConnections      = "max_connections"
+	reasonMaxConnectionsPerIP = "max_connections_per_ip"
+	reasonConnectionRate      = "connection_rate"
+	reasonAuthLockout         = "auth_lockout"
+)
+
+// authFailures tracks failed AUTH attempts from one client address
+type authFailures struct {
+	count       int
+	last        time.Time
+	bannedUntil time.Time
+}
+
+// RateLimiter enforces Limits using per-IP and per-user token buckets
+type RateLimiter struct {
+	limits Limits
+
+	mu          sync.Mutex
+	active      int
+	activePerIP map[netip.Addr]int
+	connections map[netip.Addr]*rate.Limiter
+	messages    map[netip.Addr]*rate.Limiter
+	users       map[string]*rate.Limiter
+	failures    map[netip.Addr]*authFailures
+	lastSweep   time.Time
+
+	now func() time.Time
+}
+
+// NewRateLimiter creates a limiter and publishes its limits as metrics
+func NewRateLimiter(limits Limits) *RateLimiter {
+	metrics.Limits.WithLabelValues("max_connections").Set(float64(limits.MaxConnections))
+	metrics.Limits.WithLabelValues("max_connections_per_ip").Set(float64(limits.MaxConnectionsPerIP))
+	metrics.Limits.WithLabelValues("connections_per_minute").Set(float64(limits.ConnectionsPerMinute))
+	metrics.Limits.WithLabelValues("messages_per_minute").Set(float64(limits.MessagesPerMinute))
+	metrics.Limits.WithLabelValues("user_messages_per_minute").Set(float64(limits.UserMessagesPerMinute))
+	metrics.Limits.WithLabelValues("auth_max_failures").Set(float64(limits.AuthMaxFailures))
+	metrics.Limits.WithLabelValues("auth_lockout_seconds").Set(limits.AuthLockout.Seconds())
+
+	return &RateLimiter{
+		limits:      limits,
+		activePerIP: make(map[netip.Addr]int),
+		connections: make(map[netip.Addr]*rate.Limiter),
+		messages:    make(map[netip.Addr]*rate.Limiter),
+		users:       make(map[string]*rate.Limiter),
+		failures:    make(map[netip.Addr]*authFailures),
+		now:         time.Now,
+	}
+}
+
+// Acquire reserves a session slot for ip. It returns a release function, or
+// the reason the session was refused.
+func (l *RateLimiter) Acquire(ip netip.Addr) (release func(), reason string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	if l.bannedLocked(ip, now) {
+		return nil, reasonAuthLockout
+	}
+	if l.limits.MaxConnections > 0 && l.active >= l.limits.MaxConnections {
+		return nil, reasonMaxConnections
+	}
+	if l.limits.MaxConnectionsPerIP > 0 && l.activePerIP[ip] >= l.limits.MaxConnectionsPerIP {
+		return nil, reasonMaxConnectionsPerIP
+	}
+	if !allow(l.connections, ip, l.limits.ConnectionsPerMinute, now) {
+		return nil, reasonConnectionRate
+	}
+
+	l.active++
+	l.activePerIP[ip]++
+	metrics.SessionsActive.Inc()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			l.active--
+			if l.activePerIP[ip]--; l.activePerIP[ip] <= 0 {
+				delete(l.activePerIP, ip)
+			}
+			metrics.SessionsActive.Dec()
+		})
+	}, ""
+}
+
+// AllowMessage reports whether ip and username may start another message
+func (l *RateLimiter) AllowMessage(ip netip.Addr, username string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if !allow(l.messages, ip, l.limits.MessagesPerMinute, now) {
+		metrics.RateLimited.WithLabelValues("ip").Inc()
+		return false
+	}
+	if username != "" && !allow(l.users, username, l.limits.UserMessagesPerMinute, now) {
+		metrics.RateLimited.WithLabelValues("user").Inc()
+		return false
+	}
+	return true
+}
+
+// Banned reports whether ip is locked out after repeated AUTH failures
+func (l *RateLimiter) Banned(ip netip.Addr) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.bannedLocked(ip, l.now())
+}
+
+// AuthFailed records a failed AUTH attempt from ip and returns how long to
+// delay the reply. The delay doubles with each consecutive failure, and the
+// address is banned once AuthMaxFailures is reached. Lockouts are per address
+// rather than per user so that nobody can lock a legitimate user out.
+func (l *RateLimiter) AuthFailed(ip netip.Addr) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	metrics.AuthFailures.Inc()
+
+	now := l.now()
+	f, exists := l.failures[ip]
+	if !exists || (l.limits.AuthLockout > 0 && now.Sub(f.last) > l.limits.AuthLockout) {
+		f = &authFailures{}
+		l.failures[ip] = f
+	}
+	f.count++
+	f.last = now
+
+	if l.limits.AuthMaxFailures > 0 && f.count >= l.limits.AuthMaxFailures && !now.Before(f.bannedUntil) {
+		f.bannedUntil = now.Add(l.limits.AuthLockout)
+		metrics.AuthLockouts.Inc()
+	}
+
+	delay := l.limits.AuthFailureDelay
+	for i := 1; i < f.count && delay < maxAuthFailureDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxAuthFailureDelay)
+}
+
+// AuthSucceeded clears the failure history of ip
+func (l *RateLimiter) AuthSucceeded(ip netip.Addr) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.failures, ip)
+}
+
+// bannedLocked reports whether ip is banned. Callers must hold l.mu.
+func (l *RateLimiter) bannedLocked(ip netip.Addr, now time.Time) bool {
+	f, exists := l.failures[ip]
+	return exists && now.Before(f.bannedUntil)
+}
+
+// sweep discards idle buckets and expired failure records so that state
+// does not grow with every address ever seen. Callers must hold l.mu.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	sweepBuckets(l.connections, now)
+	sweepBuckets(l.messages, now)
+	sweepBuckets(l.users, now)
+	for ip, f := range l.failures {
+		if now.After(f.bannedUntil) && now.Sub(f.last) > l.limits.AuthLockout {
+			delete(l.failures, ip)
+		}
+	}
+}
+
+// allow takes a token from key's bucket, creating it on first use.
+// A non-positive perMinute means unlimited.
+func allow[K comparable](buckets map[K]*rate.Limiter, key K, perMinute int, now time.Time) bool {
+	if perMinute <= 0 {
+		return true
+	}
+
+	limiter, exists := buckets[key]
+	if !exists {
+		limiter = rate.NewLimiter(rate.Limit(float64(perMinute)/60), perMinute)
+		buckets[key] = limiter
+	}
+	return limiter.AllowN(now, 1)
+}
+
+// sweepBuckets removes buckets that have refilled completely
+func sweepBuckets[K comparable](buckets map[K]*rate.Limiter, now time.Time) {
+	for key, limiter := range buckets {
+		if limiter.TokensAt(now) >= float64(limiter.Burst()) {
+			delete(buckets, key)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package smtp
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a time source that only moves when a test advances it
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestLimiter(limits Limits) (*RateLimiter, *fakeClock) {
+	limiter := NewRateLimiter(limits)
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	limiter.now = clock.Now
+	return limiter, clock
+}
+
+func TestRateLimiter_MaxConnections(t *testing.T) {
+	limiter, _ := newTestLimiter(Limits{MaxConnections: 2, MaxConnectionsPerIP: 1})
+	a := netip.MustParseAddr("192.0.2.1")
+	b := netip.MustParseAddr("192.0.2.2")
+	c := netip.MustParseAddr("192.0.2.3")
+
+	releaseA, reason := limiter.Acquire(a)
+	assert.NotNil(t, releaseA)
+	assert.Empty(t, reason)
+
+	_, reason = limiter.Acquire(a)
+	assert.Equal(t, reasonMaxConnectionsPerIP, reason)
+
+	releaseB, _ := limiter.Acquire(b)
+	assert.NotNil(t, releaseB)
+
+	_, reason = limiter.Acquire(c)
+	assert.Equal(t, reasonMaxConnections, reason)
+
+	// Releasing twice must not free two slots
+	releaseA()
+	releaseA()
+	releaseC, _ := limiter.Acquire(c)
+	assert.NotNil(t, releaseC)
+	_, reason = limiter.Acquire(a)
+	assert.Equal(t, reasonMaxConnections, reason)
+}
+
+func TestRateLimiter_ConnectionRate(t *testing.T) {
+	limiter, clock := newTestLimiter(Limits{ConnectionsPerMinute: 2})
+	ip := netip.MustParseAddr("192.0.2.1")
+
+	for range 2 {
+		release, _ := limiter.Acquire(ip)
+		assert.NotNil(t, release)
+		release()
+	}
+	_, reason := limiter.Acquire(ip)
+	assert.Equal(t, reasonConnectionRate, reason)
+
+	// One token is refilled every 30 seconds
+	clock.Advance(30 * time.Second)
+	release, _ := limiter.Acquire(ip)
+	assert.NotNil(t, release)
+}
+
+func TestRateLimiter_AllowMessage(t *testing.T) {
+	limiter, clock := newTestLimiter(Limits{MessagesPerMinute: 3, UserMessagesPerMinute: 2})
+	a := netip.MustParseAddr("192.0.2.1")
+	b := netip.MustParseAddr("192.0.2.2")
+
+	assert.True(t, limiter.AllowMessage(a, "app"))
+	assert.True(t, limiter.AllowMessage(b, "app"))
+	assert.False(t, limiter.AllowMessage(b, "app"), "user bucket is shared across addresses")
+
+	assert.True(t, limiter.AllowMessage(a, ""))
+	assert.True(t, limiter.AllowMessage(a, ""))
+	assert.False(t, limiter.AllowMessage(a, ""), "ip bucket exhausted")
+
+	clock.Advance(time.Minute)
+	assert.True(t, limiter.AllowMessage(a, "app"))
+}
+
+func TestRateLimiter_AuthLockout(t *testing.T) {
+	limiter, clock := newTestLimiter(Limits{
+		AuthMaxFailures:  3,
+		AuthLockout:      15 * time.Minute,
+		AuthFailureDelay: time.Second,
+	})
+	ip := netip.MustParseAddr("192.0.2.1")
+
+	assert.Equal(t, time.Second, limiter.AuthFailed(ip))
+	assert.Equal(t, 2*time.Second, limiter.AuthFailed(ip))
+	assert.False(t, limiter.Banned(ip))
+
+	assert.Equal(t, 4*time.Second, limiter.AuthFailed(ip))
+	assert.True(t, limiter.Banned(ip))
+
+	_, reason := limiter.Acquire(ip)
+	assert.Equal(t, reasonAuthLockout, reason)
+
+	clock.Advance(16 * time.Minute)
+	assert.False(t, limiter.Banned(ip))
+	assert.Equal(t, time.Second, limiter.AuthFailed(ip), "failure count resets after the lockout window")
+}
+
+func TestRateLimiter_AuthFailureDelayCapped(t *testing.T) {
+	limiter, _ := newTestLimiter(Limits{AuthFailureDelay: time.Second})
+	ip := netip.MustParseAddr("192.0.2.1")
+
+	var delay time.Duration
+	for range 10 {
+		delay = limiter.AuthFailed(ip)
+	}
+	assert.Equal(t, maxAuthFailureDelay, delay)
+	assert.False(t, limiter.Banned(ip), "no ban without AuthMaxFailures")
+}
+
+func TestRateLimiter_AuthSucceededClearsFailures(t *testing.T) {
+	limiter, _ := newTestLimiter(Limits{AuthMaxFailures: 2, AuthLockout: time.Minute, AuthFailureDelay: time.Second})
+	ip := netip.MustParseAddr("192.0.2.1")
+
+	limiter.AuthFailed(ip)
+	limiter.AuthSucceeded(ip)
+	limiter.AuthFailed(ip)
+	assert.False(t, limiter.Banned(ip))
+}
+
+func TestRateLimiter_SweepDiscardsIdleState(t *testing.T) {
+	limiter, clock := newTestLimiter(Limits{ConnectionsPerMinute: 10, AuthLockout: time.Minute})
+	ip := netip.MustParseAddr("192.0.2.1")
+
+	release, _ := limiter.Acquire(ip)
+	release()
+	limiter.AuthFailed(ip)
+	assert.Len(t, limiter.connections, 1)
+
+	clock.Advance(5 * time.Minute)
+	release, _ = limiter.Acquire(netip.MustParseAddr("192.0.2.2"))
+	release()
+	assert.NotContains(t, limiter.connections, ip)
+	assert.NotContains(t, limiter.failures, ip)
+}
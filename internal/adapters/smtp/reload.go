@@ -0,0 +1,101 @@
+package smtp
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/itsLeonB/smtproxy/internal/core/config"
+	"github.com/itsLeonB/smtproxy/internal/core/logger"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/policy"
+)
+
+// reloadConfig re-reads the configuration on SIGHUP, keeping the current
+// settings if it fails to load or validate
+func (s *Server) reloadConfig() {
+	logger.Infof("received SIGHUP, reloading configuration")
+
+	cfg, err := config.Read(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		logger.Errorf("invalid configuration, keeping current settings: %v", err)
+		return
+	}
+	if err := s.Reload(cfg); err != nil {
+		logger.Errorf("failed to reload configuration, keeping current settings: %v", err)
+		return
+	}
+	logger.Infof("configuration reloaded")
+}
+
+// Reload applies the auth users, provider credentials, routing rules,
+// per-user policies and log settings of cfg without interrupting
+// connections. Everything is built before anything is swapped in, so an
+// error leaves the server unchanged.
+// Sessions already open keep the users, rules and policies they started with.
+// Providers that are still configured keep their runtime state, and the
+// default set through the admin API is kept unless DEFAULT_PROVIDER changed.
+// Other settings, such as listen addresses, take effect on restart.
+func (s *Server) Reload(cfg *config.Config) error {
+	registry, err := newRegistry(cfg)
+	if err != nil {
+		return err
+	}
+
+	router, err := NewRouter(cfg)
+	if err != nil {
+		return err
+	}
+
+	policies, err := loadPolicies(cfg)
+	if err != nil {
+		return err
+	}
+
+	var handler *AuthHandler
+	if s.backend.authEnabled {
+		users := cfg.AuthUsers
+		if s.credentials != nil {
+			if users, err = s.credentials.Users(cfg.AuthUsers); err != nil {
+				return fmt.Errorf("failed to load credentials file: %w", err)
+			}
+		}
+		handler = NewAuthHandler(users)
+	}
+
+	if err := logger.Configure("smtproxy", logger.Options{
+		Level:  cfg.LogLevel,
+		Format: cfg.LogFormat,
+		Redact: cfg.LogRedact,
+	}); err != nil {
+		return err
+	}
+
+	// Nothing below can fail
+	if handler != nil {
+		if s.credentials != nil {
+			s.credentials.Rebind(handler, cfg.AuthUsers)
+		}
+		s.backend.SetAuthHandler(handler)
+	}
+	if s.backend.dispatcher != nil {
+		if current := s.backend.dispatcher.Registry(); current != nil {
+			registry.Inherit(current)
+			if config.Global == nil || config.Global.DefaultProvider == cfg.DefaultProvider {
+				// The default may be gone from the new configuration, which then decides
+				_ = registry.SetDefault(current.Default())
+			}
+		}
+		s.backend.dispatcher.SetRegistry(registry)
+	}
+	s.backend.SetRouter(router)
+	switch current := s.backend.policies.Load(); {
+	case policies == nil:
+		s.backend.SetPolicies(nil)
+	case current != nil:
+		current.Reload(policies)
+	default:
+		s.backend.SetPolicies(policy.NewManagerFromFile(policies))
+	}
+	config.Global = cfg
+
+	return nil
+}
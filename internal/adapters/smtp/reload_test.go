@@ -0,0 +1,101 @@
+package smtp
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/core/config"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_Reload(t *testing.T) {
+	registry := provider.NewRegistry()
+	server := NewServer("0", 1024, map[string]string{"old": "pass"}, true, false, registry)
+
+	err := server.Reload(&config.Config{
+		LogLevel:        "info",
+		AuthUsers:       map[string]string{"new": "pass"},
+		DefaultProvider: "brevo",
+		BrevoAPIKey:     "key",
+	})
+
+	assert.NoError(t, err)
+	handler := server.backend.authHandler.Load()
+	assert.NoError(t, handler.AuthPlain(nil, "new", "pass"))
+	assert.Error(t, handler.AuthPlain(nil, "old", "pass"))
+	assert.NotSame(t, registry, server.backend.dispatcher.Registry())
+	assert.Equal(t, "brevo", server.backend.dispatcher.Registry().Default())
+}
+
+func TestServer_Reload_KeepsSettingsOnError(t *testing.T) {
+	registry := provider.NewRegistry()
+	server := NewServer("0", 1024, map[string]string{"old": "pass"}, true, false, registry)
+	handler := server.backend.authHandler.Load()
+
+	err := server.Reload(&config.Config{
+		LogLevel:   "info",
+		AuthUsers:  map[string]string{"new": "pass"},
+		PolicyFile: filepath.Join(t.TempDir(), "missing.json"),
+	})
+
+	assert.Error(t, err)
+	assert.Same(t, handler, server.backend.authHandler.Load())
+	assert.Same(t, registry, server.backend.dispatcher.Registry())
+	assert.NoError(t, handler.AuthPlain(nil, "old", "pass"))
+}
+
+func TestServer_Reload_CredentialsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	writeCredentials(t, path, "file-user", "secret")
+	server := NewServer("0", 1024, nil, true, false, provider.NewRegistry())
+	server.credentials = NewCredentialsWatcher(path, time.Hour, server.backend.authHandler.Load(), nil)
+	assert.NoError(t, server.credentials.Load())
+
+	err := server.Reload(&config.Config{
+		LogLevel:  "info",
+		AuthUsers: map[string]string{"env-user": "pass"},
+	})
+
+	assert.NoError(t, err)
+	handler := server.backend.authHandler.Load()
+	assert.NoError(t, handler.AuthPlain(nil, "env-user", "pass"))
+	assert.NoError(t, handler.AuthPlain(nil, "file-user", "secret"))
+	assert.Same(t, handler, server.credentials.handler)
+}
+
+func TestServer_Reload_KeepsRuntimeProviderState(t *testing.T) {
+	previous := config.Global
+	t.Cleanup(func() { config.Global = previous })
+	cfg := &config.Config{
+		LogLevel: "info",
+		Providers: []config.ProviderConfig{
+			{Name: "primary", Type: config.ProviderTypeBrevo, APIKey: "key"},
+			{Name: "backup", Type: config.ProviderTypeBrevo, APIKey: "key"},
+		},
+		DefaultProvider: "primary",
+	}
+	config.Global = cfg
+	registry, err := newRegistry(cfg)
+	assert.NoError(t, err)
+	server := NewServer("0", 1024, nil, false, false, registry)
+	assert.NoError(t, registry.SetDefault("backup"))
+	assert.NoError(t, registry.Disable("primary"))
+
+	reloaded := *cfg
+	assert.NoError(t, server.Reload(&reloaded))
+
+	current := server.backend.dispatcher.Registry()
+	assert.NotSame(t, registry, current)
+	assert.Equal(t, "backup", current.Default())
+	assert.False(t, current.Enabled("primary"))
+	assert.Same(t, &reloaded, config.Global)
+
+	// A default changed in the configuration replaces the one set at runtime
+	assert.NoError(t, current.SetDefault("primary"))
+	changed := reloaded
+	changed.DefaultProvider = "backup"
+	assert.NoError(t, server.Reload(&changed))
+	assert.Equal(t, "backup", server.backend.dispatcher.Registry().Default())
+}
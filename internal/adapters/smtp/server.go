@@ -2,61 +2,303 @@ package smtp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"net/netip"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/emersion/go-smtp"
+	"github.com/itsLeonB/smtproxy/internal/adapters/admin"
+	"github.com/itsLeonB/smtproxy/internal/adapters/callback"
 	"github.com/itsLeonB/smtproxy/internal/adapters/providers/brevo"
+	"github.com/itsLeonB/smtproxy/internal/adapters/storage/bolt"
 	"github.com/itsLeonB/smtproxy/internal/core/config"
 	"github.com/itsLeonB/smtproxy/internal/core/logger"
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/audit"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/dsn"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/events"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/policy"
 	"github.com/itsLeonB/smtproxy/internal/domain/service/provider"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/queue"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/routing"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/suppression"
 )
 
 // Server wraps the SMTP server
 type Server struct {
-	server *smtp.Server
-	addr   string
+	server       *smtp.Server
+	backend      *Backend
+	queue        *queue.Queue
+	credentials  *CredentialsWatcher
+	admin        *admin.Server
+	audit        *audit.Trail
+	suppressions *suppression.List
+	listener     net.Listener
+	addr         string
+
+	// proxyUpstreams are the load balancers allowed to send PROXY protocol headers
+	proxyUpstreams []netip.Prefix
 }
 
 func Setup() (*Server, error) {
 	authUsers := config.Global.AuthUsers
 
-	// Initialize provider registry
-	registry := provider.NewRegistry()
+	registry, err := newRegistry(config.Global)
+	if err != nil {
+		return nil, err
+	}
+
+	router, err := NewRouter(config.Global)
+	if err != nil {
+		return nil, err
+	}
+
+	srv := NewServer(config.Global.SMTPPort, config.Global.MaxSize, authUsers, config.Global.AuthEnabled, config.Global.AllowInsecureAuth, registry)
+	srv.server.Domain = config.Global.Hostname
+	srv.server.EnableSMTPUTF8 = config.Global.SMTPUTF8Enabled
+	srv.backend.SetDispatchTimeout(config.Global.DispatchTimeout)
+	srv.backend.SetRouter(router)
+	if router != nil {
+		logger.Infof("loaded %d routing rule(s)", len(config.Global.Routes))
+	}
 
-	// Register Brevo provider if configured
-	if config.Global.BrevoAPIKey != "" {
-		brevoConfig := &brevo.Config{
-			APIKey:  config.Global.BrevoAPIKey,
-			BaseURL: config.Global.BrevoBaseURL,
-			Timeout: config.Global.BrevoTimeout,
+	if config.Global.AuthEnabled && config.Global.AuthCredentialsFile != "" {
+		watcher := NewCredentialsWatcher(config.Global.AuthCredentialsFile, config.Global.AuthCredentialsReload, srv.backend.authHandler.Load(), authUsers)
+		if err := watcher.Load(); err != nil {
+			return nil, fmt.Errorf("failed to load credentials file: %w", err)
 		}
+		srv.credentials = watcher
+		logger.Infof("loaded credentials from %s", config.Global.AuthCredentialsFile)
+	}
+
+	if len(config.Global.ClientAllow) > 0 || len(config.Global.ClientDeny) > 0 || len(config.Global.TrustedNetworks) > 0 {
+		access, err := NewAccessList(config.Global.ClientAllow, config.Global.ClientDeny, config.Global.TrustedNetworks)
+		if err != nil {
+			return nil, err
+		}
+		srv.backend.SetAccessList(access)
+	}
+	if !config.Global.AuthEnabled && len(config.Global.ClientAllow) == 0 {
+		logger.Warnf("authentication is disabled and CLIENT_ALLOW is empty: any client that can reach the port may relay")
+	}
 
-		brevoProvider := brevo.NewProvider(brevoConfig)
-		if err := registry.Register(brevoProvider); err != nil {
+	if config.Global.ProxyProtocol {
+		if err := srv.EnableProxyProtocol(config.Global.ProxyProtocolTrusted); err != nil {
 			return nil, err
 		}
+		logger.Infof("PROXY protocol enabled for upstreams %v", config.Global.ProxyProtocolTrusted)
+	}
+
+	srv.backend.SetRateLimiter(NewRateLimiter(Limits{
+		MaxConnections:        config.Global.MaxConnections,
+		MaxConnectionsPerIP:   config.Global.MaxConnectionsPerIP,
+		ConnectionsPerMinute:  config.Global.ConnectionsPerMinute,
+		MessagesPerMinute:     config.Global.MessagesPerMinute,
+		UserMessagesPerMinute: config.Global.UserMessagesPerMinute,
+		AuthMaxFailures:       config.Global.AuthMaxFailures,
+		AuthLockout:           config.Global.AuthLockout,
+		AuthFailureDelay:      config.Global.AuthFailureDelay,
+	}))
+
+	if config.Global.HTTPAddr != "" {
+		srv.admin = admin.NewServer(config.Global.HTTPAddr)
+		srv.admin.SetToken(config.Global.AdminToken)
+		if config.Global.AdminToken == "" {
+			logger.Warnf("ADMIN_TOKEN is empty: management endpoints are disabled")
+		}
+		srv.admin.EnableProviders(srv.backend.dispatcher.Registry)
+		if srv.credentials != nil {
+			srv.admin.EnableCredentialsReload(srv.credentials)
+		}
+	}
+
+	if config.Global.AuditDBPath != "" {
+		store, err := bolt.Open(config.Global.AuditDBPath)
+		if err != nil {
+			return nil, err
+		}
+		srv.EnableAudit(audit.NewTrail(store, config.Global.AuditRetention))
+		logger.Infof("audit trail enabled at %s with %s retention", config.Global.AuditDBPath, config.Global.AuditRetention)
+	}
+
+	if config.Global.SuppressionDBPath != "" {
+		store, err := bolt.OpenSuppressions(config.Global.SuppressionDBPath)
+		if err != nil {
+			return nil, err
+		}
+		srv.EnableSuppressions(suppression.NewList(store, suppression.Mode(config.Global.SuppressionMode)))
+		logger.Infof("suppression list enabled at %s in %s mode", config.Global.SuppressionDBPath, config.Global.SuppressionMode)
+	}
+
+	if srv.admin != nil && config.Global.WebhooksEnabled() {
+		if err := srv.enableWebhooks(config.Global); err != nil {
+			return nil, err
+		}
+	}
+
+	policies, err := loadPolicies(config.Global)
+	if err != nil {
+		return nil, err
+	}
+	if policies != nil {
+		srv.backend.SetPolicies(policy.NewManagerFromFile(policies))
+		logger.Infof("loaded policies for %d user(s)", len(policies.Users))
+	}
+
+	if config.Global.QueueEnabled {
+		// Share the backend's dispatcher so that reloads swap the registry for both
+		disp := srv.backend.dispatcher
+		q := queue.New(queue.Config{
+			Workers:        config.Global.QueueWorkers,
+			Capacity:       config.Global.QueueCapacity,
+			RetryInterval:  config.Global.QueueRetryInterval,
+			MaxAge:         config.Global.QueueMaxAge,
+			AttemptTimeout: config.Global.DispatchTimeout,
+			DelayNotice:    config.Global.DSNDelayAfter,
+		}, disp)
+		if config.Global.DSNEnabled {
+			generator := dsn.NewGenerator(config.Global.Hostname, config.Global.DSNSender, disp)
+			q.OnFailure(notifyHandler(generator, dsn.ActionFailed))
+			q.OnDelay(notifyHandler(generator, dsn.ActionDelayed))
+			// Providers are not DSN-aware, so success is reported as relayed (RFC 3461 section 6.2.6.3)
+			q.OnSuccess(notifyHandler(generator, dsn.ActionRelayed))
+		}
+		if srv.audit != nil {
+			q.OnSuccess(auditHandler(srv.audit, audit.StatusDelivered))
+			q.OnFailure(auditHandler(srv.audit, audit.StatusFailed))
+			q.OnPurge(auditHandler(srv.audit, audit.StatusFailed))
+		}
+		srv.EnableQueue(q)
+		logger.Infof("asynchronous delivery enabled with %d workers", config.Global.QueueWorkers)
+	}
 
-		logger.Infof("registered Brevo provider")
+	return srv, nil
+}
+
+// newRegistry registers the provider instances configured in cfg
+func newRegistry(cfg *config.Config) (*provider.Registry, error) {
+	registry := provider.NewRegistry()
+
+	for _, pc := range cfg.ProviderConfigs() {
+		var p provider.Provider
+		switch pc.Type {
+		case config.ProviderTypeBrevo:
+			p = brevo.NewProvider(&brevo.Config{
+				Name:    pc.Name,
+				APIKey:  pc.APIKey,
+				BaseURL: pc.BaseURL,
+				Timeout: pc.Timeout,
+			})
+		default:
+			return nil, fmt.Errorf("provider %s has unknown type %q", pc.Name, pc.Type)
+		}
+
+		if err := registry.Register(p); err != nil {
+			return nil, err
+		}
+		if err := registry.SetRateLimit(pc.Name, pc.RateLimit); err != nil {
+			return nil, err
+		}
+		logger.Infof("registered %s provider %s", pc.Type, pc.Name)
 	}
 
 	// Set default provider if specified
-	if config.Global.DefaultProvider != "" {
-		if err := registry.SetDefault(config.Global.DefaultProvider); err != nil {
+	if cfg.DefaultProvider != "" {
+		if err := registry.SetDefault(cfg.DefaultProvider); err != nil {
 			return nil, err
 		}
 	}
+	if err := registry.SetWeights(cfg.BalanceWeights, cfg.BalanceSticky); err != nil {
+		return nil, err
+	}
+	registry.SetThrottleWait(cfg.ProviderRateLimitWait)
+	registry.SetBreaker(provider.BreakerConfig{
+		Threshold: cfg.CircuitBreakerThreshold,
+		Cooldown:  cfg.CircuitBreakerCooldown,
+		Probes:    cfg.CircuitBreakerProbes,
+		Failover:  cfg.CircuitBreakerFailover,
+	})
+
+	return registry, nil
+}
+
+// loadPolicies returns the per-user policies from POLICY_FILE or the config
+// file, or nil if there are none
+func loadPolicies(cfg *config.Config) (*policy.File, error) {
+	if cfg.PolicyFile != "" {
+		return policy.LoadFile(cfg.PolicyFile)
+	}
+	if cfg.Policies == nil {
+		return nil, nil
+	}
+
+	file := &policy.File{Users: make(map[string]policy.Policy, len(cfg.Policies.Users))}
+	if cfg.Policies.Default != nil {
+		p := policy.Policy(*cfg.Policies.Default)
+		file.Default = &p
+	}
+	for user, p := range cfg.Policies.Users {
+		file.Users[user] = policy.Policy(p)
+	}
+	return file, nil
+}
+
+// NewRouter compiles the routing rules configured in cfg, or returns nil if there are none
+func NewRouter(cfg *config.Config) (*routing.Router, error) {
+	if len(cfg.Routes) == 0 {
+		return nil, nil
+	}
 
-	return NewServer(config.Global.SMTPPort, config.Global.MaxSize, authUsers, config.Global.AuthEnabled, config.Global.AllowInsecureAuth, registry), nil
+	rules := make([]routing.Rule, len(cfg.Routes))
+	for i, route := range cfg.Routes {
+		rules[i] = routing.Rule{
+			Name:     route.Name,
+			Provider: route.Provider,
+			Match: routing.Match{
+				Users:            route.Match.Users,
+				SenderDomains:    route.Match.SenderDomains,
+				RecipientDomains: route.Match.RecipientDomains,
+				Headers:          route.Match.Headers,
+				MinSize:          route.Match.MinSize,
+				MaxSize:          route.Match.MaxSize,
+				HasAttachments:   route.Match.HasAttachments,
+			},
+		}
+	}
+	return routing.NewRouter(rules)
+}
+
+// notifyHandler returns a queue handler that reports action to the envelope sender
+func notifyHandler(generator *dsn.Generator, action dsn.Action) queue.Handler {
+	return func(ctx context.Context, msg *queue.Message, err error) {
+		status := dsn.Status{
+			Action:    action,
+			ArrivedAt: msg.EnqueuedAt,
+		}
+		if err != nil {
+			status.Diagnostic = err.Error()
+		}
+		if notifyErr := generator.Notify(ctx, msg.Email, msg.Provider, status); notifyErr != nil {
+			logger.Errorf("queued message %s: %v", msg.ID, notifyErr)
+		}
+	}
+}
+
+// auditHandler returns a queue handler that records the message's final status
+func auditHandler(trail *audit.Trail, status audit.Status) queue.Handler {
+	return func(ctx context.Context, msg *queue.Message, err error) {
+		trail.Complete(msg.ID, status, err)
+	}
 }
 
 // NewServer creates a new SMTP server
 func NewServer(port string, maxMessageSize int64, authUsers map[string]string, authEnabled bool, allowInsecureAuth bool, registry *provider.Registry) *Server {
 	var authHandler *AuthHandler
-	if authEnabled && len(authUsers) > 0 {
+	if authEnabled {
 		authHandler = NewAuthHandler(authUsers)
 	}
 
@@ -69,30 +311,196 @@ func NewServer(port string, maxMessageSize int64, authUsers map[string]string, a
 	s.AllowInsecureAuth = allowInsecureAuth
 
 	return &Server{
-		server: s,
-		addr:   s.Addr,
+		server:  s,
+		backend: backend,
+		addr:    s.Addr,
+	}
+}
+
+// EnableQueue makes the server acknowledge messages once queued and deliver
+// them asynchronously, and lets the HTTP server manage the queue
+func (s *Server) EnableQueue(q *queue.Queue) {
+	s.queue = q
+	s.backend.SetQueue(q)
+	s.server.EnableDSN = true
+	if s.admin != nil {
+		s.admin.EnableQueue(q)
+	}
+}
+
+// EnableAudit records accepted messages in trail and serves their history
+// through the HTTP server when one is configured
+func (s *Server) EnableAudit(trail *audit.Trail) {
+	s.audit = trail
+	s.backend.SetAudit(trail)
+	if s.admin != nil {
+		s.admin.EnableAudit(trail)
+	}
+}
+
+// EnableSuppressions checks recipients against list and lets the HTTP
+// server manage it when one is configured
+func (s *Server) EnableSuppressions(list *suppression.List) {
+	s.suppressions = list
+	s.backend.SetSuppressions(list)
+	if s.admin != nil {
+		s.admin.EnableSuppressions(list)
 	}
 }
 
+// enableWebhooks receives the delivery events of every Brevo instance on the
+// HTTP server, adds them to the audit trail, suppresses hard bounced and
+// complaining recipients and forwards the events to the configured callback
+func (s *Server) enableWebhooks(cfg *config.Config) error {
+	networks, err := parsePrefixes(cfg.BrevoWebhookNetworks)
+	if err != nil {
+		return err
+	}
+
+	var recorder events.Recorder
+	if s.audit != nil {
+		recorder = s.audit
+	}
+	var forwarder events.Forwarder
+	if cfg.WebhookForwardURL != "" {
+		forwarder = callback.NewForwarder(callback.Config{
+			URL:     cfg.WebhookForwardURL,
+			Secret:  cfg.WebhookForwardSecret,
+			Timeout: cfg.WebhookForwardTimeout,
+		})
+		logger.Infof("forwarding delivery events to %s", cfg.WebhookForwardURL)
+	}
+
+	handler := events.NewHandler(recorder, forwarder)
+	if s.suppressions != nil {
+		handler.SetSuppressor(s.suppressions)
+	}
+	// Each instance has its own route, so that its events carry its name
+	for _, pc := range cfg.WebhookProviders() {
+		name := pc.Name
+		auth := admin.WebhookAuth{Token: pc.WebhookToken, Networks: networks}
+		parse := func(body []byte) ([]entity.DeliveryEvent, error) {
+			return brevo.ParseWebhook(name, body)
+		}
+		s.admin.EnableWebhook(name, auth, parse, handler)
+		logger.Infof("receiving Brevo webhooks for %s at /webhooks/%s", name, name)
+	}
+	return nil
+}
+
+// EnableProxyProtocol makes connections from the trusted upstream networks
+// carry the real client address in a PROXY protocol v1 or v2 header
+func (s *Server) EnableProxyProtocol(trusted []string) error {
+	upstreams, err := parsePrefixes(trusted)
+	if err != nil {
+		return err
+	}
+	if len(upstreams) == 0 {
+		return errors.New("PROXY protocol requires at least one trusted upstream network")
+	}
+
+	s.proxyUpstreams = upstreams
+	return nil
+}
+
 // Start starts the SMTP server
 func (s *Server) Start() error {
 	ln, err := net.Listen("tcp", s.addr)
 	if err != nil {
 		return fmt.Errorf("failed to listen on %s: %w", s.addr, err)
 	}
+	if s.proxyUpstreams != nil {
+		ln = proxyListener(ln, s.proxyUpstreams)
+	}
+
+	if s.queue != nil {
+		s.queue.Start()
+	}
+	if s.credentials != nil {
+		s.credentials.Start()
+	}
+	if s.audit != nil {
+		s.audit.Start()
+	}
+	if s.admin != nil {
+		if err := s.admin.Start(); err != nil {
+			_ = ln.Close()
+			return err
+		}
+	}
+
+	s.listener = ln
 
 	go func() {
-		if err := s.server.Serve(ln); err != nil {
-			fmt.Printf("SMTP server error: %v\n", err)
+		if err := s.server.Serve(ln); err != nil && !errors.Is(err, net.ErrClosed) && !errors.Is(err, smtp.ErrServerClosed) {
+			logger.Errorf("SMTP server error: %v", err)
 		}
 	}()
 
 	return nil
 }
 
-// Shutdown gracefully shuts down the SMTP server
+// Shutdown stops accepting connections and refuses new transactions with 421.
+// Transactions in progress may finish until ctx is done, after which the
+// remaining connections are closed and the aborted work is reported.
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.server.Close()
+	var err error
+	if s.listener != nil {
+		if closeErr := s.listener.Close(); closeErr != nil && !errors.Is(closeErr, net.ErrClosed) {
+			err = closeErr
+		}
+	}
+
+	if aborted := s.backend.transactions.drain(ctx); len(aborted) > 0 {
+		logger.Warnf("shutdown deadline reached, aborting %d transaction(s) in progress from %v", len(aborted), aborted)
+	}
+	// Cancel dispatches still running before their connections are closed
+	s.backend.cancel()
+	if closeErr := s.server.Close(); closeErr != nil && !errors.Is(closeErr, net.ErrClosed) && err == nil {
+		err = closeErr
+	}
+
+	if s.admin != nil {
+		if adminErr := s.admin.Shutdown(ctx); adminErr != nil {
+			logger.Errorf("failed to shut down HTTP server: %v", adminErr)
+		}
+	}
+	if s.credentials != nil {
+		s.credentials.Stop()
+	}
+	if s.queue != nil {
+		if undelivered := s.queue.Shutdown(ctx); len(undelivered) > 0 {
+			logger.Warnf("stopped queue with %d undelivered message(s)", len(undelivered))
+			s.discard(undelivered)
+		}
+	}
+	if s.audit != nil {
+		s.audit.Stop()
+	}
+	if s.suppressions != nil {
+		if closeErr := s.suppressions.Close(); closeErr != nil {
+			logger.Errorf("failed to close suppression list: %v", closeErr)
+		}
+	}
+	return err
+}
+
+// discard reports each message the queue could not deliver before shutdown,
+// which is lost with the process, so that its sender can be told to resend
+func (s *Server) discard(undelivered []queue.Message) {
+	for _, msg := range undelivered {
+		args := []any{"message_id", msg.ID, "session_id", msg.SessionID, "attempts", msg.Attempts}
+		if msg.Email != nil {
+			args = append(args, "from", msg.Email.Envelope.From, "recipients", msg.Email.Envelope.To)
+		}
+		if msg.LastError != nil {
+			args = append(args, "error", msg.LastError)
+		}
+		logger.WarnContext(context.Background(), "undelivered message discarded at shutdown", args...)
+		if s.audit != nil {
+			s.audit.Complete(msg.ID, audit.StatusFailed, queue.ErrDiscarded)
+		}
+	}
 }
 
 // Run starts the SMTP server, blocks until termination signal, then executes Shutdown
@@ -111,16 +519,27 @@ func (s *Server) Run() {
 	defer cancel()
 
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 
-	select {
-	case sig := <-c:
-		logger.Infof("received signal: %v", sig)
-	case <-ctx.Done():
+wait:
+	for {
+		select {
+		case sig := <-c:
+			if sig == syscall.SIGHUP {
+				s.reloadConfig()
+				continue
+			}
+			logger.Infof("received signal: %v", sig)
+			break wait
+		case <-ctx.Done():
+			break wait
+		}
 	}
 
-	logger.Info("shutting down server")
-	if err := s.Shutdown(context.Background()); err != nil {
+	logger.Infof("shutting down server, draining for up to %s", config.Global.ShutdownTimeout)
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), config.Global.ShutdownTimeout)
+	defer cancelShutdown()
+	if err := s.Shutdown(shutdownCtx); err != nil {
 		logger.Errorf("error during shutdown: %v", err)
 	}
 }
@@ -2,9 +2,26 @@ package smtp
 
 import (
 	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	netsmtp "net/smtp"
+	"net/textproto"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/itsLeonB/smtproxy/internal/adapters/admin"
+	"github.com/itsLeonB/smtproxy/internal/adapters/storage/bolt"
+	"github.com/itsLeonB/smtproxy/internal/core/config"
+	"github.com/itsLeonB/smtproxy/internal/core/metrics"
+	"github.com/itsLeonB/smtproxy/internal/core/requestctx"
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/audit"
 	"github.com/itsLeonB/smtproxy/internal/domain/service/provider"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/queue"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -59,3 +76,254 @@ func TestNewServer_AllowInsecureAuth(t *testing.T) {
 	server = NewServer(port, maxSize, authUsers, true, true, registry)
 	assert.True(t, server.server.AllowInsecureAuth)
 }
+
+func TestServer_EnableQueue(t *testing.T) {
+	server := NewServer("0", 1024, nil, false, false, nil)
+	q := queue.New(queue.Config{}, nil)
+
+	server.EnableQueue(q)
+
+	assert.Equal(t, q, server.backend.queue)
+	assert.True(t, server.server.EnableDSN)
+}
+
+// blockingProvider holds every send until released
+type blockingProvider struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingProvider() *blockingProvider {
+	return &blockingProvider{started: make(chan struct{}, 10), release: make(chan struct{})}
+}
+
+func (p *blockingProvider) Name() string { return "blocking" }
+
+func (p *blockingProvider) Send(ctx context.Context, email *entity.Email) (string, error) {
+	p.started <- struct{}{}
+	<-p.release
+	return "", nil
+}
+
+func (p *blockingProvider) IsHealthy(ctx context.Context) error { return nil }
+
+func startBlockingServer(t *testing.T) (*Server, *blockingProvider) {
+	t.Helper()
+
+	blocking := newBlockingProvider()
+	registry := provider.NewRegistry()
+	assert.NoError(t, registry.Register(blocking))
+
+	server := NewServer("0", 1024, nil, false, false, registry)
+	assert.NoError(t, server.Start())
+	return server, blocking
+}
+
+// sendAsync sends a message and reports the reply to DATA. QUIT is not
+// checked because the server may close the connection once drained.
+func sendAsync(addr string) chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- func() error {
+			client, err := netsmtp.Dial(addr)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = client.Close()
+			}()
+
+			if err := client.Mail("app@example.com"); err != nil {
+				return err
+			}
+			if err := client.Rcpt("user@example.com"); err != nil {
+				return err
+			}
+			w, err := client.Data()
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write([]byte("Subject: Test\r\n\r\nHello\r\n")); err != nil {
+				return err
+			}
+			return w.Close()
+		}()
+	}()
+	return result
+}
+
+func TestServer_DataReplyNamesMessage(t *testing.T) {
+	registry := provider.NewRegistry()
+	mock := provider.NewMockProvider("mock")
+	mock.SetMessageID("<abc@smtp-relay.example.com>")
+	assert.NoError(t, registry.Register(mock))
+	server := NewServer("0", 1024, nil, false, false, registry)
+	assert.NoError(t, server.Start())
+	defer func() {
+		_ = server.Shutdown(context.Background())
+	}()
+
+	conn, err := textproto.Dial("tcp", server.listener.Addr().String())
+	assert.NoError(t, err)
+	defer func() {
+		_ = conn.Close()
+	}()
+	_, _, err = conn.ReadResponse(220)
+	assert.NoError(t, err)
+	var reply string
+	for _, step := range []struct {
+		cmd  string
+		code int
+	}{
+		{"EHLO client.example.com", 250},
+		{"MAIL FROM:<app@example.com>", 250},
+		{"RCPT TO:<user@example.com>", 250},
+		{"DATA", 354},
+		{"Subject: Test\r\n\r\nHello\r\n.", 250},
+	} {
+		_, err = conn.Cmd("%s", step.cmd)
+		assert.NoError(t, err)
+		_, reply, err = conn.ReadResponse(step.code)
+		assert.NoError(t, err, step.cmd)
+	}
+
+	assert.Equal(t, "2.0.0 OK queued as <abc@smtp-relay.example.com>", reply)
+}
+
+func TestServer_ShutdownDrainsTransactions(t *testing.T) {
+	server, blocking := startBlockingServer(t)
+	addr := server.listener.Addr().String()
+
+	idle, err := netsmtp.Dial(addr)
+	assert.NoError(t, err)
+	defer func() {
+		_ = idle.Close()
+	}()
+	assert.NoError(t, idle.Hello("client.example.com"))
+
+	sent := sendAsync(addr)
+	<-blocking.started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- server.Shutdown(ctx)
+	}()
+
+	// New transactions are refused with 421 while the in-flight one drains
+	assert.Eventually(t, func() bool {
+		err := idle.Mail("app@example.com")
+		return err != nil && strings.HasPrefix(err.Error(), "421")
+	}, time.Second, 10*time.Millisecond)
+
+	// No new connections are accepted
+	_, err = net.DialTimeout("tcp", addr, time.Second)
+	assert.Error(t, err)
+
+	close(blocking.release)
+	assert.NoError(t, <-sent, "the in-flight message completes")
+	assert.NoError(t, <-shutdown)
+}
+
+func TestServer_ShutdownAbortsAtDeadline(t *testing.T) {
+	server, blocking := startBlockingServer(t)
+	defer close(blocking.release)
+
+	sent := sendAsync(server.listener.Addr().String())
+	<-blocking.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.NoError(t, server.Shutdown(ctx))
+
+	assert.Error(t, <-sent, "the connection is closed once the deadline passes")
+}
+
+func TestServer_ShutdownRecordsDiscardedMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.db")
+	store, err := bolt.Open(path)
+	assert.NoError(t, err)
+	server := NewServer("0", 1024, nil, false, false, nil)
+	server.EnableAudit(audit.NewTrail(store, 0))
+	// Without workers the message is still queued when the server stops
+	q := queue.New(queue.Config{}, nil)
+	server.EnableQueue(q)
+
+	ctx := requestctx.WithMessageID(context.Background(), "m1")
+	email := &entity.Email{Envelope: entity.Envelope{From: "app@example.com", To: []string{"user@example.com"}}}
+	server.audit.Accepted(ctx, email, 10, audit.StatusQueued)
+	_, err = q.Enqueue(ctx, email, "")
+	assert.NoError(t, err)
+
+	assert.NoError(t, server.Shutdown(context.Background()))
+
+	store, err = bolt.Open(path)
+	assert.NoError(t, err)
+	defer func() {
+		_ = store.Close()
+	}()
+	records, err := store.Search(audit.Query{ID: "m1"})
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, audit.StatusFailed, records[0].Status)
+		assert.Equal(t, queue.ErrDiscarded.Error(), records[0].Error)
+	}
+}
+
+func TestNewRegistry_NamedInstances(t *testing.T) {
+	registry, err := newRegistry(&config.Config{
+		DefaultProvider: "brevo-tx",
+		Providers: []config.ProviderConfig{
+			{Name: "brevo-tx", Type: config.ProviderTypeBrevo, APIKey: "tx-key"},
+			{Name: "brevo-mkt", Type: config.ProviderTypeBrevo, APIKey: "mkt-key"},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"brevo-mkt", "brevo-tx"}, registry.ListProviders())
+	assert.Equal(t, "brevo-tx", registry.Default())
+}
+
+func TestServer_WebhooksPerInstance(t *testing.T) {
+	server := NewServer("0", 1024, nil, false, false, provider.NewRegistry())
+	server.admin = admin.NewServer(":0")
+	assert.NoError(t, server.enableWebhooks(&config.Config{
+		Providers: []config.ProviderConfig{
+			{Name: "brevo-tx", Type: config.ProviderTypeBrevo, APIKey: "tx-key", WebhookToken: "tx-hook"},
+			{Name: "brevo-mkt", Type: config.ProviderTypeBrevo, APIKey: "mkt-key", WebhookToken: "mkt-hook"},
+		},
+	}))
+	post := func(path, token string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"event": "delivered", "email": "bob@example.org", "message-id": "<m1@example.com>"}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		server.admin.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+	received := testutil.ToFloat64(metrics.WebhookEvents.WithLabelValues("brevo-mkt", "delivered", "unmatched"))
+
+	// Each instance checks its own token and reports events under its own name
+	assert.Equal(t, http.StatusUnauthorized, post("/webhooks/brevo-mkt", "tx-hook"))
+	assert.Equal(t, http.StatusOK, post("/webhooks/brevo-mkt", "mkt-hook"))
+	assert.Equal(t, http.StatusOK, post("/webhooks/brevo-tx", "tx-hook"))
+	assert.Equal(t, http.StatusNotFound, post("/webhooks/brevo", "tx-hook"))
+	assert.Equal(t, received+1, testutil.ToFloat64(metrics.WebhookEvents.WithLabelValues("brevo-mkt", "delivered", "unmatched")))
+}
+
+func TestLoadPolicies_ConfigFile(t *testing.T) {
+	policies, err := loadPolicies(&config.Config{
+		Policies: &config.PolicyConfig{
+			Default: &config.UserPolicy{MaxRecipients: 50},
+			Users:   map[string]config.UserPolicy{"app1": {DailyQuota: 1000}},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 50, policies.Default.MaxRecipients)
+	assert.Equal(t, 1000, policies.Users["app1"].DailyQuota)
+
+	policies, err = loadPolicies(&config.Config{})
+	assert.NoError(t, err)
+	assert.Nil(t, policies)
+}
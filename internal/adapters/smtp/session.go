@@ -1,28 +1,122 @@
 package smtp
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/mail"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/emersion/go-sasl"
 	"github.com/emersion/go-smtp"
 	"github.com/itsLeonB/smtproxy/internal/core/logger"
+	"github.com/itsLeonB/smtproxy/internal/core/metrics"
+	"github.com/itsLeonB/smtproxy/internal/core/requestctx"
+	"github.com/itsLeonB/smtproxy/internal/core/tracing"
 	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/audit"
 	"github.com/itsLeonB/smtproxy/internal/domain/service/dispatcher"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/dsn"
 	"github.com/itsLeonB/smtproxy/internal/domain/service/parser"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/policy"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/provider"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/queue"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/routing"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/suppression"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// errUTF8Required rejects non-ASCII addresses sent without the SMTPUTF8 parameter (RFC 6531 section 3.4)
+	errUTF8Required = &smtp.SMTPError{
+		Code:         553,
+		EnhancedCode: smtp.EnhancedCode{5, 6, 7},
+		Message:      "Non-ASCII addresses require SMTPUTF8",
+	}
+	errSenderNotAllowed = &smtp.SMTPError{
+		Code:         550,
+		EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+		Message:      "Sender address not allowed for this user",
+	}
+	errTooManyRecipients = &smtp.SMTPError{
+		Code:         452,
+		EnhancedCode: smtp.EnhancedCode{4, 5, 3},
+		Message:      "Too many recipients",
+	}
+	// errTooManyHeaderRecipients is permanent because the message itself names too many recipients
+	errTooManyHeaderRecipients = &smtp.SMTPError{
+		Code:         550,
+		EnhancedCode: smtp.EnhancedCode{5, 5, 3},
+		Message:      "Too many recipients in message headers",
+	}
+	errMessageTooLarge = &smtp.SMTPError{
+		Code:         552,
+		EnhancedCode: smtp.EnhancedCode{5, 3, 4},
+		Message:      "Message size exceeds limit for this user",
+	}
+	errQuotaExceeded = &smtp.SMTPError{
+		Code:         450,
+		EnhancedCode: smtp.EnhancedCode{4, 7, 1},
+		Message:      "Daily sending quota exceeded, try again tomorrow",
+	}
+	errRateLimited = &smtp.SMTPError{
+		Code:         450,
+		EnhancedCode: smtp.EnhancedCode{4, 7, 1},
+		Message:      "Message rate limit exceeded, try again later",
+	}
+	errRecipientSuppressed = &smtp.SMTPError{
+		Code:         550,
+		EnhancedCode: smtp.EnhancedCode{5, 1, 1},
+		Message:      "Recipient address is suppressed",
+	}
+	errMessageSuppressed = &smtp.SMTPError{
+		Code:         550,
+		EnhancedCode: smtp.EnhancedCode{5, 1, 1},
+		Message:      "Message names a suppressed recipient",
+	}
 )
 
 // Session implements smtp.Session interface
 type Session struct {
+	id              string
+	ctx             context.Context
+	cancel          context.CancelFunc
+	span            trace.Span
+	dispatchTimeout time.Duration
+
 	from           string
 	to             []string
+	utf8           bool
+	dsnReturn      string
+	envelopeID     string
+	rcptParams     map[string]entity.RecipientParams
 	maxMessageSize int64
 	authHandler    *AuthHandler
 	authEnabled    bool
+	trusted        bool
 	identity       *ClientIdentity
 	parser         *parser.Parser
 	dispatcher     *dispatcher.Dispatcher
+	queue          *queue.Queue
+	policies       *policy.Manager
+	reservation    *policy.Reservation
+	router         *routing.Router
+	audit          *audit.Trail
+	suppressions   *suppression.List
+	suppressed     []string
+	remoteIP       netip.Addr
+	conn           net.Conn
+	limiter        *RateLimiter
+	release        func()
+	transactions   *transactions
+	inTransaction  bool
 }
 
 // AuthPlain handles AUTH PLAIN authentication
@@ -65,74 +159,518 @@ func (s *Session) AuthLogin(username, password string) error {
 	return nil
 }
 
+// AuthMechanisms returns the SASL mechanisms advertised in the EHLO response
+func (s *Session) AuthMechanisms() []string {
+	return []string{sasl.Plain, sasl.Login}
+}
+
+// Auth returns the SASL server handling the AUTH exchange for mech
+func (s *Session) Auth(mech string) (sasl.Server, error) {
+	if s.transactions != nil && s.transactions.isDraining() {
+		return nil, errShuttingDown
+	}
+	if s.limiter != nil && s.limiter.Banned(s.remoteIP) {
+		return nil, errAuthLocked
+	}
+
+	switch mech {
+	case sasl.Plain:
+		return sasl.NewPlainServer(func(identity, username, password string) error {
+			if identity != "" && identity != username {
+				return s.authFailed(username)
+			}
+			if err := s.AuthPlain(username, password); err != nil {
+				return s.authFailed(username)
+			}
+			s.authSucceeded()
+			return nil
+		}), nil
+	case sasl.Login:
+		return &loginServer{authenticate: func(username, password string) error {
+			if err := s.AuthLogin(username, password); err != nil {
+				return s.authFailed(username)
+			}
+			s.authSucceeded()
+			return nil
+		}}, nil
+	default:
+		return nil, smtp.ErrAuthUnknownMechanism
+	}
+}
+
+// authFailed logs a failed AUTH attempt and delays the reply progressively
+func (s *Session) authFailed(username string) error {
+	logger.WarnContext(s.context(), "authentication failed", "username", username)
+	if s.limiter != nil {
+		time.Sleep(s.limiter.AuthFailed(s.remoteIP))
+	}
+	return smtp.ErrAuthFailed
+}
+
+// authSucceeded clears the client's AUTH failure history
+func (s *Session) authSucceeded() {
+	if s.span != nil {
+		s.span.SetAttributes(attribute.String("smtp.user", s.username()))
+	}
+	if s.limiter != nil {
+		s.limiter.AuthSucceeded(s.remoteIP)
+	}
+}
+
 // Mail handles MAIL FROM command
 func (s *Session) Mail(from string, opts *smtp.MailOptions) error {
-	if s.authEnabled && (s.identity == nil || !s.identity.IsAuthenticated()) {
+	if s.requiresAuth() {
 		return errors.New("authentication required")
 	}
 	
+	utf8 := opts != nil && opts.UTF8
+	if !utf8 && !provider.IsASCII(from) {
+		return errUTF8Required
+	}
+	if s.limiter != nil && !s.limiter.AllowMessage(s.remoteIP, s.username()) {
+		logger.WarnContext(s.context(), "message rate limit exceeded")
+		return errRateLimited
+	}
+
+	pol := s.policy()
+	if !pol.AllowsSender(from) {
+		logger.WarnContext(s.context(), "sender rejected by policy", "from", from)
+		return errSenderNotAllowed
+	}
+	if pol.MaxMessageSize > 0 && opts != nil && opts.Size > pol.MaxMessageSize {
+		return errMessageTooLarge
+	}
+	if s.policies != nil {
+		s.releaseQuota()
+		reservation, err := s.policies.Reserve(s.username())
+		if err != nil {
+			return errQuotaExceeded
+		}
+		s.reservation = reservation
+	}
+
+	if s.transactions != nil && !s.inTransaction {
+		if !s.transactions.begin(s) {
+			s.releaseQuota()
+			return errShuttingDown
+		}
+		s.inTransaction = true
+	}
+
 	s.from = from
+	s.utf8 = utf8
+	if opts != nil {
+		s.dsnReturn = string(opts.Return)
+		s.envelopeID = opts.EnvelopeID
+	}
 	return nil
 }
 
 // Rcpt handles RCPT TO command
 func (s *Session) Rcpt(to string, opts *smtp.RcptOptions) error {
-	if s.authEnabled && (s.identity == nil || !s.identity.IsAuthenticated()) {
+	if s.requiresAuth() {
 		return errors.New("authentication required")
 	}
 	
+	if !s.utf8 && !provider.IsASCII(to) {
+		return errUTF8Required
+	}
+	if maxRecipients := s.policy().MaxRecipients; maxRecipients > 0 && len(s.to) >= maxRecipients {
+		return errTooManyRecipients
+	}
+	if s.suppressions != nil {
+		if entry, found := s.suppressions.Lookup(to); found {
+			switch s.suppressions.Mode() {
+			case suppression.ModeReject:
+				metrics.SuppressedRecipients.WithLabelValues("rejected").Inc()
+				logger.InfoContext(s.context(), "suppressed recipient rejected", "recipient", entry.Address, "reason", entry.Reason)
+				return errRecipientSuppressed
+			case suppression.ModeDrop:
+				// Accept the recipient so the sender does not retry, but never deliver to it
+				s.addSuppressed(entry.Address)
+				return nil
+			default:
+				s.addSuppressed(entry.Address)
+			}
+		}
+	}
+
 	s.to = append(s.to, to)
+	if opts != nil && (len(opts.Notify) > 0 || opts.OriginalRecipient != "") {
+		params := entity.RecipientParams{}
+		for _, notify := range opts.Notify {
+			params.Notify = append(params.Notify, string(notify))
+		}
+		if opts.OriginalRecipient != "" {
+			params.OriginalRecipient = strings.ToLower(string(opts.OriginalRecipientType)) + ";" + opts.OriginalRecipient
+		}
+		if s.rcptParams == nil {
+			s.rcptParams = make(map[string]entity.RecipientParams)
+		}
+		s.rcptParams[to] = params
+	}
 	return nil
 }
 
 // Data handles DATA command
 func (s *Session) Data(r io.Reader) error {
-	if s.authEnabled && (s.identity == nil || !s.identity.IsAuthenticated()) {
-		return errors.New("authentication required")
+	messageID := requestctx.NewID()
+	ctx, span := tracing.Start(requestctx.WithMessageID(s.context(), messageID), "smtp.data",
+		trace.WithAttributes(attribute.String("smtp.message_id", messageID), attribute.Int("smtp.recipients", len(s.to))))
+	id, err := s.data(ctx, r)
+	tracing.End(span, err)
+	if err != nil {
+		return err
+	}
+	return acceptedReply(id)
+}
+
+// acceptedReply returns the 250 reply to DATA naming the accepted message.
+// Returning nil would make go-smtp reply with a fixed "OK: queued", but its
+// dataErrorToStatus writes the code and text of any returned SMTPError as
+// they are, success codes included, so this error carries the reply instead
+// of a failure.
+func acceptedReply(id string) error {
+	return &smtp.SMTPError{
+		Code:         250,
+		EnhancedCode: smtp.EnhancedCode{2, 0, 0},
+		Message:      "OK queued as " + id,
+	}
+}
+
+// data receives, parses and delivers the message identified by ctx. It
+// returns the ID the message can be traced by: the provider's message ID
+// when delivered inline, else the queue ID.
+func (s *Session) data(ctx context.Context, r io.Reader) (string, error) {
+	if s.requiresAuth() {
+		return "", errors.New("authentication required")
 	}
 	
 	if s.from == "" {
-		return errors.New("no sender specified")
+		return "", errors.New("no sender specified")
 	}
-	if len(s.to) == 0 {
-		return errors.New("no recipients specified")
+	if len(s.to) == 0 && len(s.suppressed) == 0 {
+		return "", errors.New("no recipients specified")
 	}
 
+	pol := s.policy()
+
 	// Validate message size
+	maxSize := s.maxMessageSize
+	if pol.MaxMessageSize > 0 && pol.MaxMessageSize < maxSize {
+		maxSize = pol.MaxMessageSize
+	}
 	limitedReader := &sizeLimitReader{
 		reader:   r,
-		maxSize:  s.maxMessageSize,
+		maxSize:  maxSize,
 		bytesRead: 0,
 	}
 
+	// Keep the original message when the client asked for it to be returned in a bounce
+	var reader io.Reader = limitedReader
+	var raw *bytes.Buffer
+	if s.queue != nil && strings.EqualFold(s.dsnReturn, dsn.ReturnFull) {
+		raw = &bytes.Buffer{}
+		reader = io.TeeReader(limitedReader, raw)
+	}
+
 	// Parse email using the MIME parser
-	parsedEmail, err := s.parser.Parse(limitedReader)
-	logger.Debugf("smtp DATA received bytes=%d", limitedReader.bytesRead)
+	_, parseSpan := tracing.Start(ctx, "parser.parse")
+	parsedEmail, err := s.parser.Parse(reader)
+	parseSpan.SetAttributes(attribute.Int64("smtp.message_size", limitedReader.bytesRead))
+	tracing.End(parseSpan, err)
+	logger.DebugContext(ctx, "smtp DATA received", "bytes", limitedReader.bytesRead)
+	if limitedReader.exceeded {
+		if maxSize < s.maxMessageSize {
+			return "", errMessageTooLarge
+		}
+		return "", smtp.ErrDataTooLarge
+	}
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	// Dispatch email via provider
-	if s.dispatcher != nil {
-		err = s.dispatcher.Dispatch(context.Background(), parsedEmail, "")
+	parsedEmail.Envelope = entity.Envelope{
+		From:       s.from,
+		To:         append([]string(nil), s.to...),
+		UTF8:       s.utf8,
+		Return:     s.dsnReturn,
+		EnvelopeID: s.envelopeID,
+		Recipients: s.rcptParams,
+	}
+	if raw != nil {
+		parsedEmail.Raw = raw.Bytes()
+	}
+
+	// Providers send from the header address, so it must satisfy the policy too
+	if parsedEmail.Headers.From != nil && !pol.AllowsSender(parsedEmail.Headers.From.Address) {
+		logger.WarnContext(s.context(), "header sender rejected by policy", "from", parsedEmail.Headers.From.Address)
+		return "", errSenderNotAllowed
+	}
+	// Providers deliver to the header recipients, so they count against the limit too
+	if pol.MaxRecipients > 0 && headerRecipients(parsedEmail) > pol.MaxRecipients {
+		logger.WarnContext(s.context(), "header recipients exceed policy limit", "max_recipients", pol.MaxRecipients)
+		return "", errTooManyHeaderRecipients
+	}
+
+	if s.suppressions != nil {
+		suppressed, deliverable := s.suppressions.Filter(parsedEmail)
+		// Providers deliver to the header recipients, which reject mode leaves as written
+		if s.suppressions.Mode() == suppression.ModeReject && len(suppressed) > 0 {
+			metrics.SuppressedRecipients.WithLabelValues("rejected").Add(float64(len(suppressed)))
+			logger.InfoContext(ctx, "message rejected, suppressed recipients named", "recipients", suppressed)
+			return "", errMessageSuppressed
+		}
+		for _, address := range suppressed {
+			s.addSuppressed(address)
+		}
+		if len(s.suppressed) > 0 {
+			action := "dropped"
+			if s.suppressions.Mode() == suppression.ModeTag {
+				action = "tagged"
+			}
+			metrics.SuppressedRecipients.WithLabelValues(action).Add(float64(len(s.suppressed)))
+		}
+		if !deliverable {
+			// Nobody is left to deliver to, so accept the message without sending it
+			id := requestctx.MessageID(ctx)
+			s.recordAccepted(ctx, parsedEmail, limitedReader.bytesRead, audit.StatusSuppressed)
+			s.recordOutcome(ctx, audit.StatusSuppressed, nil)
+			logger.InfoContext(ctx, "message dropped, all recipients suppressed", "suppressed", len(s.suppressed))
+			s.resetEnvelope()
+			return id, nil
+		}
+	}
+
+	ctx, providerName := s.route(ctx, parsedEmail, pol, limitedReader.bytesRead)
+	id := requestctx.MessageID(ctx)
+
+	// Queue for asynchronous delivery when enabled, otherwise dispatch inline
+	if s.queue != nil {
+		s.recordAccepted(ctx, parsedEmail, limitedReader.bytesRead, audit.StatusQueued)
+		queueID, err := s.queue.Enqueue(ctx, parsedEmail, providerName)
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to queue message", "error", err)
+			s.recordOutcome(ctx, audit.StatusFailed, err)
+			return "", &smtp.SMTPError{
+				Code:         452,
+				EnhancedCode: smtp.EnhancedCode{4, 3, 1},
+				Message:      "Insufficient system storage, try again later",
+			}
+		}
+		logger.InfoContext(ctx, "message queued for delivery", "subject", parsedEmail.Headers.Subject, "recipients", len(parsedEmail.Envelope.To))
+		id = queueID
+	} else if s.dispatcher != nil {
+		var cancel context.CancelFunc
+		if s.dispatchTimeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, s.dispatchTimeout)
+		} else {
+			ctx, cancel = context.WithCancel(ctx)
+		}
+		defer cancel()
+		// Nobody is left to read the reply once the client hangs up
+		if s.conn != nil {
+			defer watchDisconnect(s.conn, cancel)()
+		}
+		s.recordAccepted(ctx, parsedEmail, limitedReader.bytesRead, audit.StatusAccepted)
+		providerMessageID, err := s.dispatcher.Dispatch(ctx, parsedEmail, providerName)
 		if err != nil {
-			return err
+			s.recordOutcome(ctx, audit.StatusFailed, err)
+			return "", smtpError(err)
+		}
+		s.recordOutcome(ctx, audit.StatusDelivered, nil)
+		if providerMessageID != "" {
+			id = providerMessageID
 		}
 	}
 
-	// Reset session state after successful processing
-	s.Reset()
-	return nil
+	if s.reservation != nil {
+		s.reservation.Commit()
+	}
+
+	// Clear the envelope after successful processing. The transaction itself
+	// ends in Reset, which go-smtp calls once the reply has been written.
+	s.resetEnvelope()
+	return id, nil
+}
+
+// recordAccepted adds the message carried by ctx to the audit trail
+func (s *Session) recordAccepted(ctx context.Context, email *entity.Email, size int64, status audit.Status) {
+	if s.audit != nil {
+		s.audit.Accepted(ctx, email, size, status)
+		s.audit.Suppressed(ctx, s.suppressed)
+	}
+}
+
+// addSuppressed notes that address is on the suppression list
+func (s *Session) addSuppressed(address string) {
+	address = suppression.Normalize(address)
+	if !slices.Contains(s.suppressed, address) {
+		s.suppressed = append(s.suppressed, address)
+	}
+}
+
+// recordOutcome records the final status of the message carried by ctx
+func (s *Session) recordOutcome(ctx context.Context, status audit.Status, err error) {
+	if s.audit != nil {
+		s.audit.Complete(requestctx.MessageID(ctx), status, err)
+	}
+}
+
+// headerRecipients returns the number of distinct addresses in the To, Cc
+// and Bcc headers of email
+func headerRecipients(email *entity.Email) int {
+	seen := make(map[string]bool)
+	for _, list := range [][]*mail.Address{email.Headers.To, email.Headers.CC, email.Headers.BCC} {
+		for _, address := range list {
+			if address != nil && address.Address != "" {
+				seen[strings.ToLower(address.Address)] = true
+			}
+		}
+	}
+	return len(seen)
+}
+
+// requiresAuth reports whether the client must authenticate before sending.
+// Clients on trusted networks may relay without AUTH.
+func (s *Session) requiresAuth() bool {
+	if !s.authEnabled || s.trusted {
+		return false
+	}
+	return s.identity == nil || !s.identity.IsAuthenticated()
+}
+
+// context returns the session's context, carrying the authenticated user.
+// It is cancelled by Logout and when shutdown stops waiting for the session.
+// go-smtp calls Logout only after Data returns, so Data watches the
+// connection itself to cancel a dispatch when the client disconnects.
+func (s *Session) context() context.Context {
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if username := s.username(); username != "" {
+		ctx = requestctx.WithUser(ctx, username)
+	}
+	return ctx
 }
 
-// Reset resets the session state
+// username returns the authenticated user, or "" for anonymous sessions
+func (s *Session) username() string {
+	if s.identity == nil {
+		return ""
+	}
+	return s.identity.Username
+}
+
+// policy returns the effective policy for the session's user
+func (s *Session) policy() policy.Policy {
+	if s.policies == nil {
+		return policy.Policy{}
+	}
+	return s.policies.Lookup(s.username())
+}
+
+// route returns the provider for email: the one bound by the user's policy,
+// else the one chosen by the routing rules, else one picked by weight, else
+// "" for the default. Only the last two may fail over to another provider,
+// so only they come back with a ctx marked by provider.WithFailover.
+func (s *Session) route(ctx context.Context, email *entity.Email, pol policy.Policy, size int64) (context.Context, string) {
+	if pol.Provider != "" {
+		logger.DebugContext(ctx, "provider bound by policy", "provider", pol.Provider)
+		return ctx, pol.Provider
+	}
+	if s.router != nil {
+		if name := s.router.Route(ctx, routing.Message{User: s.username(), Email: email, Size: size}).Provider; name != "" {
+			return ctx, name
+		}
+	}
+	// Picking here rather than in the registry keeps every queued retry
+	// on the provider chosen for the first attempt
+	if s.dispatcher != nil {
+		return provider.WithFailover(ctx), s.dispatcher.Registry().Balance(email)
+	}
+	return provider.WithFailover(ctx), ""
+}
+
+// smtpError converts a dispatch failure into an SMTP reply with its own status code
+func smtpError(err error) error {
+	var dispatchErr *dispatcher.Error
+	if !errors.As(err, &dispatchErr) {
+		return err
+	}
+
+	enhancedCode := smtp.EnhancedCode(dispatchErr.EnhancedCode)
+	if enhancedCode == (smtp.EnhancedCode{}) {
+		enhancedCode = smtp.EnhancedCode{dispatchErr.Code / 100, 0, 0}
+	}
+
+	return &smtp.SMTPError{
+		Code:         dispatchErr.Code,
+		EnhancedCode: enhancedCode,
+		Message:      dispatchErr.Message,
+	}
+}
+
+// Reset resets the session state and ends the current transaction
 func (s *Session) Reset() {
+	s.resetEnvelope()
+	s.releaseQuota()
+
+	if s.inTransaction {
+		s.transactions.end(s)
+		s.inTransaction = false
+	}
+}
+
+// resetEnvelope clears the sender, recipients and their parameters
+func (s *Session) resetEnvelope() {
 	s.from = ""
 	s.to = nil
+	s.utf8 = false
+	s.dsnReturn = ""
+	s.envelopeID = ""
+	s.rcptParams = nil
+	s.suppressed = nil
+}
+
+// releaseQuota gives back the daily quota reserved in Mail unless the
+// message was accepted
+func (s *Session) releaseQuota() {
+	if s.reservation != nil {
+		s.reservation.Release()
+		s.reservation = nil
+	}
+}
+
+// reject ends a session refused before it was handed to go-smtp, which
+// therefore never calls Logout, and returns err
+func (s *Session) reject(err error) error {
+	s.cancel()
+	tracing.End(s.span, err)
+	return err
 }
 
 // Logout handles session cleanup
 func (s *Session) Logout() error {
+	// Logout may run concurrently with Data when the server force-closes
+	// connections, so only the synchronized tracker and the reservation,
+	// which Data only commits, are touched here
+	if s.transactions != nil {
+		s.transactions.end(s)
+	}
+	if s.reservation != nil {
+		s.reservation.Release()
+	}
+	if s.release != nil {
+		s.release()
+	}
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if s.span != nil {
+		s.span.End()
+	}
 	return nil
 }
 
@@ -151,10 +689,13 @@ type sizeLimitReader struct {
 	reader    io.Reader
 	maxSize   int64
 	bytesRead int64
+	// exceeded is set once the message is found to be over the limit
+	exceeded bool
 }
 
 func (r *sizeLimitReader) Read(p []byte) (n int, err error) {
 	if r.bytesRead >= r.maxSize {
+		r.exceeded = true
 		return 0, fmt.Errorf("message size exceeds maximum allowed size of %d bytes", r.maxSize)
 	}
 
@@ -169,6 +710,7 @@ func (r *sizeLimitReader) Read(p []byte) (n int, err error) {
 
 	// Check if we've exceeded the limit after reading
 	if r.bytesRead > r.maxSize {
+		r.exceeded = true
 		return n, fmt.Errorf("message size exceeds maximum allowed size of %d bytes", r.maxSize)
 	}
 
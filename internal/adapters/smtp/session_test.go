@@ -1,14 +1,48 @@
 package smtp
 
 import (
+	"context"
+	"errors"
 	"io"
+	"net"
+	"net/netip"
+	"path/filepath"
 	"strings"
 	"testing"
-
+	"time"
+
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+	"github.com/itsLeonB/smtproxy/internal/adapters/storage/bolt"
+	"github.com/itsLeonB/smtproxy/internal/core/metrics"
+	"github.com/itsLeonB/smtproxy/internal/core/requestctx"
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/audit"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/dispatcher"
 	"github.com/itsLeonB/smtproxy/internal/domain/service/parser"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/policy"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/provider"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/queue"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/routing"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/suppression"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
+// assertAccepted checks that err is the 250 reply to an accepted message and
+// returns the ID the reply names
+func assertAccepted(t *testing.T, err error) string {
+	t.Helper()
+	var reply *smtp.SMTPError
+	if !assert.ErrorAs(t, err, &reply) {
+		return ""
+	}
+	assert.Equal(t, 250, reply.Code)
+	id, found := strings.CutPrefix(reply.Message, "OK queued as ")
+	assert.True(t, found, "unexpected reply %q", reply.Message)
+	return id
+}
+
 func TestSession_AuthPlain_Success(t *testing.T) {
 	users := map[string]string{"testuser": "testpass"}
 	authHandler := NewAuthHandler(users)
@@ -93,7 +127,7 @@ func TestSession_Data_WithAuth(t *testing.T) {
 	
 	message := strings.NewReader("Subject: Test\n\nHello World")
 	err := session.Data(message)
-	assert.NoError(t, err)
+	assertAccepted(t, err)
 }
 
 func TestSession_Data_NoAuth(t *testing.T) {
@@ -158,7 +192,7 @@ Subject: Test Email
 Hello World!`
 	
 	err := session.Data(strings.NewReader(rawEmail))
-	assert.NoError(t, err)
+	assertAccepted(t, err)
 }
 
 func TestSession_GetParsedEmail(t *testing.T) {
@@ -246,7 +280,7 @@ Hello World!`
 	err := session.Data(strings.NewReader(rawEmail))
 
 	// Verify success and state reset
-	assert.NoError(t, err)
+	assertAccepted(t, err)
 	assert.Empty(t, session.from)
 	assert.Nil(t, session.to)
 }
@@ -276,8 +310,7 @@ Subject: Large Message Test
 
 	err := session.Data(strings.NewReader(largeMessage))
 	
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "message size exceeds maximum allowed size of 50 bytes")
+	assert.ErrorIs(t, err, smtp.ErrDataTooLarge)
 }
 
 func TestSession_Data_MessageSizeWithinLimit(t *testing.T) {
@@ -297,7 +330,7 @@ Hello World!`
 
 	err := session.Data(strings.NewReader(smallMessage))
 	
-	assert.NoError(t, err)
+	assertAccepted(t, err)
 }
 
 func TestSizeLimitReader(t *testing.T) {
@@ -323,3 +356,655 @@ func TestSizeLimitReader(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "message size exceeds maximum allowed size of 10 bytes")
 }
+
+func TestSession_Data_Queued(t *testing.T) {
+	q := queue.New(queue.Config{}, nil)
+	session := &Session{
+		from:           "sender@example.com",
+		to:             []string{"recipient@example.com"},
+		maxMessageSize: 1024,
+		authEnabled:    false,
+		parser:         parser.New(1024),
+		queue:          q,
+	}
+
+	err := session.Data(strings.NewReader("Subject: Test\n\nHello World"))
+
+	id := assertAccepted(t, err)
+	assert.Equal(t, 1, q.Len())
+	_, err = q.Get(id)
+	assert.NoError(t, err)
+}
+
+func TestSession_Data_QueuedBalancedOnce(t *testing.T) {
+	registry := provider.NewRegistry()
+	_ = registry.Register(provider.NewMockProvider("brevo"))
+	_ = registry.Register(provider.NewMockProvider("ses"))
+	assert.NoError(t, registry.SetWeights(map[string]int{"ses": 1}, false))
+	q := queue.New(queue.Config{}, nil)
+	session := &Session{
+		from:           "sender@example.com",
+		to:             []string{"recipient@example.com"},
+		maxMessageSize: 1024,
+		parser:         parser.New(1024),
+		dispatcher:     dispatcher.NewDispatcher(registry),
+		queue:          q,
+	}
+
+	id := assertAccepted(t, session.Data(strings.NewReader("Subject: Test\n\nHello World")))
+
+	// The queue retries through the provider picked when the message was accepted
+	msg, err := q.Get(id)
+	assert.NoError(t, err)
+	assert.Equal(t, "ses", msg.Provider)
+}
+
+func TestSession_Data_RepliesWithProviderMessageID(t *testing.T) {
+	registry := provider.NewRegistry()
+	mock := provider.NewMockProvider("mock")
+	mock.SetMessageID("<201798300811.5787683@smtp-relay.mailin.fr>")
+	_ = registry.Register(mock)
+	session := &Session{
+		from:           "sender@example.com",
+		to:             []string{"recipient@example.com"},
+		maxMessageSize: 1024,
+		parser:         parser.New(1024),
+		dispatcher:     dispatcher.NewDispatcher(registry),
+	}
+
+	err := session.Data(strings.NewReader("Subject: Test\n\nHello World"))
+
+	assert.Equal(t, "<201798300811.5787683@smtp-relay.mailin.fr>", assertAccepted(t, err))
+}
+
+func TestSession_MailAndRcpt_DSNParameters(t *testing.T) {
+	session := &Session{authEnabled: false}
+
+	err := session.Mail("sender@example.com", &smtp.MailOptions{Return: smtp.DSNReturnFull, EnvelopeID: "QQ314159"})
+	assert.NoError(t, err)
+
+	err = session.Rcpt("user@example.com", &smtp.RcptOptions{
+		Notify:                []smtp.DSNNotify{smtp.DSNNotifySuccess, smtp.DSNNotifyFailure},
+		OriginalRecipientType: smtp.DSNAddressTypeRFC822,
+		OriginalRecipient:     "alias@example.com",
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "FULL", session.dsnReturn)
+	assert.Equal(t, "QQ314159", session.envelopeID)
+	assert.Equal(t, []string{"SUCCESS", "FAILURE"}, session.rcptParams["user@example.com"].Notify)
+	assert.Equal(t, "rfc822;alias@example.com", session.rcptParams["user@example.com"].OriginalRecipient)
+
+	session.Reset()
+	assert.Empty(t, session.dsnReturn)
+	assert.Nil(t, session.rcptParams)
+}
+
+func TestSession_Data_QueuedKeepsRawForFullReturn(t *testing.T) {
+	q := queue.New(queue.Config{}, nil)
+	session := &Session{
+		from:           "sender@example.com",
+		to:             []string{"recipient@example.com"},
+		dsnReturn:      "FULL",
+		maxMessageSize: 1024,
+		parser:         parser.New(1024),
+		queue:          q,
+	}
+
+	err := session.Data(strings.NewReader("Subject: Test\n\nHello World"))
+
+	assertAccepted(t, err)
+	assert.Equal(t, 1, q.Len())
+}
+
+func TestSession_Mail_UTF8RequiresSMTPUTF8(t *testing.T) {
+	session := &Session{authEnabled: false}
+
+	err := session.Mail("jöhn@exämple.com", &smtp.MailOptions{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "SMTPUTF8")
+
+	err = session.Mail("jöhn@exämple.com", &smtp.MailOptions{UTF8: true})
+	assert.NoError(t, err)
+	assert.True(t, session.utf8)
+
+	err = session.Rcpt("用户@例子.广告", nil)
+	assert.NoError(t, err)
+}
+
+func TestSession_Rcpt_UTF8RequiresSMTPUTF8(t *testing.T) {
+	session := &Session{authEnabled: false}
+
+	err := session.Mail("sender@example.com", nil)
+	assert.NoError(t, err)
+
+	err = session.Rcpt("用户@例子.广告", nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "SMTPUTF8")
+}
+
+func TestSmtpError(t *testing.T) {
+	err := smtpError(&dispatcher.Error{Code: 451, Message: "Rate limit exceeded, try again later"})
+
+	var smtpErr *smtp.SMTPError
+	assert.ErrorAs(t, err, &smtpErr)
+	assert.Equal(t, 451, smtpErr.Code)
+	assert.Equal(t, smtp.EnhancedCode{4, 0, 0}, smtpErr.EnhancedCode)
+
+	err = smtpError(&dispatcher.Error{Code: 553, EnhancedCode: [3]int{5, 6, 7}, Message: "no EAI"})
+	assert.ErrorAs(t, err, &smtpErr)
+	assert.Equal(t, smtp.EnhancedCode{5, 6, 7}, smtpErr.EnhancedCode)
+}
+
+func TestSession_AuthMechanisms(t *testing.T) {
+	session := &Session{}
+
+	assert.Equal(t, []string{sasl.Plain, sasl.Login}, session.AuthMechanisms())
+
+	_, err := session.Auth("CRAM-MD5")
+	assert.ErrorIs(t, err, smtp.ErrAuthUnknownMechanism)
+}
+
+func TestSession_Auth_Plain(t *testing.T) {
+	session := &Session{
+		authHandler: NewAuthHandler(map[string]string{"testuser": "testpass"}),
+		authEnabled: true,
+	}
+
+	server, err := session.Auth(sasl.Plain)
+	assert.NoError(t, err)
+
+	_, done, err := server.Next([]byte("\x00testuser\x00wrongpass"))
+	assert.True(t, done)
+	assert.ErrorIs(t, err, smtp.ErrAuthFailed)
+	assert.Nil(t, session.identity)
+
+	server, _ = session.Auth(sasl.Plain)
+	_, done, err = server.Next([]byte("\x00testuser\x00testpass"))
+	assert.True(t, done)
+	assert.NoError(t, err)
+	assert.Equal(t, "testuser", session.identity.Username)
+}
+
+func TestSession_Auth_Login(t *testing.T) {
+	session := &Session{
+		authHandler: NewAuthHandler(map[string]string{"testuser": "testpass"}),
+		authEnabled: true,
+	}
+
+	server, err := session.Auth(sasl.Login)
+	assert.NoError(t, err)
+
+	_, _, _ = server.Next(nil)
+	_, _, _ = server.Next([]byte("testuser"))
+	_, done, err := server.Next([]byte("testpass"))
+	assert.True(t, done)
+	assert.NoError(t, err)
+	assert.Equal(t, "testuser", session.identity.Username)
+}
+
+func newPolicySession(p policy.Policy) *Session {
+	return &Session{
+		authEnabled:    true,
+		identity:       NewClientIdentity("app-a"),
+		maxMessageSize: 1024,
+		parser:         parser.New(1024),
+		policies:       policy.NewManager(map[string]policy.Policy{"app-a": p}, policy.Policy{}),
+	}
+}
+
+func TestSession_Policy_AllowedSenders(t *testing.T) {
+	session := newPolicySession(policy.Policy{AllowedSenders: []string{"app-a.example.com"}})
+
+	err := session.Mail("noreply@app-b.example.com", nil)
+	assert.ErrorIs(t, err, errSenderNotAllowed)
+
+	err = session.Mail("noreply@app-a.example.com", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, session.Rcpt("user@example.com", nil))
+
+	// A spoofed header From is rejected even with an allowed envelope sender
+	err = session.Data(strings.NewReader("From: ceo@app-b.example.com\nSubject: Test\n\nHello"))
+	assert.ErrorIs(t, err, errSenderNotAllowed)
+}
+
+func TestSession_Policy_ProviderDoesNotFailOver(t *testing.T) {
+	registry := provider.NewRegistry()
+	ses := provider.NewMockProvider("ses")
+	_ = registry.Register(provider.NewMockProvider("brevo"))
+	_ = registry.Register(ses)
+	registry.SetBreaker(provider.BreakerConfig{Threshold: 1, Cooldown: time.Minute, Probes: 1, Failover: true})
+	ses.SetSendError(&net.OpError{Op: "dial", Err: errors.New("connection refused")})
+	session := newPolicySession(policy.Policy{Provider: "ses"})
+	session.dispatcher = dispatcher.NewDispatcher(registry)
+
+	assert.NoError(t, session.Mail("sender@example.com", nil))
+	assert.NoError(t, session.Rcpt("user@example.com", nil))
+	assert.Error(t, session.Data(strings.NewReader("Subject: Test\n\nHello")))
+
+	// The bound provider's circuit is open, but the message must not go out through brevo
+	assert.NoError(t, session.Mail("sender@example.com", nil))
+	assert.NoError(t, session.Rcpt("user@example.com", nil))
+	err := session.Data(strings.NewReader("Subject: Test\n\nHello"))
+	var smtpErr *smtp.SMTPError
+	if assert.ErrorAs(t, err, &smtpErr) {
+		assert.Equal(t, 451, smtpErr.Code)
+		assert.Equal(t, smtp.EnhancedCode{4, 4, 1}, smtpErr.EnhancedCode)
+	}
+	assert.Zero(t, registry.Stats("brevo").Sent)
+}
+
+func TestSession_Policy_MaxRecipients(t *testing.T) {
+	session := newPolicySession(policy.Policy{MaxRecipients: 1})
+
+	assert.NoError(t, session.Mail("sender@example.com", nil))
+	assert.NoError(t, session.Rcpt("one@example.com", nil))
+
+	err := session.Rcpt("two@example.com", nil)
+	assert.ErrorIs(t, err, errTooManyRecipients)
+}
+
+func TestSession_Policy_MaxRecipientsInHeaders(t *testing.T) {
+	session := newPolicySession(policy.Policy{MaxRecipients: 2})
+
+	assert.NoError(t, session.Mail("sender@example.com", nil))
+	assert.NoError(t, session.Rcpt("one@example.com", nil))
+
+	// Providers deliver to every header recipient, not only the one given at RCPT TO
+	err := session.Data(strings.NewReader("To: one@example.com, two@example.com\nCc: three@example.com\nSubject: Test\n\nHello"))
+	assert.ErrorIs(t, err, errTooManyHeaderRecipients)
+
+	assert.NoError(t, session.Mail("sender@example.com", nil))
+	assert.NoError(t, session.Rcpt("one@example.com", nil))
+	assertAccepted(t, session.Data(strings.NewReader("To: one@example.com\nCc: One@example.com, two@example.com\nSubject: Test\n\nHello")))
+}
+
+func TestSession_Policy_MaxMessageSize(t *testing.T) {
+	session := newPolicySession(policy.Policy{MaxMessageSize: 20})
+
+	err := session.Mail("sender@example.com", &smtp.MailOptions{Size: 100})
+	assert.ErrorIs(t, err, errMessageTooLarge)
+
+	assert.NoError(t, session.Mail("sender@example.com", nil))
+	assert.NoError(t, session.Rcpt("user@example.com", nil))
+
+	err = session.Data(strings.NewReader("Subject: Test\n\n" + strings.Repeat("x", 100)))
+	assert.ErrorIs(t, err, errMessageTooLarge)
+}
+
+func TestSession_Policy_DailyQuota(t *testing.T) {
+	session := newPolicySession(policy.Policy{DailyQuota: 1})
+
+	assert.NoError(t, session.Mail("sender@example.com", nil))
+	assert.NoError(t, session.Rcpt("user@example.com", nil))
+	assertAccepted(t, session.Data(strings.NewReader("Subject: Test\n\nHello")))
+
+	err := session.Mail("sender@example.com", nil)
+	assert.ErrorIs(t, err, errQuotaExceeded)
+}
+
+func TestSession_Policy_DailyQuotaReserved(t *testing.T) {
+	first := newPolicySession(policy.Policy{DailyQuota: 1, AllowedSenders: []string{"example.com"}})
+	second := newPolicySession(policy.Policy{})
+	second.policies = first.policies
+
+	// The first session holds the only message left until its transaction ends
+	assert.NoError(t, first.Mail("sender@example.com", nil))
+	assert.ErrorIs(t, second.Mail("sender@example.com", nil), errQuotaExceeded)
+
+	// A message that is not accepted gives its place back
+	assert.NoError(t, first.Rcpt("user@example.com", nil))
+	assert.ErrorIs(t, first.Data(strings.NewReader("From: ceo@example.org\nSubject: Test\n\nHello")), errSenderNotAllowed)
+	first.Reset()
+	assert.NoError(t, second.Mail("sender@example.com", nil))
+
+	// So does a client that disconnects before sending one
+	assert.NoError(t, second.Logout())
+	assert.NoError(t, first.Mail("sender@example.com", nil))
+}
+
+func TestSession_Policy_ForcedProvider(t *testing.T) {
+	registry := provider.NewRegistry()
+	_ = registry.Register(provider.NewMockProvider("default"))
+	forced := provider.NewMockProvider("forced")
+	forced.SetSendError(errors.New("invalid email address"))
+	_ = registry.Register(forced)
+
+	session := newPolicySession(policy.Policy{Provider: "forced"})
+	session.dispatcher = dispatcher.NewDispatcher(registry)
+
+	assert.NoError(t, session.Mail("sender@example.com", nil))
+	assert.NoError(t, session.Rcpt("user@example.com", nil))
+
+	// The forced provider's failure proves the message bypassed the default
+	err := session.Data(strings.NewReader("Subject: Test\n\nHello"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid recipient address")
+}
+
+func TestSession_Routing(t *testing.T) {
+	registry := provider.NewRegistry()
+	_ = registry.Register(provider.NewMockProvider("default"))
+	routed := provider.NewMockProvider("routed")
+	routed.SetSendError(errors.New("invalid email address"))
+	_ = registry.Register(routed)
+	router, err := routing.NewRouter([]routing.Rule{
+		{Name: "gmail", Provider: "routed", Match: routing.Match{RecipientDomains: []string{"gmail.com"}}},
+	})
+	assert.NoError(t, err)
+
+	session := newPolicySession(policy.Policy{})
+	session.dispatcher = dispatcher.NewDispatcher(registry)
+	session.router = router
+
+	assert.NoError(t, session.Mail("sender@example.com", nil))
+	assert.NoError(t, session.Rcpt("user@example.com", nil))
+	assertAccepted(t, session.Data(strings.NewReader("Subject: Test\n\nHello")))
+
+	// The routed provider's failure proves the rule matched
+	assert.NoError(t, session.Mail("sender@example.com", nil))
+	assert.NoError(t, session.Rcpt("user@gmail.com", nil))
+	err = session.Data(strings.NewReader("Subject: Test\n\nHello"))
+	assert.ErrorContains(t, err, "Invalid recipient address")
+}
+
+func TestSession_Routing_PolicyTakesPrecedence(t *testing.T) {
+	registry := provider.NewRegistry()
+	_ = registry.Register(provider.NewMockProvider("forced"))
+	routed := provider.NewMockProvider("routed")
+	routed.SetSendError(errors.New("invalid email address"))
+	_ = registry.Register(routed)
+	router, err := routing.NewRouter([]routing.Rule{{Provider: "routed"}})
+	assert.NoError(t, err)
+
+	session := newPolicySession(policy.Policy{Provider: "forced"})
+	session.dispatcher = dispatcher.NewDispatcher(registry)
+	session.router = router
+
+	assert.NoError(t, session.Mail("sender@example.com", nil))
+	assert.NoError(t, session.Rcpt("user@example.com", nil))
+	assertAccepted(t, session.Data(strings.NewReader("Subject: Test\n\nHello")))
+}
+
+func TestSession_Trusted_SkipsAuth(t *testing.T) {
+	session := &Session{authEnabled: true, trusted: true, maxMessageSize: 1024, parser: parser.New(1024)}
+
+	assert.NoError(t, session.Mail("sender@example.com", nil))
+	assert.NoError(t, session.Rcpt("user@example.com", nil))
+	assertAccepted(t, session.Data(strings.NewReader("Subject: Test\n\nHello")))
+}
+
+func TestSession_Mail_RateLimited(t *testing.T) {
+	session := &Session{
+		authEnabled: true,
+		identity:    NewClientIdentity("app"),
+		limiter:     NewRateLimiter(Limits{UserMessagesPerMinute: 1}),
+	}
+
+	assert.NoError(t, session.Mail("sender@example.com", nil))
+	session.Reset()
+
+	err := session.Mail("sender@example.com", nil)
+	assert.ErrorIs(t, err, errRateLimited)
+}
+
+func TestSession_Auth_LockedOut(t *testing.T) {
+	limiter := NewRateLimiter(Limits{AuthMaxFailures: 1, AuthLockout: time.Minute})
+	session := &Session{
+		authEnabled: true,
+		authHandler: NewAuthHandler(map[string]string{"user": "pass"}),
+		remoteIP:    netip.MustParseAddr("192.0.2.1"),
+		limiter:     limiter,
+	}
+
+	server, err := session.Auth(sasl.Plain)
+	assert.NoError(t, err)
+	_, _, err = server.Next([]byte("\x00user\x00wrong"))
+	assert.ErrorIs(t, err, smtp.ErrAuthFailed)
+
+	_, err = session.Auth(sasl.Plain)
+	assert.ErrorIs(t, err, errAuthLocked)
+}
+
+// contextProvider records the context of each send and blocks until it is done
+// when block is set
+type contextProvider struct {
+	contexts chan context.Context
+	block    bool
+}
+
+func (p *contextProvider) Name() string { return "context" }
+
+func (p *contextProvider) Send(ctx context.Context, email *entity.Email) (string, error) {
+	p.contexts <- ctx
+	if p.block {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	return "", nil
+}
+
+func (p *contextProvider) IsHealthy(ctx context.Context) error { return nil }
+
+func newContextBackend(t *testing.T, block bool) (*Backend, *contextProvider) {
+	t.Helper()
+
+	recorder := &contextProvider{contexts: make(chan context.Context, 1), block: block}
+	registry := provider.NewRegistry()
+	assert.NoError(t, registry.Register(recorder))
+	return NewBackend(1024, nil, false, registry), recorder
+}
+
+func TestSession_Data_CarriesRequestIDs(t *testing.T) {
+	backend, recorder := newContextBackend(t, false)
+	session := backend.newSession()
+
+	assert.NoError(t, session.Mail("sender@example.com", nil))
+	assert.NoError(t, session.Rcpt("user@example.com", nil))
+	assertAccepted(t, session.Data(strings.NewReader("Subject: Test\n\nHello")))
+
+	ctx := <-recorder.contexts
+	assert.Equal(t, session.id, requestctx.SessionID(ctx))
+	assert.NotEmpty(t, requestctx.MessageID(ctx))
+}
+
+func TestSession_Data_DispatchTimeout(t *testing.T) {
+	backend, _ := newContextBackend(t, true)
+	backend.SetDispatchTimeout(20 * time.Millisecond)
+	session := backend.newSession()
+
+	assert.NoError(t, session.Mail("sender@example.com", nil))
+	assert.NoError(t, session.Rcpt("user@example.com", nil))
+
+	err := session.Data(strings.NewReader("Subject: Test\n\nHello"))
+	var smtpErr *smtp.SMTPError
+	assert.ErrorAs(t, err, &smtpErr)
+	assert.Equal(t, 451, smtpErr.Code)
+}
+
+func TestSession_Logout_CancelsDispatch(t *testing.T) {
+	backend, recorder := newContextBackend(t, true)
+	session := backend.newSession()
+
+	assert.NoError(t, session.Mail("sender@example.com", nil))
+	assert.NoError(t, session.Rcpt("user@example.com", nil))
+
+	result := make(chan error, 1)
+	go func() {
+		result <- session.Data(strings.NewReader("Subject: Test\n\nHello"))
+	}()
+	<-recorder.contexts
+
+	// Ending the session, as a forced close at shutdown does, cancels the provider call
+	assert.NoError(t, session.Logout())
+	assert.Error(t, <-result)
+}
+
+func TestBackend_Cancel_CancelsSessions(t *testing.T) {
+	backend, _ := newContextBackend(t, false)
+	session := backend.newSession()
+
+	backend.cancel()
+	assert.ErrorIs(t, session.context().Err(), context.Canceled)
+}
+
+func newAuditTrail(t *testing.T) *audit.Trail {
+	t.Helper()
+	store, err := bolt.Open(filepath.Join(t.TempDir(), "audit.db"))
+	assert.NoError(t, err)
+	trail := audit.NewTrail(store, 0)
+	t.Cleanup(trail.Stop)
+	return trail
+}
+
+func TestSession_Data_RecordsAudit(t *testing.T) {
+	backend, _ := newContextBackend(t, false)
+	trail := newAuditTrail(t)
+	backend.SetAudit(trail)
+	session := backend.newSession()
+
+	assert.NoError(t, session.Mail("sender@example.com", nil))
+	assert.NoError(t, session.Rcpt("user@example.com", nil))
+	assertAccepted(t, session.Data(strings.NewReader("Subject: Test\n\nHello")))
+
+	records, err := trail.Search(audit.Query{Recipient: "user@example.com"})
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, session.id, records[0].SessionID)
+	assert.Equal(t, "sender@example.com", records[0].From)
+	assert.Equal(t, "Test", records[0].Subject)
+	assert.Equal(t, audit.StatusDelivered, records[0].Status)
+	assert.Len(t, records[0].Attempts, 1)
+	assert.Equal(t, "context", records[0].Attempts[0].Provider)
+}
+
+func TestSession_Data_RecordsAuditFailure(t *testing.T) {
+	backend, _ := newContextBackend(t, true)
+	backend.SetDispatchTimeout(20 * time.Millisecond)
+	trail := newAuditTrail(t)
+	backend.SetAudit(trail)
+	session := backend.newSession()
+
+	assert.NoError(t, session.Mail("sender@example.com", nil))
+	assert.NoError(t, session.Rcpt("user@example.com", nil))
+	assert.Error(t, session.Data(strings.NewReader("Subject: Test\n\nHello")))
+
+	records, err := trail.Search(audit.Query{})
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, audit.StatusFailed, records[0].Status)
+	assert.NotEmpty(t, records[0].Error)
+	assert.Len(t, records[0].Attempts, 1)
+	assert.NotEmpty(t, records[0].Attempts[0].Error)
+}
+
+// newSuppressionBackend returns a backend that applies mode to a suppression
+// list holding addresses, and the audit trail it records to
+func newSuppressionBackend(t *testing.T, mode suppression.Mode, addresses ...string) (*Backend, *contextProvider, *audit.Trail) {
+	t.Helper()
+	store, err := bolt.OpenSuppressions(filepath.Join(t.TempDir(), "suppressions.db"))
+	assert.NoError(t, err)
+	list := suppression.NewList(store, mode)
+	t.Cleanup(func() { _ = list.Close() })
+	for _, address := range addresses {
+		_, err := list.Add(suppression.Entry{Address: address})
+		assert.NoError(t, err)
+	}
+
+	backend, recorder := newContextBackend(t, false)
+	trail := newAuditTrail(t)
+	backend.SetAudit(trail)
+	backend.SetSuppressions(list)
+	return backend, recorder, trail
+}
+
+func TestSession_Rcpt_SuppressedRejected(t *testing.T) {
+	backend, _, _ := newSuppressionBackend(t, suppression.ModeReject, "bounced@example.com")
+	session := backend.newSession()
+	rejected := testutil.ToFloat64(metrics.SuppressedRecipients.WithLabelValues("rejected"))
+
+	assert.NoError(t, session.Mail("sender@example.com", nil))
+	assert.Equal(t, errRecipientSuppressed, session.Rcpt("<Bounced@Example.com>", nil))
+	assert.NoError(t, session.Rcpt("user@example.com", nil))
+
+	assert.Equal(t, []string{"user@example.com"}, session.to)
+	assert.Equal(t, rejected+1, testutil.ToFloat64(metrics.SuppressedRecipients.WithLabelValues("rejected")))
+}
+
+func TestSession_Data_SuppressedCCRejected(t *testing.T) {
+	backend, _, trail := newSuppressionBackend(t, suppression.ModeReject, "bounced@example.com")
+	session := backend.newSession()
+	rejected := testutil.ToFloat64(metrics.SuppressedRecipients.WithLabelValues("rejected"))
+
+	assert.NoError(t, session.Mail("sender@example.com", nil))
+	assert.Equal(t, errRecipientSuppressed, session.Rcpt("bounced@example.com", nil))
+	assert.NoError(t, session.Rcpt("user@example.com", nil))
+
+	// The provider would deliver to the Cc header, so the message is refused
+	err := session.Data(strings.NewReader("To: user@example.com\nCc: Bounced@example.com\nSubject: Test\n\nHello"))
+	assert.Equal(t, errMessageSuppressed, err)
+
+	records, err := trail.Search(audit.Query{})
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+	assert.Equal(t, rejected+2, testutil.ToFloat64(metrics.SuppressedRecipients.WithLabelValues("rejected")))
+}
+
+func TestSession_Data_SuppressedDropped(t *testing.T) {
+	backend, recorder, trail := newSuppressionBackend(t, suppression.ModeDrop, "bounced@example.com")
+	session := backend.newSession()
+
+	assert.NoError(t, session.Mail("sender@example.com", nil))
+	assert.NoError(t, session.Rcpt("bounced@example.com", nil))
+	assert.NoError(t, session.Rcpt("user@example.com", nil))
+	assertAccepted(t, session.Data(strings.NewReader("To: bounced@example.com, user@example.com\nSubject: Test\n\nHello")))
+	<-recorder.contexts
+
+	records, err := trail.Search(audit.Query{})
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, []string{"user@example.com"}, records[0].To)
+		assert.Equal(t, []string{"bounced@example.com"}, records[0].Suppressed)
+		assert.Equal(t, audit.StatusDelivered, records[0].Status)
+	}
+}
+
+func TestSession_Data_AllRecipientsSuppressed(t *testing.T) {
+	backend, recorder, trail := newSuppressionBackend(t, suppression.ModeDrop, "bounced@example.com")
+	session := backend.newSession()
+	dropped := testutil.ToFloat64(metrics.SuppressedRecipients.WithLabelValues("dropped"))
+
+	assert.NoError(t, session.Mail("sender@example.com", nil))
+	assert.NoError(t, session.Rcpt("bounced@example.com", nil))
+	id := assertAccepted(t, session.Data(strings.NewReader("To: bounced@example.com\nSubject: Test\n\nHello")))
+
+	assert.Empty(t, recorder.contexts)
+	records, err := trail.Search(audit.Query{ID: id})
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, audit.StatusSuppressed, records[0].Status)
+		assert.Equal(t, []string{"bounced@example.com"}, records[0].Suppressed)
+		assert.Empty(t, records[0].Attempts)
+	}
+	assert.Equal(t, dropped+1, testutil.ToFloat64(metrics.SuppressedRecipients.WithLabelValues("dropped")))
+}
+
+func TestSession_Data_SuppressedTagged(t *testing.T) {
+	backend, recorder, trail := newSuppressionBackend(t, suppression.ModeTag, "bounced@example.com")
+	session := backend.newSession()
+	tagged := testutil.ToFloat64(metrics.SuppressedRecipients.WithLabelValues("tagged"))
+
+	assert.NoError(t, session.Mail("sender@example.com", nil))
+	assert.NoError(t, session.Rcpt("bounced@example.com", nil))
+	assertAccepted(t, session.Data(strings.NewReader("To: bounced@example.com\nSubject: Test\n\nHello")))
+	<-recorder.contexts
+
+	records, err := trail.Search(audit.Query{})
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, []string{"bounced@example.com"}, records[0].To)
+		assert.Equal(t, []string{"bounced@example.com"}, records[0].Suppressed)
+		assert.Equal(t, audit.StatusDelivered, records[0].Status)
+	}
+	assert.Equal(t, tagged+1, testutil.ToFloat64(metrics.SuppressedRecipients.WithLabelValues("tagged")))
+}
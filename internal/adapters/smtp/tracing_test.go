@@ -0,0 +1,95 @@
+package smtp
+
+import (
+	"context"
+	netsmtp "net/smtp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		_ = provider.Shutdown(context.Background())
+	})
+	return exporter
+}
+
+// spansByName indexes ended spans by name, keeping the last of each
+func spansByName(exporter *tracetest.InMemoryExporter) map[string]tracetest.SpanStub {
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	return spans
+}
+
+func TestTracing_SessionSpans(t *testing.T) {
+	exporter := recordSpans(t)
+	backend, recorder := newContextBackend(t, false)
+
+	client, err := netsmtp.Dial(serveBackend(t, backend))
+	assert.NoError(t, err)
+	assert.NoError(t, client.Mail("sender@example.com"))
+	assert.NoError(t, client.Rcpt("user@example.com"))
+	w, err := client.Data()
+	assert.NoError(t, err)
+	_, err = w.Write([]byte("Subject: Test\r\n\r\nHello\r\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.NoError(t, client.Quit())
+
+	// The provider runs inside the dispatch span
+	dispatchCtx := <-recorder.contexts
+
+	assert.Eventually(t, func() bool {
+		_, ended := spansByName(exporter)["smtp.session"]
+		return ended
+	}, time.Second, 10*time.Millisecond)
+
+	spans := spansByName(exporter)
+	session := spans["smtp.session"]
+	data := spans["smtp.data"]
+	parse := spans["parser.parse"]
+	dispatch := spans["dispatcher.dispatch"]
+
+	assert.Equal(t, trace.SpanKindServer, session.SpanKind)
+	assert.Equal(t, session.SpanContext.SpanID(), data.Parent.SpanID())
+	assert.Equal(t, data.SpanContext.SpanID(), parse.Parent.SpanID())
+	assert.Equal(t, data.SpanContext.SpanID(), dispatch.Parent.SpanID())
+	assert.Equal(t, dispatch.SpanContext.SpanID(), trace.SpanContextFromContext(dispatchCtx).SpanID())
+	for _, span := range []tracetest.SpanStub{data, parse, dispatch} {
+		assert.Equal(t, session.SpanContext.TraceID(), span.SpanContext.TraceID())
+	}
+}
+
+func TestTracing_RejectedSessionEndsSpan(t *testing.T) {
+	exporter := recordSpans(t)
+	backend := NewBackend(1024, nil, false, nil)
+	access, err := NewAccessList(nil, []string{"127.0.0.0/8"}, nil)
+	assert.NoError(t, err)
+	backend.SetAccessList(access)
+
+	client, err := netsmtp.Dial(serveBackend(t, backend))
+	assert.NoError(t, err)
+	defer func() {
+		_ = client.Close()
+	}()
+	assert.Error(t, client.Hello("localhost"))
+
+	assert.Eventually(t, func() bool {
+		_, ended := spansByName(exporter)["smtp.session"]
+		return ended
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,235 @@
+package bolt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/domain/service/audit"
+	bbolt "go.etcd.io/bbolt"
+)
+
+var (
+	// recordsBucket maps message IDs to JSON audit records
+	recordsBucket = []byte("records")
+	// receivedBucket indexes message IDs by receipt time for range scans and pruning
+	receivedBucket = []byte("received")
+	// providerBucket maps the IDs providers assigned to messages to message IDs
+	providerBucket = []byte("provider_ids")
+)
+
+// Store is an audit.Store backed by an embedded bbolt database
+type Store struct {
+	db *bbolt.DB
+}
+
+// Open opens or creates the database at path
+func Open(path string) (*Store, error) {
+	db, err := openDB(path, "audit", recordsBucket, receivedBucket, providerBucket)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// openDB opens or creates the kind of database at path with its buckets
+func openDB(path, kind string, buckets ...[]byte) (*bbolt.DB, error) {
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s database %s: %w", kind, path, err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range buckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialize %s database %s: %w", kind, path, err)
+	}
+	return db, nil
+}
+
+// Put stores a new record
+func (s *Store) Put(r *audit.Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		if err := tx.Bucket(recordsBucket).Put([]byte(r.ID), data); err != nil {
+			return err
+		}
+		if err := tx.Bucket(receivedBucket).Put(receivedKey(r.ReceivedAt, r.ID), []byte(r.ID)); err != nil {
+			return err
+		}
+		return indexProviderIDs(tx, r)
+	})
+}
+
+// Update applies fn to the stored record with the given ID
+func (s *Store) Update(id string, fn func(r *audit.Record)) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		records := tx.Bucket(recordsBucket)
+		r, err := decode(records.Get([]byte(id)))
+		if err != nil {
+			return err
+		}
+
+		fn(r)
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		if err := records.Put([]byte(id), data); err != nil {
+			return err
+		}
+		return indexProviderIDs(tx, r)
+	})
+}
+
+// Search returns the records matching q, newest first
+func (s *Store) Search(q audit.Query) ([]*audit.Record, error) {
+	var results []*audit.Record
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		records := tx.Bucket(recordsBucket)
+
+		if q.ID == "" && q.ProviderMessageID != "" {
+			id := tx.Bucket(providerBucket).Get([]byte(q.ProviderMessageID))
+			if id == nil {
+				return nil
+			}
+			q.ID = string(id)
+		}
+
+		if q.ID != "" {
+			r, err := decode(records.Get([]byte(q.ID)))
+			if errors.Is(err, audit.ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if q.Matches(r) {
+				results = append(results, r)
+			}
+			return nil
+		}
+
+		c := tx.Bucket(receivedBucket).Cursor()
+		var k, v []byte
+		if q.Until.IsZero() {
+			k, v = c.Last()
+		} else if k, v = c.Seek(receivedKey(q.Until.Add(time.Nanosecond), "")); k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+
+		for ; k != nil; k, v = c.Prev() {
+			if !q.Since.IsZero() && receivedTime(k).Before(q.Since) {
+				break
+			}
+			r, err := decode(records.Get(v))
+			if errors.Is(err, audit.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if !q.Matches(r) {
+				continue
+			}
+			results = append(results, r)
+			if q.Limit > 0 && len(results) >= q.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return results, err
+}
+
+// Prune deletes records received before cutoff
+func (s *Store) Prune(cutoff time.Time) (int, error) {
+	removed := 0
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		records := tx.Bucket(recordsBucket)
+		received := tx.Bucket(receivedBucket)
+		providerIDs := tx.Bucket(providerBucket)
+
+		// Collect keys first: deleting during iteration skips entries
+		var keys, ids [][]byte
+		end := receivedKey(cutoff, "")
+		c := received.Cursor()
+		for k, v := c.First(); k != nil && bytes.Compare(k, end) < 0; k, v = c.Next() {
+			keys = append(keys, bytes.Clone(k))
+			ids = append(ids, bytes.Clone(v))
+		}
+
+		for i, k := range keys {
+			if err := received.Delete(k); err != nil {
+				return err
+			}
+			if r, err := decode(records.Get(ids[i])); err == nil {
+				for _, providerID := range r.ProviderMessageIDs() {
+					if err := providerIDs.Delete([]byte(providerID)); err != nil {
+						return err
+					}
+				}
+			}
+			if err := records.Delete(ids[i]); err != nil {
+				return err
+			}
+		}
+		removed = len(keys)
+		return nil
+	})
+	return removed, err
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// indexProviderIDs maps the IDs providers assigned to r to its message ID
+func indexProviderIDs(tx *bbolt.Tx, r *audit.Record) error {
+	providerIDs := tx.Bucket(providerBucket)
+	for _, providerID := range r.ProviderMessageIDs() {
+		if err := providerIDs.Put([]byte(providerID), []byte(r.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// receivedKey orders records by receipt time, with the ID keeping keys unique
+func receivedKey(t time.Time, id string) []byte {
+	key := make([]byte, 8, 8+len(id))
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return append(key, id...)
+}
+
+func receivedTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key[:8])))
+}
+
+func decode(data []byte) (*audit.Record, error) {
+	if data == nil {
+		return nil, audit.ErrNotFound
+	}
+	var r audit.Record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("failed to decode audit record: %w", err)
+	}
+	return &r, nil
+}
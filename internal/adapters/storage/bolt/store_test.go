@@ -0,0 +1,127 @@
+package bolt
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/domain/service/audit"
+	"github.com/stretchr/testify/assert"
+	bbolt "go.etcd.io/bbolt"
+)
+
+func openStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := Open(filepath.Join(t.TempDir(), "audit.db"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+var base = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func putRecords(t *testing.T, store *Store) {
+	t.Helper()
+	for i, r := range []*audit.Record{
+		{ID: "m1", From: "app@example.com", To: []string{"a@example.org"}},
+		{ID: "m2", From: "app@example.com", To: []string{"b@example.org"}, Attempts: []audit.Attempt{{MessageID: "<p2@smtp-relay.mailin.fr>"}}},
+		{ID: "m3", From: "other@example.com", To: []string{"a@example.org"}},
+	} {
+		r.ReceivedAt = base.Add(time.Duration(i) * time.Hour)
+		assert.NoError(t, store.Put(r))
+	}
+}
+
+func ids(records []*audit.Record) []string {
+	var result []string
+	for _, r := range records {
+		result = append(result, r.ID)
+	}
+	return result
+}
+
+func TestStore_Search(t *testing.T) {
+	store := openStore(t)
+	putRecords(t, store)
+
+	tests := []struct {
+		name  string
+		query audit.Query
+		want  []string
+	}{
+		{"all newest first", audit.Query{}, []string{"m3", "m2", "m1"}},
+		{"by id", audit.Query{ID: "m2"}, []string{"m2"}},
+		{"unknown id", audit.Query{ID: "missing"}, nil},
+		{"by provider message id", audit.Query{ProviderMessageID: "<p2@smtp-relay.mailin.fr>"}, []string{"m2"}},
+		{"unknown provider message id", audit.Query{ProviderMessageID: "<missing>"}, nil},
+		{"by sender", audit.Query{Sender: "app@example.com"}, []string{"m2", "m1"}},
+		{"by recipient", audit.Query{Recipient: "a@example.org"}, []string{"m3", "m1"}},
+		{"since", audit.Query{Since: base.Add(time.Hour)}, []string{"m3", "m2"}},
+		{"until", audit.Query{Until: base.Add(time.Hour)}, []string{"m2", "m1"}},
+		{"limit", audit.Query{Limit: 1}, []string{"m3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := store.Search(tt.query)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, ids(records))
+		})
+	}
+}
+
+func TestStore_Update(t *testing.T) {
+	store := openStore(t)
+	putRecords(t, store)
+
+	assert.NoError(t, store.Update("m1", func(r *audit.Record) {
+		r.Status = audit.StatusDelivered
+		r.Attempts = append(r.Attempts, audit.Attempt{Provider: "brevo", MessageID: "<p1@smtp-relay.mailin.fr>"})
+	}))
+
+	records, err := store.Search(audit.Query{ID: "m1"})
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, audit.StatusDelivered, records[0].Status)
+	assert.Len(t, records[0].Attempts, 1)
+
+	records, err = store.Search(audit.Query{ProviderMessageID: "<p1@smtp-relay.mailin.fr>"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"m1"}, ids(records))
+
+	assert.ErrorIs(t, store.Update("missing", func(r *audit.Record) {}), audit.ErrNotFound)
+}
+
+func TestStore_Prune(t *testing.T) {
+	store := openStore(t)
+	putRecords(t, store)
+
+	removed, err := store.Prune(base.Add(90 * time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, removed)
+
+	records, err := store.Search(audit.Query{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"m3"}, ids(records))
+
+	// The provider message ID index goes with the records
+	assert.NoError(t, store.db.View(func(tx *bbolt.Tx) error {
+		assert.Nil(t, tx.Bucket(providerBucket).Get([]byte("<p2@smtp-relay.mailin.fr>")))
+		return nil
+	}))
+}
+
+func TestStore_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.db")
+	store, err := Open(path)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Put(&audit.Record{ID: "m1", ReceivedAt: base}))
+	assert.NoError(t, store.Close())
+
+	store, err = Open(path)
+	assert.NoError(t, err)
+	defer store.Close()
+
+	records, err := store.Search(audit.Query{ID: "m1"})
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+}
@@ -0,0 +1,91 @@
+package bolt
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/itsLeonB/smtproxy/internal/domain/service/suppression"
+	bbolt "go.etcd.io/bbolt"
+)
+
+// suppressionsBucket maps normalized addresses to JSON suppression entries
+var suppressionsBucket = []byte("suppressions")
+
+// SuppressionStore is a suppression.Store backed by an embedded bbolt database
+type SuppressionStore struct {
+	db *bbolt.DB
+}
+
+// OpenSuppressions opens or creates the suppression database at path
+func OpenSuppressions(path string) (*SuppressionStore, error) {
+	db, err := openDB(path, "suppression", suppressionsBucket)
+	if err != nil {
+		return nil, err
+	}
+	return &SuppressionStore{db: db}, nil
+}
+
+// Put stores e, replacing the entry for its address
+func (s *SuppressionStore) Put(e suppression.Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(suppressionsBucket).Put([]byte(e.Address), data)
+	})
+}
+
+// Get returns the entry for address
+func (s *SuppressionStore) Get(address string) (suppression.Entry, error) {
+	var e suppression.Entry
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		e, err = decodeEntry(tx.Bucket(suppressionsBucket).Get([]byte(address)))
+		return err
+	})
+	return e, err
+}
+
+// Delete removes the entry for address
+func (s *SuppressionStore) Delete(address string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		entries := tx.Bucket(suppressionsBucket)
+		if entries.Get([]byte(address)) == nil {
+			return suppression.ErrNotFound
+		}
+		return entries.Delete([]byte(address))
+	})
+}
+
+// List returns every entry ordered by address
+func (s *SuppressionStore) List() ([]suppression.Entry, error) {
+	var entries []suppression.Entry
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(suppressionsBucket).ForEach(func(k, v []byte) error {
+			e, err := decodeEntry(v)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, e)
+			return nil
+		})
+	})
+	return entries, err
+}
+
+// Close closes the database
+func (s *SuppressionStore) Close() error {
+	return s.db.Close()
+}
+
+func decodeEntry(data []byte) (suppression.Entry, error) {
+	var e suppression.Entry
+	if data == nil {
+		return e, suppression.ErrNotFound
+	}
+	if err := json.Unmarshal(data, &e); err != nil {
+		return e, fmt.Errorf("failed to decode suppression entry: %w", err)
+	}
+	return e, nil
+}
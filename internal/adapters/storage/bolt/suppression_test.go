@@ -0,0 +1,42 @@
+package bolt
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/itsLeonB/smtproxy/internal/domain/service/suppression"
+	"github.com/stretchr/testify/assert"
+)
+
+func openSuppressions(t *testing.T) *SuppressionStore {
+	t.Helper()
+	store, err := OpenSuppressions(filepath.Join(t.TempDir(), "suppressions.db"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func TestSuppressionStore(t *testing.T) {
+	store := openSuppressions(t)
+	bob := suppression.Entry{Address: "bob@example.org", Reason: suppression.ReasonHardBounce, Details: "550 5.1.1", CreatedAt: base}
+	alice := suppression.Entry{Address: "alice@example.org", Reason: suppression.ReasonManual, CreatedAt: base}
+	assert.NoError(t, store.Put(bob))
+	assert.NoError(t, store.Put(alice))
+
+	got, err := store.Get("bob@example.org")
+	assert.NoError(t, err)
+	assert.Equal(t, bob, got)
+
+	_, err = store.Get("carol@example.org")
+	assert.ErrorIs(t, err, suppression.ErrNotFound)
+
+	entries, err := store.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []suppression.Entry{alice, bob}, entries)
+
+	assert.NoError(t, store.Delete("bob@example.org"))
+	assert.ErrorIs(t, store.Delete("bob@example.org"), suppression.ErrNotFound)
+	entries, err = store.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []suppression.Entry{alice}, entries)
+}
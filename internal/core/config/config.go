@@ -1,34 +1,179 @@
 package config
 
 import (
+	"fmt"
+	"os"
 	"time"
 
 	"github.com/kelseyhightower/envconfig"
 )
 
 type Config struct {
-	LogLevel         string            `envconfig:"LOG_LEVEL" default:"info"`
-	SMTPPort         string            `envconfig:"SMTP_PORT" default:"2525"`
-	MaxSize          int64             `envconfig:"MAX_MESSAGE_SIZE" default:"10485760"` // 10MB
-	AuthEnabled      bool              `envconfig:"AUTH_ENABLED" default:"true"`
-	AuthUsers        map[string]string `envconfig:"AUTH_USERS"`
-	AllowInsecureAuth bool             `envconfig:"ALLOW_INSECURE_AUTH" default:"false"`
-	DefaultProvider  string            `envconfig:"DEFAULT_PROVIDER" default:"brevo"`
-	EnabledProviders string            `envconfig:"ENABLED_PROVIDERS" default:"brevo"`
-
-	// Brevo configuration
-	BrevoAPIKey  string        `envconfig:"BREVO_API_KEY"`
+	LogLevel          string            `envconfig:"LOG_LEVEL" default:"info"`
+	LogFormat         string            `envconfig:"LOG_FORMAT" default:"text"`
+	LogRedact         bool              `envconfig:"LOG_REDACT" default:"false"`
+	SMTPPort          string            `envconfig:"SMTP_PORT" default:"2525"`
+	Hostname          string            `envconfig:"SMTP_HOSTNAME" default:"localhost"`
+	SMTPUTF8Enabled   bool              `envconfig:"SMTPUTF8_ENABLED" default:"true"`
+	ShutdownTimeout   time.Duration     `envconfig:"SHUTDOWN_TIMEOUT" default:"30s"`
+	DispatchTimeout   time.Duration     `envconfig:"DISPATCH_TIMEOUT" default:"60s"`
+	MaxSize           int64             `envconfig:"MAX_MESSAGE_SIZE" default:"10485760"` // 10MB
+	AuthEnabled       bool              `envconfig:"AUTH_ENABLED" default:"true"`
+	AuthUsers         map[string]string `envconfig:"AUTH_USERS" secret:"true"`
+	AllowInsecureAuth bool              `envconfig:"ALLOW_INSECURE_AUTH" default:"false"`
+
+	// Credentials file in htpasswd style (user:hash), reloaded on change
+	AuthCredentialsFile   string        `envconfig:"AUTH_CREDENTIALS_FILE"`
+	AuthCredentialsReload time.Duration `envconfig:"AUTH_CREDENTIALS_RELOAD_INTERVAL" default:"10s"`
+
+	// Client networks (CIDR or single addresses). Trusted networks may relay without AUTH.
+	ClientAllow     []string `envconfig:"CLIENT_ALLOW"`
+	ClientDeny      []string `envconfig:"CLIENT_DENY"`
+	TrustedNetworks []string `envconfig:"TRUSTED_NETWORKS"`
+
+	// PROXY protocol v1/v2 from trusted load balancers (CIDR or single addresses)
+	ProxyProtocol        bool     `envconfig:"PROXY_PROTOCOL" default:"false"`
+	ProxyProtocolTrusted []string `envconfig:"PROXY_PROTOCOL_TRUSTED_NETWORKS"`
+
+	// Connection, message rate and AUTH failure limits (0 disables a limit)
+	MaxConnections        int           `envconfig:"MAX_CONNECTIONS" default:"0"`
+	MaxConnectionsPerIP   int           `envconfig:"MAX_CONNECTIONS_PER_IP" default:"0"`
+	ConnectionsPerMinute  int           `envconfig:"CONNECTION_RATE_PER_MINUTE" default:"0"`
+	MessagesPerMinute     int           `envconfig:"MESSAGE_RATE_PER_MINUTE" default:"0"`
+	UserMessagesPerMinute int           `envconfig:"USER_MESSAGE_RATE_PER_MINUTE" default:"0"`
+	AuthMaxFailures       int           `envconfig:"AUTH_MAX_FAILURES" default:"5"`
+	AuthLockout           time.Duration `envconfig:"AUTH_LOCKOUT_DURATION" default:"15m"`
+	AuthFailureDelay      time.Duration `envconfig:"AUTH_FAILURE_DELAY" default:"1s"`
+
+	// HTTP server for /metrics and /healthz (empty disables it). Management
+	// endpoints require ADMIN_TOKEN as a bearer token.
+	HTTPAddr   string `envconfig:"HTTP_ADDR"`
+	AdminToken string `envconfig:"ADMIN_TOKEN" secret:"true"`
+
+	// Audit trail of accepted messages (empty path disables it)
+	AuditDBPath    string        `envconfig:"AUDIT_DB_PATH"`
+	AuditRetention time.Duration `envconfig:"AUDIT_RETENTION" default:"720h"`
+
+	// Suppressed recipient addresses (empty path disables the list) and what
+	// happens to messages for them: reject, drop or tag
+	SuppressionDBPath string `envconfig:"SUPPRESSION_DB_PATH"`
+	SuppressionMode   string `envconfig:"SUPPRESSION_MODE" default:"reject"`
+
+	// OpenTelemetry tracing over OTLP/HTTP, configured by the standard OTEL_* variables
+	TracingEnabled bool `envconfig:"TRACING_ENABLED" default:"false"`
+
+	// Brevo delivery event webhooks at /webhooks/{provider} on the HTTP
+	// server, received when a token or allowed networks are set. Named
+	// instances may set their own webhook_token instead.
+	BrevoWebhookToken    string   `envconfig:"BREVO_WEBHOOK_TOKEN" secret:"true"`
+	BrevoWebhookNetworks []string `envconfig:"BREVO_WEBHOOK_ALLOWED_NETWORKS"`
+
+	// Application callback that receives normalized delivery events (empty
+	// disables forwarding), signed with the secret when one is set
+	WebhookForwardURL     string        `envconfig:"WEBHOOK_FORWARD_URL"`
+	WebhookForwardSecret  string        `envconfig:"WEBHOOK_FORWARD_SECRET" secret:"true"`
+	WebhookForwardTimeout time.Duration `envconfig:"WEBHOOK_FORWARD_TIMEOUT" default:"10s"`
+
+	// Vault server for vault:// secret references
+	VaultAddr      string `envconfig:"VAULT_ADDR"`
+	VaultToken     string `envconfig:"VAULT_TOKEN" secret:"true"`
+	VaultNamespace string `envconfig:"VAULT_NAMESPACE"`
+
+	// Per-user sending policies, from a JSON file or the config file
+	PolicyFile string        `envconfig:"POLICY_FILE"`
+	Policies   *PolicyConfig `ignored:"true" yaml:"policies"`
+
+	DefaultProvider  string `envconfig:"DEFAULT_PROVIDER" default:"brevo"`
+	EnabledProviders string `envconfig:"ENABLED_PROVIDERS" default:"brevo"`
+
+	// Weighted balancing of messages not routed to a specific provider
+	// (provider:weight pairs), optionally sticky per recipient domain
+	BalanceWeights map[string]int `envconfig:"BALANCE_WEIGHTS"`
+	BalanceSticky  bool           `envconfig:"BALANCE_STICKY" default:"false"`
+
+	// Per-provider circuit breaker, opened by consecutive transient failures
+	// (0 disables it) and half-opened for probes after the cooldown
+	CircuitBreakerThreshold int           `envconfig:"CIRCUIT_BREAKER_THRESHOLD" default:"5"`
+	CircuitBreakerCooldown  time.Duration `envconfig:"CIRCUIT_BREAKER_COOLDOWN" default:"30s"`
+	CircuitBreakerProbes    int           `envconfig:"CIRCUIT_BREAKER_PROBES" default:"1"`
+	CircuitBreakerFailover  bool          `envconfig:"CIRCUIT_BREAKER_FAILOVER" default:"false"`
+
+	// How long a send waits for a rate-limited provider before failing with
+	// a retry hint
+	ProviderRateLimitWait time.Duration `envconfig:"PROVIDER_RATE_LIMIT_WAIT" default:"5s"`
+
+	// Named provider instances, which can only be set in the config file
+	Providers []ProviderConfig `ignored:"true" yaml:"providers"`
+
+	// Routing rules choosing a provider per message, first match wins
+	Routes []RouteConfig `ignored:"true" yaml:"routes"`
+
+	// Asynchronous delivery queue
+	QueueEnabled       bool          `envconfig:"QUEUE_ENABLED" default:"false"`
+	QueueWorkers       int           `envconfig:"QUEUE_WORKERS" default:"4"`
+	QueueCapacity      int           `envconfig:"QUEUE_CAPACITY" default:"1000"`
+	QueueRetryInterval time.Duration `envconfig:"QUEUE_RETRY_INTERVAL" default:"1m"`
+	QueueMaxAge        time.Duration `envconfig:"QUEUE_MAX_AGE" default:"24h"`
+	DSNEnabled         bool          `envconfig:"DSN_ENABLED" default:"true"`
+	DSNDelayAfter      time.Duration `envconfig:"DSN_DELAY_AFTER" default:"4h"`
+	// From address of delivery status notifications, which the provider
+	// must accept as a sender
+	DSNSender string `envconfig:"DSN_SENDER"`
+
+	// Brevo configuration, registered as the provider named "brevo"
+	BrevoAPIKey  string        `envconfig:"BREVO_API_KEY" secret:"true"`
 	BrevoBaseURL string        `envconfig:"BREVO_BASE_URL" default:"https://api.brevo.com/v3"`
 	BrevoTimeout time.Duration `envconfig:"BREVO_TIMEOUT" default:"30s"`
+	// Sends per second, 0 for no limit
+	BrevoRateLimit float64 `envconfig:"BREVO_RATE_LIMIT" default:"0"`
 }
 
 var Global *Config
 
+// WebhooksEnabled reports whether Brevo delivery event webhooks are received
+func (c *Config) WebhooksEnabled() bool {
+	return len(c.WebhookProviders()) > 0
+}
+
+// Load reads the configuration into Global from the file named by
+// CONFIG_FILE, if any, and the environment, which takes precedence
 func Load() error {
-	var cfg Config
-	if err := envconfig.Process("", &cfg); err != nil {
+	cfg, err := Read(os.Getenv("CONFIG_FILE"))
+	if err != nil {
 		return err
 	}
-	Global = &cfg
+	Global = cfg
 	return nil
 }
+
+// Read builds a validated configuration from defaults, the YAML file at path
+// (skipped when empty) and the environment, in increasing precedence, then
+// resolves secrets from *_FILE variables and secret references
+func Read(path string) (*Config, error) {
+	var cfg Config
+	if err := envconfig.Process("", &cfg); err != nil {
+		return nil, err
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := applyFile(&cfg, data); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if err := applySecretFiles(&cfg); err != nil {
+		return nil, err
+	}
+	if err := resolveSecrets(&cfg); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
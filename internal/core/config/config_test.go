@@ -1,8 +1,12 @@
 package config
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 	"github.com/stretchr/testify/assert"
@@ -46,3 +50,463 @@ func TestConfig_AuthUsers_EnvParsing(t *testing.T) {
 		})
 	}
 }
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "smtproxy.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestRead_File(t *testing.T) {
+	path := writeConfigFile(t, `
+listeners:
+  smtp:
+    port: "2587"
+    max_message_size: 2048
+    proxy_protocol:
+      enabled: true
+      trusted_networks: [10.0.0.1]
+  http:
+    addr: ":9090"
+auth:
+  users:
+    alice: secret
+clients:
+  trusted: [10.0.0.0/8, 192.168.1.10]
+queue:
+  enabled: true
+  retry_interval: 30s
+  dsn_sender: bounces@example.com
+brevo:
+  api_key: key
+`)
+
+	cfg, err := Read(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "2587", cfg.SMTPPort)
+	assert.Equal(t, int64(2048), cfg.MaxSize)
+	assert.True(t, cfg.ProxyProtocol)
+	assert.Equal(t, []string{"10.0.0.1"}, cfg.ProxyProtocolTrusted)
+	assert.Equal(t, ":9090", cfg.HTTPAddr)
+	assert.Equal(t, map[string]string{"alice": "secret"}, cfg.AuthUsers)
+	assert.Equal(t, []string{"10.0.0.0/8", "192.168.1.10"}, cfg.TrustedNetworks)
+	assert.True(t, cfg.QueueEnabled)
+	assert.Equal(t, 30*time.Second, cfg.QueueRetryInterval)
+	assert.Equal(t, "bounces@example.com", cfg.DSNSender)
+	// Settings absent from the file keep their defaults
+	assert.Equal(t, "localhost", cfg.Hostname)
+	assert.Zero(t, cfg.MaxConnections)
+	assert.Zero(t, cfg.MaxConnectionsPerIP)
+}
+
+func TestRead_EnvOverridesFile(t *testing.T) {
+	t.Setenv("SMTP_PORT", "2626")
+	path := writeConfigFile(t, "listeners:\n  smtp:\n    port: \"2587\"\nbrevo:\n  api_key: key\n")
+
+	cfg, err := Read(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "2626", cfg.SMTPPort)
+}
+
+func TestRead_FileErrors(t *testing.T) {
+	path := writeConfigFile(t, `brevo:
+  api_key: key
+listeners:
+  smtp:
+    prot: "25"
+    max_message_size: big
+  http: ":9090"
+smtp_port: "25"
+`)
+
+	_, err := Read(path)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `line 5: unknown setting "listeners.smtp.prot"`)
+	assert.Contains(t, err.Error(), "listeners.smtp.max_message_size: line 6: cannot unmarshal")
+	assert.Contains(t, err.Error(), "line 7: listeners.http must be a section of settings")
+	assert.Contains(t, err.Error(), `line 8: unknown setting "smtp_port"`)
+}
+
+func TestLayout_CoversEveryVariable(t *testing.T) {
+	placed := map[string]bool{}
+	for _, env := range layout {
+		assert.False(t, placed[env], "%s is placed twice", env)
+		placed[env] = true
+	}
+
+	for name, field := range fileFields(&Config{}) {
+		if field.env != "" {
+			assert.True(t, placed[name], "%s has no place in the config file", name)
+		}
+	}
+}
+
+func TestRead_Policies(t *testing.T) {
+	path := writeConfigFile(t, `brevo:
+  api_key: key
+policies:
+  default:
+    max_recipients: 50
+  users:
+    app1:
+      allowed_senders: ["*@example.org"]
+      daily_quota: 1000
+`)
+
+	cfg, err := Read(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &PolicyConfig{
+		Default: &UserPolicy{MaxRecipients: 50},
+		Users: map[string]UserPolicy{
+			"app1": {AllowedSenders: []string{"*@example.org"}, DailyQuota: 1000},
+		},
+	}, cfg.Policies)
+}
+
+func TestRead_PoliciesUnknownSetting(t *testing.T) {
+	path := writeConfigFile(t, "brevo:\n  api_key: key\npolicies:\n  users:\n    app1:\n      quota: 10\n")
+
+	_, err := Read(path)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `line 6: unknown setting "quota"`)
+}
+
+func TestValidate_Policies(t *testing.T) {
+	var cfg Config
+	assert.NoError(t, envconfig.Process("", &cfg))
+	cfg.BrevoAPIKey = "key"
+	cfg.PolicyFile = "policies.json"
+	cfg.Policies = &PolicyConfig{
+		Default: &UserPolicy{MaxRecipients: -1},
+		Users:   map[string]UserPolicy{"app1": {Provider: "sendgrid"}},
+	}
+
+	err := cfg.Validate()
+
+	assert.Error(t, err)
+	for _, want := range []string{
+		"POLICY_FILE: policies are also set in the config file, use one or the other",
+		"policies.default: limits must not be negative",
+		`policies.users.app1: provider "sendgrid" is not a configured provider`,
+	} {
+		assert.Contains(t, err.Error(), want)
+	}
+}
+
+func TestRead_MissingFile(t *testing.T) {
+	_, err := Read(filepath.Join(t.TempDir(), "missing.yaml"))
+
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestValidate(t *testing.T) {
+	var cfg Config
+	assert.NoError(t, envconfig.Process("", &cfg))
+	cfg.BrevoAPIKey = "key"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.SMTPPort = ":2525"
+	cfg.LogFormat = "xml"
+	cfg.TrustedNetworks = []string{"10.0.0.0/33"}
+	cfg.ProxyProtocol = true
+	cfg.QueueEnabled = true
+	cfg.QueueWorkers = 0
+	cfg.CircuitBreakerCooldown = 0
+	cfg.BrevoAPIKey = ""
+
+	err := cfg.Validate()
+
+	assert.Error(t, err)
+	for _, want := range []string{
+		`SMTP_PORT: ":2525" is not a port number`,
+		`LOG_FORMAT: unknown format "xml"`,
+		`TRUSTED_NETWORKS: "10.0.0.0/33" is not a CIDR range`,
+		"PROXY_PROTOCOL_TRUSTED_NETWORKS: required when PROXY_PROTOCOL is enabled",
+		"QUEUE_WORKERS: must be at least 1",
+		"DSN_SENDER: required when the queue and DSN_ENABLED are enabled",
+		"CIRCUIT_BREAKER_COOLDOWN: must be positive, got 0s",
+		"BREVO_API_KEY: required when DEFAULT_PROVIDER is brevo",
+	} {
+		assert.Contains(t, err.Error(), want)
+	}
+}
+
+func TestValidate_DSNSender(t *testing.T) {
+	var cfg Config
+	assert.NoError(t, envconfig.Process("", &cfg))
+	cfg.BrevoAPIKey = "key"
+	cfg.QueueEnabled = true
+
+	cfg.DSNSender = "MAILER-DAEMON"
+	assert.ErrorContains(t, cfg.Validate(), `DSN_SENDER: "MAILER-DAEMON" is not an email address`)
+
+	cfg.DSNSender = "bounces@example.com"
+	assert.NoError(t, cfg.Validate())
+
+	// Without notifications no sender is needed
+	cfg.DSNSender = ""
+	cfg.DSNEnabled = false
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestRead_Providers(t *testing.T) {
+	path := writeConfigFile(t, `
+default_provider: brevo-tx
+providers:
+  - name: brevo-tx
+    type: brevo
+    api_key: tx-key
+  - name: brevo-mkt
+    type: brevo
+    api_key: mkt-key
+    base_url: https://brevo.example.com/v3
+    timeout: 10s
+    rate_limit: 2.5
+`)
+
+	cfg, err := Read(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []ProviderConfig{
+		{Name: "brevo-tx", Type: ProviderTypeBrevo, APIKey: "tx-key", BaseURL: "https://api.brevo.com/v3", Timeout: 30 * time.Second},
+		{Name: "brevo-mkt", Type: ProviderTypeBrevo, APIKey: "mkt-key", BaseURL: "https://brevo.example.com/v3", Timeout: 10 * time.Second, RateLimit: 2.5},
+	}, cfg.ProviderConfigs())
+}
+
+func TestRead_ProvidersUnknownSetting(t *testing.T) {
+	path := writeConfigFile(t, "brevo:\n  api_key: key\nproviders:\n  - name: brevo-tx\n    type: brevo\n    apikey: tx-key\n")
+
+	_, err := Read(path)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `line 6: unknown setting "apikey"`)
+}
+
+func TestValidate_Providers(t *testing.T) {
+	cfg := Config{
+		SMTPPort:        "2525",
+		MaxSize:         1024,
+		ShutdownTimeout: time.Second,
+		BrevoTimeout:    time.Second,
+		BrevoAPIKey:     "key",
+		DefaultProvider: "brevo-mkt",
+		Providers: []ProviderConfig{
+			{Name: "brevo", Type: ProviderTypeBrevo, APIKey: "key"},
+			{Name: "brevo-tx", Type: "sendgrid"},
+		},
+	}
+
+	err := cfg.Validate()
+
+	assert.Error(t, err)
+	for _, want := range []string{
+		`providers[0]: duplicate provider name "brevo"`,
+		`providers[1]: unknown type "sendgrid"`,
+		"providers[1]: api_key is required",
+		`DEFAULT_PROVIDER: "brevo-mkt" is not a configured provider`,
+	} {
+		assert.Contains(t, err.Error(), want)
+	}
+}
+
+func TestRead_BalanceWeights(t *testing.T) {
+	path := writeConfigFile(t, `
+brevo:
+  api_key: key
+providers:
+  - name: brevo-mkt
+    type: brevo
+    api_key: mkt-key
+balance:
+  weights:
+    brevo: 90
+    brevo-mkt: 10
+  sticky: true
+`)
+
+	cfg, err := Read(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"brevo": 90, "brevo-mkt": 10}, cfg.BalanceWeights)
+	assert.True(t, cfg.BalanceSticky)
+}
+
+func TestValidate_BalanceWeights(t *testing.T) {
+	cfg := Config{
+		SMTPPort:        "2525",
+		MaxSize:         1024,
+		ShutdownTimeout: time.Second,
+		BrevoTimeout:    time.Second,
+		BrevoAPIKey:     "key",
+		DefaultProvider: "brevo",
+		BalanceWeights:  map[string]int{"brevo": 0, "ses": -1},
+	}
+
+	err := cfg.Validate()
+
+	assert.Error(t, err)
+	for _, want := range []string{
+		`BALANCE_WEIGHTS: "ses" is not a configured provider`,
+		"BALANCE_WEIGHTS: weights must not all be zero",
+	} {
+		assert.Contains(t, err.Error(), want)
+	}
+}
+
+func TestValidate_Webhooks(t *testing.T) {
+	cfg := Config{
+		SMTPPort:             "2525",
+		MaxSize:              1024,
+		ShutdownTimeout:      time.Second,
+		BrevoTimeout:         time.Second,
+		BrevoAPIKey:          "key",
+		DefaultProvider:      "brevo",
+		BrevoWebhookNetworks: []string{"1.179.112.0/20", "1.179.112.0/33"},
+		WebhookForwardURL:    "ftp://app.example.com/events",
+	}
+
+	err := cfg.Validate()
+
+	assert.Error(t, err)
+	for _, want := range []string{
+		`BREVO_WEBHOOK_ALLOWED_NETWORKS: "1.179.112.0/33" is not a CIDR range`,
+		"HTTP_ADDR: required to receive Brevo webhooks",
+		`WEBHOOK_FORWARD_URL: "ftp://app.example.com/events" is not an http or https URL`,
+		"WEBHOOK_FORWARD_TIMEOUT: must be positive, got 0s",
+	} {
+		assert.Contains(t, err.Error(), want)
+	}
+
+	cfg = Config{
+		SMTPPort:          "2525",
+		MaxSize:           1024,
+		ShutdownTimeout:   time.Second,
+		BrevoTimeout:      time.Second,
+		BrevoAPIKey:       "key",
+		DefaultProvider:   "brevo",
+		WebhookForwardURL: "https://app.example.com/events",
+	}
+	assert.ErrorContains(t, cfg.Validate(), "WEBHOOK_FORWARD_URL: requires BREVO_WEBHOOK_TOKEN, BREVO_WEBHOOK_ALLOWED_NETWORKS or a provider webhook_token")
+
+	cfg.HTTPAddr = ":9090"
+	cfg.BrevoWebhookToken = "hook"
+	cfg.WebhookForwardTimeout = time.Second
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestWebhookProviders(t *testing.T) {
+	cfg := Config{
+		BrevoAPIKey: "key",
+		Providers: []ProviderConfig{
+			{Name: "brevo-mkt", Type: ProviderTypeBrevo, APIKey: "mkt-key", WebhookToken: "mkt-hook"},
+			{Name: "brevo-tx", Type: ProviderTypeBrevo, APIKey: "tx-key"},
+		},
+	}
+
+	// Only instances with a token receive webhooks without allowed networks
+	providers := cfg.WebhookProviders()
+	if assert.Len(t, providers, 1) {
+		assert.Equal(t, "brevo-mkt", providers[0].Name)
+	}
+
+	// The shared token applies to instances without their own
+	cfg.BrevoWebhookToken = "hook"
+	tokens := make(map[string]string)
+	for _, p := range cfg.WebhookProviders() {
+		tokens[p.Name] = p.WebhookToken
+	}
+	assert.Equal(t, map[string]string{"brevo": "hook", "brevo-mkt": "mkt-hook", "brevo-tx": "hook"}, tokens)
+}
+
+func TestValidate_SuppressionMode(t *testing.T) {
+	cfg := Config{
+		SMTPPort:          "2525",
+		MaxSize:           1024,
+		ShutdownTimeout:   time.Second,
+		BrevoTimeout:      time.Second,
+		BrevoAPIKey:       "key",
+		DefaultProvider:   "brevo",
+		SuppressionDBPath: "/var/lib/smtproxy/suppressions.db",
+		SuppressionMode:   "bounce",
+	}
+	assert.ErrorContains(t, cfg.Validate(), `SUPPRESSION_MODE: must be reject, drop or tag, got "bounce"`)
+
+	cfg.SuppressionMode = "drop"
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestRead_SecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	apiKey := filepath.Join(dir, "brevo_api_key")
+	users := filepath.Join(dir, "auth_users")
+	assert.NoError(t, os.WriteFile(apiKey, []byte("xkeysib\n"), 0o600))
+	assert.NoError(t, os.WriteFile(users, []byte("app1:pass1\napp2:pass2\n"), 0o600))
+	t.Setenv("BREVO_API_KEY_FILE", apiKey)
+	t.Setenv("AUTH_USERS_FILE", users)
+	// The environment wins over the config file, including through *_FILE
+	path := writeConfigFile(t, "brevo:\n  api_key: from-file\n")
+
+	cfg, err := Read(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "xkeysib", cfg.BrevoAPIKey)
+	assert.Equal(t, map[string]string{"app1": "pass1", "app2": "pass2"}, cfg.AuthUsers)
+}
+
+func TestRead_SecretFileConflict(t *testing.T) {
+	t.Setenv("BREVO_API_KEY", "xkeysib")
+	t.Setenv("BREVO_API_KEY_FILE", filepath.Join(t.TempDir(), "brevo_api_key"))
+
+	_, err := Read("")
+
+	assert.ErrorContains(t, err, "BREVO_API_KEY and BREVO_API_KEY_FILE are both set")
+}
+
+func TestRead_SecretReferences(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "tx_key")
+	assert.NoError(t, os.WriteFile(keyFile, []byte("tx-key\n"), 0o600))
+	t.Setenv("SMTPROXY_TEST_ADMIN_TOKEN", "t0k3n")
+	path := writeConfigFile(t, `
+listeners:
+  http:
+    admin_token: env://SMTPROXY_TEST_ADMIN_TOKEN
+auth:
+  users:
+    app1: env://SMTPROXY_TEST_ADMIN_TOKEN
+default_provider: brevo-tx
+providers:
+  - name: brevo-tx
+    type: brevo
+    api_key: file://`+keyFile+`
+`)
+
+	cfg, err := Read(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "t0k3n", cfg.AdminToken)
+	assert.Equal(t, map[string]string{"app1": "t0k3n"}, cfg.AuthUsers)
+	assert.Equal(t, "tx-key", cfg.Providers[0].APIKey)
+}
+
+func TestRead_VaultReference(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/secret/data/smtproxy", r.URL.Path)
+		assert.Equal(t, "root", r.Header.Get("X-Vault-Token"))
+		_, _ = w.Write([]byte(`{"data":{"data":{"brevo_api_key":"xkeysib"},"metadata":{}}}`))
+	}))
+	defer vault.Close()
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "root")
+	t.Setenv("BREVO_API_KEY", "vault://secret/data/smtproxy#brevo_api_key")
+
+	cfg, err := Read("")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "xkeysib", cfg.BrevoAPIKey)
+}
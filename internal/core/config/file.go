@@ -0,0 +1,213 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// fileField is a Config field settable from the config file
+type fileField struct {
+	// env is the variable that overrides the field, if any
+	env   string
+	value reflect.Value
+	// secret fields may also be read from the file named by env_FILE
+	secret bool
+}
+
+// overridden reports whether the environment sets the field
+func (f fileField) overridden() bool {
+	if _, set := os.LookupEnv(f.env); set {
+		return true
+	}
+	if _, set := os.LookupEnv(f.env + "_FILE"); set && f.secret {
+		return true
+	}
+	return false
+}
+
+// layout maps the settings of the config file, keyed by their path with
+// sections joined by dots, to the environment variables that override them.
+// Settings without a variable, such as providers, are top-level keys named
+// by their yaml tag.
+var layout = map[string]string{
+	"shutdown_timeout":         "SHUTDOWN_TIMEOUT",
+	"dispatch_timeout":         "DISPATCH_TIMEOUT",
+	"policy_file":              "POLICY_FILE",
+	"default_provider":         "DEFAULT_PROVIDER",
+	"enabled_providers":        "ENABLED_PROVIDERS",
+	"provider_rate_limit_wait": "PROVIDER_RATE_LIMIT_WAIT",
+
+	"log.level":  "LOG_LEVEL",
+	"log.format": "LOG_FORMAT",
+	"log.redact": "LOG_REDACT",
+
+	"listeners.smtp.port":                            "SMTP_PORT",
+	"listeners.smtp.hostname":                        "SMTP_HOSTNAME",
+	"listeners.smtp.smtputf8":                        "SMTPUTF8_ENABLED",
+	"listeners.smtp.max_message_size":                "MAX_MESSAGE_SIZE",
+	"listeners.smtp.proxy_protocol.enabled":          "PROXY_PROTOCOL",
+	"listeners.smtp.proxy_protocol.trusted_networks": "PROXY_PROTOCOL_TRUSTED_NETWORKS",
+	"listeners.http.addr":                            "HTTP_ADDR",
+	"listeners.http.admin_token":                     "ADMIN_TOKEN",
+
+	"auth.enabled":                     "AUTH_ENABLED",
+	"auth.users":                       "AUTH_USERS",
+	"auth.allow_insecure":              "ALLOW_INSECURE_AUTH",
+	"auth.credentials_file":            "AUTH_CREDENTIALS_FILE",
+	"auth.credentials_reload_interval": "AUTH_CREDENTIALS_RELOAD_INTERVAL",
+	"auth.max_failures":                "AUTH_MAX_FAILURES",
+	"auth.lockout_duration":            "AUTH_LOCKOUT_DURATION",
+	"auth.failure_delay":               "AUTH_FAILURE_DELAY",
+
+	"clients.allow":   "CLIENT_ALLOW",
+	"clients.deny":    "CLIENT_DENY",
+	"clients.trusted": "TRUSTED_NETWORKS",
+
+	"limits.max_connections":          "MAX_CONNECTIONS",
+	"limits.max_connections_per_ip":   "MAX_CONNECTIONS_PER_IP",
+	"limits.connections_per_minute":   "CONNECTION_RATE_PER_MINUTE",
+	"limits.messages_per_minute":      "MESSAGE_RATE_PER_MINUTE",
+	"limits.user_messages_per_minute": "USER_MESSAGE_RATE_PER_MINUTE",
+
+	"queue.enabled":         "QUEUE_ENABLED",
+	"queue.workers":         "QUEUE_WORKERS",
+	"queue.capacity":        "QUEUE_CAPACITY",
+	"queue.retry_interval":  "QUEUE_RETRY_INTERVAL",
+	"queue.max_age":         "QUEUE_MAX_AGE",
+	"queue.dsn_enabled":     "DSN_ENABLED",
+	"queue.dsn_delay_after": "DSN_DELAY_AFTER",
+	"queue.dsn_sender":      "DSN_SENDER",
+
+	"audit.db_path":   "AUDIT_DB_PATH",
+	"audit.retention": "AUDIT_RETENTION",
+
+	"suppression.db_path": "SUPPRESSION_DB_PATH",
+	"suppression.mode":    "SUPPRESSION_MODE",
+
+	"tracing.enabled": "TRACING_ENABLED",
+
+	"webhooks.brevo.token":            "BREVO_WEBHOOK_TOKEN",
+	"webhooks.brevo.allowed_networks": "BREVO_WEBHOOK_ALLOWED_NETWORKS",
+	"webhooks.forward.url":            "WEBHOOK_FORWARD_URL",
+	"webhooks.forward.secret":         "WEBHOOK_FORWARD_SECRET",
+	"webhooks.forward.timeout":        "WEBHOOK_FORWARD_TIMEOUT",
+
+	"vault.addr":      "VAULT_ADDR",
+	"vault.token":     "VAULT_TOKEN",
+	"vault.namespace": "VAULT_NAMESPACE",
+
+	"balance.weights": "BALANCE_WEIGHTS",
+	"balance.sticky":  "BALANCE_STICKY",
+
+	"circuit_breaker.threshold": "CIRCUIT_BREAKER_THRESHOLD",
+	"circuit_breaker.cooldown":  "CIRCUIT_BREAKER_COOLDOWN",
+	"circuit_breaker.probes":    "CIRCUIT_BREAKER_PROBES",
+	"circuit_breaker.failover":  "CIRCUIT_BREAKER_FAILOVER",
+
+	"brevo.api_key":    "BREVO_API_KEY",
+	"brevo.base_url":   "BREVO_BASE_URL",
+	"brevo.timeout":    "BREVO_TIMEOUT",
+	"brevo.rate_limit": "BREVO_RATE_LIMIT",
+}
+
+// sections returns the paths of the sections in the layout
+func sections() map[string]bool {
+	paths := make(map[string]bool)
+	for key := range layout {
+		for i := range len(key) {
+			if key[i] == '.' {
+				paths[key[:i]] = true
+			}
+		}
+	}
+	return paths
+}
+
+// applyFile decodes YAML settings laid out as in layout into cfg. Settings
+// whose variable is set are skipped so that the environment always wins.
+func applyFile(cfg *Config, data []byte) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: expected a mapping of settings", root.Line)
+	}
+	return errors.Join(applySection(root, "", fileFields(cfg), sections())...)
+}
+
+// applySection decodes the settings of the section at path, "" for the root
+func applySection(node *yaml.Node, path string, fields map[string]fileField, sections map[string]bool) []error {
+	var errs []error
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		name := key.Value
+		if path != "" {
+			name = path + "." + key.Value
+		}
+
+		field, ok := fields[layout[name]]
+		if !ok && path == "" {
+			field, ok = fields[name]
+			ok = ok && field.env == ""
+		}
+		switch {
+		case ok:
+			if field.overridden() {
+				continue
+			}
+			if err := value.Decode(field.value.Addr().Interface()); err != nil {
+				errs = append(errs, decodeError(name, key, err))
+			}
+		case sections[name]:
+			if value.Kind != yaml.MappingNode {
+				errs = append(errs, fmt.Errorf("line %d: %s must be a section of settings", key.Line, name))
+				continue
+			}
+			errs = append(errs, applySection(value, name, fields, sections)...)
+		default:
+			errs = append(errs, fmt.Errorf("line %d: unknown setting %q", key.Line, name))
+		}
+	}
+	return errs
+}
+
+// fileFields maps the variables of the fields of cfg, or the yaml tags of
+// fields without one, to the fields
+func fileFields(cfg *Config) map[string]fileField {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	fields := make(map[string]fileField, t.NumField())
+	for i := range t.NumField() {
+		tag := t.Field(i).Tag
+		if key := tag.Get("yaml"); key != "" {
+			fields[key] = fileField{value: v.Field(i)}
+			continue
+		}
+		env := tag.Get("envconfig")
+		if env == "" || env == "-" {
+			continue
+		}
+		fields[env] = fileField{env: env, value: v.Field(i), secret: tag.Get("secret") == "true"}
+	}
+	return fields
+}
+
+// decodeError reports a type mismatch with the line of the offending value
+func decodeError(name string, key *yaml.Node, err error) error {
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		return fmt.Errorf("%s: %s", name, strings.Join(typeErr.Errors, "; "))
+	}
+	return fmt.Errorf("line %d: %s: %w", key.Line, name, err)
+}
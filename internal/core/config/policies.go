@@ -0,0 +1,68 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// PolicyConfig holds per-user sending policies, the config file's
+// alternative to POLICY_FILE
+type PolicyConfig struct {
+	Default *UserPolicy           `yaml:"default"`
+	Users   map[string]UserPolicy `yaml:"users"`
+}
+
+// UserPolicy restricts what a user may send. Zero values mean no limit.
+type UserPolicy struct {
+	AllowedSenders []string `yaml:"allowed_senders"`
+	MaxRecipients  int      `yaml:"max_recipients"`
+	MaxMessageSize int64    `yaml:"max_message_size"`
+	Provider       string   `yaml:"provider"`
+	DailyQuota     int      `yaml:"daily_quota"`
+}
+
+// UnmarshalYAML rejects unknown keys, which plain decoding silently ignores
+func (p *PolicyConfig) UnmarshalYAML(node *yaml.Node) error {
+	type plain PolicyConfig
+	return decodeStrict(node, (*plain)(p))
+}
+
+// UnmarshalYAML rejects unknown keys, which plain decoding silently ignores
+func (p *UserPolicy) UnmarshalYAML(node *yaml.Node) error {
+	type plain UserPolicy
+	return decodeStrict(node, (*plain)(p))
+}
+
+// validatePolicies checks the policies from the config file
+func (c *Config) validatePolicies() []error {
+	if c.Policies == nil {
+		return nil
+	}
+
+	var errs []error
+	if c.PolicyFile != "" {
+		errs = append(errs, errors.New("POLICY_FILE: policies are also set in the config file, use one or the other"))
+	}
+	names := c.providerNames()
+	check := func(name string, p UserPolicy) {
+		invalid := func(format string, args ...any) {
+			errs = append(errs, fmt.Errorf("%s: %s", name, fmt.Sprintf(format, args...)))
+		}
+
+		if p.MaxRecipients < 0 || p.MaxMessageSize < 0 || p.DailyQuota < 0 {
+			invalid("limits must not be negative")
+		}
+		if p.Provider != "" && !names[p.Provider] {
+			invalid("provider %q is not a configured provider", p.Provider)
+		}
+	}
+	if c.Policies.Default != nil {
+		check("policies.default", *c.Policies.Default)
+	}
+	for user, p := range c.Policies.Users {
+		check("policies.users."+user, p)
+	}
+	return errs
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// ProviderTypeBrevo is the Brevo transactional email API
+const ProviderTypeBrevo = "brevo"
+
+// Defaults for provider instances that leave settings empty
+const (
+	defaultBrevoBaseURL    = "https://api.brevo.com/v3"
+	defaultProviderTimeout = 30 * time.Second
+)
+
+// ProviderConfig is a named provider instance, so that several accounts of
+// the same type can be registered side by side
+type ProviderConfig struct {
+	Name    string        `yaml:"name"`
+	Type    string        `yaml:"type"`
+	APIKey  string        `yaml:"api_key"`
+	BaseURL string        `yaml:"base_url"`
+	Timeout time.Duration `yaml:"timeout"`
+	// RateLimit caps sends per second through the instance; zero means no cap
+	RateLimit float64 `yaml:"rate_limit"`
+	// WebhookToken authenticates the instance's delivery event webhooks;
+	// BREVO_WEBHOOK_TOKEN applies when it is empty
+	WebhookToken string `yaml:"webhook_token"`
+}
+
+// UnmarshalYAML rejects unknown keys, which plain decoding silently ignores
+func (p *ProviderConfig) UnmarshalYAML(node *yaml.Node) error {
+	type plain ProviderConfig
+	return decodeStrict(node, (*plain)(p))
+}
+
+// decodeStrict decodes a mapping into out, a pointer to a struct with yaml
+// tags, reporting keys that don't match a tag with their line numbers
+func decodeStrict(node *yaml.Node, out any) error {
+	if node.Kind == yaml.MappingNode {
+		known := make(map[string]bool)
+		t := reflect.TypeOf(out).Elem()
+		for i := range t.NumField() {
+			known[t.Field(i).Tag.Get("yaml")] = true
+		}
+		for i := 0; i < len(node.Content); i += 2 {
+			if key := node.Content[i]; !known[key.Value] {
+				return fmt.Errorf("line %d: unknown setting %q", key.Line, key.Value)
+			}
+		}
+	}
+	return node.Decode(out)
+}
+
+// ProviderConfigs returns every configured provider instance with defaults
+// applied: the one named "brevo" from the BREVO_* settings, if its API key
+// is set, followed by the instances from the config file
+func (c *Config) ProviderConfigs() []ProviderConfig {
+	var providers []ProviderConfig
+	if c.BrevoAPIKey != "" {
+		providers = append(providers, ProviderConfig{
+			Name:         "brevo",
+			Type:         ProviderTypeBrevo,
+			APIKey:       c.BrevoAPIKey,
+			BaseURL:      c.BrevoBaseURL,
+			Timeout:      c.BrevoTimeout,
+			RateLimit:    c.BrevoRateLimit,
+			WebhookToken: c.BrevoWebhookToken,
+		})
+	}
+
+	for _, p := range c.Providers {
+		if p.Type == ProviderTypeBrevo && p.BaseURL == "" {
+			p.BaseURL = defaultBrevoBaseURL
+		}
+		if p.Timeout == 0 {
+			p.Timeout = defaultProviderTimeout
+		}
+		if p.WebhookToken == "" {
+			p.WebhookToken = c.BrevoWebhookToken
+		}
+		providers = append(providers, p)
+	}
+	return providers
+}
+
+// WebhookProviders returns the Brevo instances whose delivery event webhooks
+// are received: those with a webhook token, or all of them when
+// BREVO_WEBHOOK_ALLOWED_NETWORKS is set
+func (c *Config) WebhookProviders() []ProviderConfig {
+	var providers []ProviderConfig
+	for _, p := range c.ProviderConfigs() {
+		if p.Type == ProviderTypeBrevo && (p.WebhookToken != "" || len(c.BrevoWebhookNetworks) > 0) {
+			providers = append(providers, p)
+		}
+	}
+	return providers
+}
+
+// providerNames returns the names of the configured provider instances
+func (c *Config) providerNames() map[string]bool {
+	names := make(map[string]bool)
+	for _, p := range c.ProviderConfigs() {
+		names[p.Name] = true
+	}
+	return names
+}
+
+// validateProviders checks the instances from the config file and that the
+// default and weighted providers are configured instances
+func (c *Config) validateProviders() []error {
+	var errs []error
+	names := make(map[string]bool)
+	if c.BrevoAPIKey != "" {
+		names["brevo"] = true
+	}
+
+	for i, p := range c.Providers {
+		invalid := func(format string, args ...any) {
+			errs = append(errs, fmt.Errorf("providers[%d]: %s", i, fmt.Sprintf(format, args...)))
+		}
+
+		switch {
+		case p.Name == "":
+			invalid("name is required")
+		case strings.ContainsAny(p.Name, " \t/"):
+			invalid("name %q must not contain spaces or slashes", p.Name)
+		case names[p.Name]:
+			invalid("duplicate provider name %q", p.Name)
+		}
+		names[p.Name] = true
+
+		if p.Type != ProviderTypeBrevo {
+			invalid("unknown type %q, expected %s", p.Type, ProviderTypeBrevo)
+		}
+		if p.APIKey == "" {
+			invalid("api_key is required")
+		}
+		if p.Timeout < 0 {
+			invalid("timeout must not be negative, got %s", p.Timeout)
+		}
+		if p.RateLimit < 0 {
+			invalid("rate_limit must not be negative, got %g", p.RateLimit)
+		}
+	}
+
+	total := 0
+	for name, weight := range c.BalanceWeights {
+		if !names[name] {
+			errs = append(errs, fmt.Errorf("BALANCE_WEIGHTS: %q is not a configured provider", name))
+		}
+		if weight < 0 {
+			errs = append(errs, fmt.Errorf("BALANCE_WEIGHTS: weight of %s must not be negative, got %d", name, weight))
+		}
+		total += weight
+	}
+	if len(c.BalanceWeights) > 0 && total <= 0 {
+		errs = append(errs, errors.New("BALANCE_WEIGHTS: weights must not all be zero"))
+	}
+
+	switch {
+	case c.DefaultProvider == "" || names[c.DefaultProvider]:
+	case c.DefaultProvider == "brevo":
+		errs = append(errs, errors.New("BREVO_API_KEY: required when DEFAULT_PROVIDER is brevo"))
+	default:
+		errs = append(errs, fmt.Errorf("DEFAULT_PROVIDER: %q is not a configured provider", c.DefaultProvider))
+	}
+	return errs
+}
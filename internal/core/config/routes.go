@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// RouteConfig is a routing rule that sends matching messages to Provider.
+// Rules are evaluated in order and the first match wins.
+type RouteConfig struct {
+	Name     string     `yaml:"name"`
+	Match    RouteMatch `yaml:"match"`
+	Provider string     `yaml:"provider"`
+}
+
+// RouteMatch lists the criteria a message must all meet to match a rule
+type RouteMatch struct {
+	Users            []string          `yaml:"users"`
+	SenderDomains    []string          `yaml:"sender_domains"`
+	RecipientDomains []string          `yaml:"recipient_domains"`
+	Headers          map[string]string `yaml:"headers"`
+	MinSize          int64             `yaml:"min_size"`
+	MaxSize          int64             `yaml:"max_size"`
+	HasAttachments   *bool             `yaml:"has_attachments"`
+}
+
+// UnmarshalYAML rejects unknown keys, which plain decoding silently ignores
+func (r *RouteConfig) UnmarshalYAML(node *yaml.Node) error {
+	type plain RouteConfig
+	return decodeStrict(node, (*plain)(r))
+}
+
+// UnmarshalYAML rejects unknown keys, which plain decoding silently ignores
+func (m *RouteMatch) UnmarshalYAML(node *yaml.Node) error {
+	type plain RouteMatch
+	return decodeStrict(node, (*plain)(m))
+}
+
+// validateRoutes checks that every rule sends to a configured provider
+func (c *Config) validateRoutes() []error {
+	var errs []error
+	names := c.providerNames()
+	for i, route := range c.Routes {
+		invalid := func(format string, args ...any) {
+			errs = append(errs, fmt.Errorf("routes[%d]: %s", i, fmt.Sprintf(format, args...)))
+		}
+
+		switch {
+		case route.Provider == "":
+			invalid("provider is required")
+		case !names[route.Provider]:
+			invalid("provider %q is not a configured provider", route.Provider)
+		}
+		if route.Match.MinSize < 0 || route.Match.MaxSize < 0 {
+			invalid("sizes must not be negative")
+		}
+		if route.Match.MaxSize > 0 && route.Match.MinSize > route.Match.MaxSize {
+			invalid("min_size %d exceeds max_size %d", route.Match.MinSize, route.Match.MaxSize)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/itsLeonB/smtproxy/internal/core/secrets"
+)
+
+// secretFields returns the fields tagged secret, in declaration order
+func secretFields(cfg *Config) []fileField {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	var fields []fileField
+	for i := range t.NumField() {
+		tag := t.Field(i).Tag
+		if tag.Get("secret") == "true" {
+			fields = append(fields, fileField{env: tag.Get("envconfig"), value: v.Field(i), secret: true})
+		}
+	}
+	return fields
+}
+
+// applySecretFiles reads secrets from the files named by *_FILE variables,
+// as mounted by Docker and Kubernetes secrets
+func applySecretFiles(cfg *Config) error {
+	var errs []error
+	for _, field := range secretFields(cfg) {
+		path, set := os.LookupEnv(field.env + "_FILE")
+		if !set {
+			continue
+		}
+		if _, set := os.LookupEnv(field.env); set {
+			errs = append(errs, fmt.Errorf("%s and %s_FILE are both set", field.env, field.env))
+			continue
+		}
+
+		value, err := secrets.ReadFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s_FILE: %w", field.env, err))
+			continue
+		}
+		if err := setSecret(field.value, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s_FILE: %w", field.env, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setSecret stores a secret read from a file. Maps such as AUTH_USERS take
+// key:value pairs separated by commas or newlines.
+func setSecret(field reflect.Value, value string) error {
+	switch field.Interface().(type) {
+	case string:
+		field.SetString(value)
+	case map[string]string:
+		pairs := make(map[string]string)
+		for _, pair := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+			key, val, found := strings.Cut(strings.TrimSpace(pair), ":")
+			if !found {
+				return fmt.Errorf("invalid map item %q, expected key:value", pair)
+			}
+			pairs[key] = val
+		}
+		field.Set(reflect.ValueOf(pairs))
+	default:
+		return fmt.Errorf("unsupported secret type %s", field.Type())
+	}
+	return nil
+}
+
+// resolveSecrets replaces file://, env:// and vault:// references in secret
+// fields and provider API keys with the values they point to
+func resolveSecrets(cfg *Config) error {
+	ctx := context.Background()
+	resolvers := secrets.New()
+
+	// The Vault token itself can only come from a file or the environment
+	token, err := resolvers.Resolve(ctx, cfg.VaultToken)
+	if err != nil {
+		return fmt.Errorf("VAULT_TOKEN: %w", err)
+	}
+	cfg.VaultToken = token
+	resolvers.Register(secrets.SchemeVault, secrets.NewVault(secrets.VaultConfig{
+		Addr:      cfg.VaultAddr,
+		Token:     cfg.VaultToken,
+		Namespace: cfg.VaultNamespace,
+	}))
+
+	var errs []error
+	resolve := func(name string, value *string) {
+		resolved, err := resolvers.Resolve(ctx, *value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			return
+		}
+		*value = resolved
+	}
+
+	for _, field := range secretFields(cfg) {
+		if field.env == "VAULT_TOKEN" {
+			continue
+		}
+		switch value := field.value.Addr().Interface().(type) {
+		case *string:
+			resolve(field.env, value)
+		case *map[string]string:
+			for key, secret := range *value {
+				resolve(fmt.Sprintf("%s[%s]", field.env, key), &secret)
+				(*value)[key] = secret
+			}
+		}
+	}
+	for i := range cfg.Providers {
+		resolve(fmt.Sprintf("providers[%d].api_key", i), &cfg.Providers[i].APIKey)
+		resolve(fmt.Sprintf("providers[%d].webhook_token", i), &cfg.Providers[i].WebhookToken)
+	}
+
+	return errors.Join(errs...)
+}
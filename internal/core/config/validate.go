@@ -0,0 +1,174 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Validate reports every invalid setting at once, naming each by its
+// environment variable
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(name, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", name, fmt.Sprintf(format, args...)))
+	}
+
+	if port, err := strconv.Atoi(c.SMTPPort); err != nil || port < 1 || port > 65535 {
+		invalid("SMTP_PORT", "%q is not a port number between 1 and 65535", c.SMTPPort)
+	}
+	switch strings.ToLower(c.LogLevel) {
+	case "", "debug", "info", "warn", "warning", "error":
+	default:
+		invalid("LOG_LEVEL", "unknown level %q, expected debug, info, warn or error", c.LogLevel)
+	}
+	switch c.LogFormat {
+	case "", "text", "json":
+	default:
+		invalid("LOG_FORMAT", "unknown format %q, expected text or json", c.LogFormat)
+	}
+	if c.MaxSize <= 0 {
+		invalid("MAX_MESSAGE_SIZE", "must be positive, got %d", c.MaxSize)
+	}
+
+	for name, entries := range map[string][]string{
+		"CLIENT_ALLOW":                    c.ClientAllow,
+		"CLIENT_DENY":                     c.ClientDeny,
+		"TRUSTED_NETWORKS":                c.TrustedNetworks,
+		"PROXY_PROTOCOL_TRUSTED_NETWORKS": c.ProxyProtocolTrusted,
+		"BREVO_WEBHOOK_ALLOWED_NETWORKS":  c.BrevoWebhookNetworks,
+	} {
+		for _, entry := range entries {
+			if !validNetwork(entry) {
+				invalid(name, "%q is not a CIDR range or IP address", entry)
+			}
+		}
+	}
+	if c.ProxyProtocol && len(c.ProxyProtocolTrusted) == 0 {
+		invalid("PROXY_PROTOCOL_TRUSTED_NETWORKS", "required when PROXY_PROTOCOL is enabled")
+	}
+
+	for name, value := range map[string]int{
+		"MAX_CONNECTIONS":              c.MaxConnections,
+		"MAX_CONNECTIONS_PER_IP":       c.MaxConnectionsPerIP,
+		"CONNECTION_RATE_PER_MINUTE":   c.ConnectionsPerMinute,
+		"MESSAGE_RATE_PER_MINUTE":      c.MessagesPerMinute,
+		"USER_MESSAGE_RATE_PER_MINUTE": c.UserMessagesPerMinute,
+		"AUTH_MAX_FAILURES":            c.AuthMaxFailures,
+		"CIRCUIT_BREAKER_THRESHOLD":    c.CircuitBreakerThreshold,
+	} {
+		if value < 0 {
+			invalid(name, "must not be negative, got %d", value)
+		}
+	}
+
+	for name, value := range map[string]time.Duration{
+		"AUTH_CREDENTIALS_RELOAD_INTERVAL": c.AuthCredentialsReload,
+		"AUTH_LOCKOUT_DURATION":            c.AuthLockout,
+		"AUTH_FAILURE_DELAY":               c.AuthFailureDelay,
+		"AUDIT_RETENTION":                  c.AuditRetention,
+		"DISPATCH_TIMEOUT":                 c.DispatchTimeout,
+		"PROVIDER_RATE_LIMIT_WAIT":         c.ProviderRateLimitWait,
+		"DSN_DELAY_AFTER":                  c.DSNDelayAfter,
+	} {
+		if value < 0 {
+			invalid(name, "must not be negative, got %s", value)
+		}
+	}
+	for name, value := range map[string]time.Duration{
+		"SHUTDOWN_TIMEOUT": c.ShutdownTimeout,
+		"BREVO_TIMEOUT":    c.BrevoTimeout,
+	} {
+		if value <= 0 {
+			invalid(name, "must be positive, got %s", value)
+		}
+	}
+
+	if c.QueueEnabled {
+		if c.QueueWorkers < 1 {
+			invalid("QUEUE_WORKERS", "must be at least 1 when the queue is enabled, got %d", c.QueueWorkers)
+		}
+		if c.QueueCapacity < 1 {
+			invalid("QUEUE_CAPACITY", "must be at least 1 when the queue is enabled, got %d", c.QueueCapacity)
+		}
+		if c.QueueRetryInterval <= 0 {
+			invalid("QUEUE_RETRY_INTERVAL", "must be positive, got %s", c.QueueRetryInterval)
+		}
+		if c.QueueMaxAge <= 0 {
+			invalid("QUEUE_MAX_AGE", "must be positive, got %s", c.QueueMaxAge)
+		}
+		// Bounces go out through the providers, which refuse unverified senders
+		if c.DSNEnabled {
+			if c.DSNSender == "" {
+				invalid("DSN_SENDER", "required when the queue and DSN_ENABLED are enabled")
+			} else if _, err := mail.ParseAddress(c.DSNSender); err != nil {
+				invalid("DSN_SENDER", "%q is not an email address", c.DSNSender)
+			}
+		}
+	}
+
+	if c.BrevoRateLimit < 0 {
+		invalid("BREVO_RATE_LIMIT", "must not be negative, got %g", c.BrevoRateLimit)
+	}
+	if c.CircuitBreakerThreshold > 0 {
+		if c.CircuitBreakerCooldown <= 0 {
+			invalid("CIRCUIT_BREAKER_COOLDOWN", "must be positive, got %s", c.CircuitBreakerCooldown)
+		}
+		if c.CircuitBreakerProbes < 1 {
+			invalid("CIRCUIT_BREAKER_PROBES", "must be at least 1, got %d", c.CircuitBreakerProbes)
+		}
+	}
+
+	if c.SuppressionDBPath != "" && !slices.Contains([]string{"reject", "drop", "tag"}, c.SuppressionMode) {
+		invalid("SUPPRESSION_MODE", "must be reject, drop or tag, got %q", c.SuppressionMode)
+	}
+
+	if c.WebhooksEnabled() && c.HTTPAddr == "" {
+		invalid("HTTP_ADDR", "required to receive Brevo webhooks")
+	}
+	if c.WebhookForwardURL != "" {
+		if u, err := url.Parse(c.WebhookForwardURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("WEBHOOK_FORWARD_URL", "%q is not an http or https URL", c.WebhookForwardURL)
+		}
+		if !c.WebhooksEnabled() {
+			invalid("WEBHOOK_FORWARD_URL", "requires BREVO_WEBHOOK_TOKEN, BREVO_WEBHOOK_ALLOWED_NETWORKS or a provider webhook_token")
+		}
+		if c.WebhookForwardTimeout <= 0 {
+			invalid("WEBHOOK_FORWARD_TIMEOUT", "must be positive, got %s", c.WebhookForwardTimeout)
+		}
+	}
+
+	errs = append(errs, c.validateProviders()...)
+	errs = append(errs, c.validateRoutes()...)
+	errs = append(errs, c.validatePolicies()...)
+
+	sortErrors(errs)
+	return errors.Join(errs...)
+}
+
+// validNetwork reports whether entry is a CIDR range or single address
+func validNetwork(entry string) bool {
+	entry = strings.TrimSpace(entry)
+	if entry == "" {
+		return true
+	}
+	if strings.Contains(entry, "/") {
+		_, err := netip.ParsePrefix(entry)
+		return err == nil
+	}
+	_, err := netip.ParseAddr(entry)
+	return err == nil
+}
+
+// sortErrors orders errors by message so that map iteration doesn't shuffle output
+func sortErrors(errs []error) {
+	slices.SortStableFunc(errs, func(a, b error) int {
+		return strings.Compare(a.Error(), b.Error())
+	})
+}
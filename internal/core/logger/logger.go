@@ -1,69 +1,238 @@
 package logger
 
-import "github.com/itsLeonB/ezutil/v2"
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
 
-var Global ezutil.Logger
+	"github.com/itsLeonB/smtproxy/internal/core/requestctx"
+)
 
+// Output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Options configures the global logger
+type Options struct {
+	// Level is one of debug, info, warn or error
+	Level string
+	// Format is FormatText or FormatJSON
+	Format string
+	// Redact masks email addresses and subjects in log output
+	Redact bool
+	// Output defaults to stdout
+	Output io.Writer
+}
+
+var global atomic.Pointer[slog.Logger]
+
+func init() {
+	global.Store(slog.New(slog.NewTextHandler(os.Stdout, nil)))
+}
+
+// Init installs a text logger at info level tagged with appNamespace.
+// Configure replaces it once the configuration has been loaded.
 func Init(appNamespace string) {
-	Global = ezutil.NewSimpleLogger(appNamespace, true, 0)
+	_ = Configure(appNamespace, Options{})
 }
 
-func Debug(args ...any) {
-	if Global != nil {
-		Global.Debug(args...)
+// Configure replaces the global logger according to opts
+func Configure(appNamespace string, opts Options) error {
+	level, err := parseLevel(opts.Level)
+	if err != nil {
+		return err
+	}
+
+	output := opts.Output
+	if output == nil {
+		output = os.Stdout
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	if opts.Redact {
+		handlerOpts.ReplaceAttr = redactAttr
+	}
+
+	var handler slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "", FormatText:
+		handler = slog.NewTextHandler(output, handlerOpts)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(output, handlerOpts)
+	default:
+		return fmt.Errorf("unknown log format %q", opts.Format)
+	}
+
+	logger := slog.New(contextHandler{handler})
+	if appNamespace != "" {
+		logger = logger.With("app", appNamespace)
 	}
+	global.Store(logger)
+	return nil
 }
 
-func Info(args ...any) {
-	if Global != nil {
-		Global.Info(args...)
+// parseLevel converts a LOG_LEVEL value to a slog level, defaulting to info
+func parseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q", level)
 	}
 }
 
-func Warn(args ...any) {
-	if Global != nil {
-		Global.Warn(args...)
+// contextHandler adds the request identifiers carried by the context to every record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	// A slice rather than a map so that the fields always appear in this order
+	for _, field := range []struct{ key, value string }{
+		{"session_id", requestctx.SessionID(ctx)},
+		{"message_id", requestctx.MessageID(ctx)},
+		{"remote_ip", requestctx.RemoteIP(ctx)},
+		{"user", requestctx.User(ctx)},
+	} {
+		if field.value != "" {
+			r.AddAttrs(slog.String(field.key, field.value))
+		}
 	}
+	return h.Handler.Handle(ctx, r)
 }
 
-func Error(args ...any) {
-	if Global != nil {
-		Global.Error(args...)
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// emailPattern matches email addresses inside log messages and values
+var emailPattern = regexp.MustCompile(`[^\s<>"'(),;:@]+@([A-Za-z0-9.-]+\.[A-Za-z]{2,}|[^\s<>"'(),;:@]+)`)
+
+// redactedKeys are attributes whose whole value is hidden when redacting
+var redactedKeys = map[string]bool{
+	"subject": true,
+}
+
+// redactAttr masks subjects and the local part of email addresses
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if redactedKeys[a.Key] {
+		return slog.String(a.Key, "[redacted]")
+	}
+	if a.Value.Kind() == slog.KindString || a.Value.Kind() == slog.KindAny {
+		if value := a.Value.String(); strings.Contains(value, "@") {
+			return slog.String(a.Key, RedactAddresses(value))
+		}
 	}
+	return a
 }
 
-func Fatal(args ...any) {
-	if Global != nil {
-		Global.Fatal(args...)
+// RedactAddresses replaces the local part of every email address in s
+func RedactAddresses(s string) string {
+	return emailPattern.ReplaceAllStringFunc(s, func(address string) string {
+		at := strings.LastIndex(address, "@")
+		return "***" + address[at:]
+	})
+}
+
+// log writes a record unless level is disabled
+func log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	logger := global.Load()
+	if !logger.Enabled(ctx, level) {
+		return
 	}
+	logger.Log(ctx, level, msg, args...)
 }
 
-func Debugf(format string, args ...any) {
-	if Global != nil {
-		Global.Debugf(format, args...)
+// logf formats and writes a record unless level is disabled
+func logf(level slog.Level, format string, args ...any) {
+	logger := global.Load()
+	if !logger.Enabled(context.Background(), level) {
+		return
 	}
+	logger.Log(context.Background(), level, fmt.Sprintf(format, args...))
+}
+
+// DebugContext logs msg with key-value pairs and the request identifiers in ctx
+func DebugContext(ctx context.Context, msg string, args ...any) {
+	log(ctx, slog.LevelDebug, msg, args...)
+}
+
+// InfoContext logs msg with key-value pairs and the request identifiers in ctx
+func InfoContext(ctx context.Context, msg string, args ...any) {
+	log(ctx, slog.LevelInfo, msg, args...)
+}
+
+// WarnContext logs msg with key-value pairs and the request identifiers in ctx
+func WarnContext(ctx context.Context, msg string, args ...any) {
+	log(ctx, slog.LevelWarn, msg, args...)
+}
+
+// ErrorContext logs msg with key-value pairs and the request identifiers in ctx
+func ErrorContext(ctx context.Context, msg string, args ...any) {
+	log(ctx, slog.LevelError, msg, args...)
+}
+
+// Latency returns a log attribute with the time elapsed since start
+func Latency(start time.Time) slog.Attr {
+	return slog.Duration("latency", time.Since(start))
+}
+
+func Debug(args ...any) {
+	logf(slog.LevelDebug, "%s", fmt.Sprint(args...))
+}
+
+func Info(args ...any) {
+	logf(slog.LevelInfo, "%s", fmt.Sprint(args...))
+}
+
+func Warn(args ...any) {
+	logf(slog.LevelWarn, "%s", fmt.Sprint(args...))
+}
+
+func Error(args ...any) {
+	logf(slog.LevelError, "%s", fmt.Sprint(args...))
+}
+
+func Fatal(args ...any) {
+	logf(slog.LevelError, "%s", fmt.Sprint(args...))
+	os.Exit(1)
+}
+
+func Debugf(format string, args ...any) {
+	logf(slog.LevelDebug, format, args...)
 }
 
 func Infof(format string, args ...any) {
-	if Global != nil {
-		Global.Infof(format, args...)
-	}
+	logf(slog.LevelInfo, format, args...)
 }
 
 func Warnf(format string, args ...any) {
-	if Global != nil {
-		Global.Warnf(format, args...)
-	}
+	logf(slog.LevelWarn, format, args...)
 }
 
 func Errorf(format string, args ...any) {
-	if Global != nil {
-		Global.Errorf(format, args...)
-	}
+	logf(slog.LevelError, format, args...)
 }
 
 func Fatalf(format string, args ...any) {
-	if Global != nil {
-		Global.Fatalf(format, args...)
-	}
+	logf(slog.LevelError, format, args...)
+	os.Exit(1)
 }
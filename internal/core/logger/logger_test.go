@@ -0,0 +1,105 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/itsLeonB/smtproxy/internal/core/requestctx"
+	"github.com/stretchr/testify/assert"
+)
+
+func configure(t *testing.T, opts Options) *bytes.Buffer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	opts.Output = buf
+	assert.NoError(t, Configure("test", opts))
+	t.Cleanup(func() { Init("") })
+	return buf
+}
+
+func decode(t *testing.T, buf *bytes.Buffer) map[string]any {
+	t.Helper()
+	var record map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	return record
+}
+
+func TestConfigure_InvalidOptions(t *testing.T) {
+	assert.Error(t, Configure("test", Options{Level: "verbose"}))
+	assert.Error(t, Configure("test", Options{Format: "xml"}))
+}
+
+func TestLevel(t *testing.T) {
+	buf := configure(t, Options{Level: "warn", Format: FormatJSON})
+
+	Infof("hidden %d", 1)
+	assert.Empty(t, buf.String())
+
+	Warnf("shown %d", 2)
+	record := decode(t, buf)
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, "shown 2", record["msg"])
+	assert.Equal(t, "test", record["app"])
+}
+
+func TestContextFields(t *testing.T) {
+	buf := configure(t, Options{Format: FormatJSON})
+
+	ctx := requestctx.WithSessionID(context.Background(), "s1")
+	ctx = requestctx.WithMessageID(ctx, "m1")
+	ctx = requestctx.WithRemoteIP(ctx, "192.0.2.1")
+	ctx = requestctx.WithUser(ctx, "alice")
+	InfoContext(ctx, "email dispatched", "provider", "brevo")
+
+	record := decode(t, buf)
+	assert.Equal(t, "s1", record["session_id"])
+	assert.Equal(t, "m1", record["message_id"])
+	assert.Equal(t, "192.0.2.1", record["remote_ip"])
+	assert.Equal(t, "alice", record["user"])
+	assert.Equal(t, "brevo", record["provider"])
+}
+
+func TestContextFields_Order(t *testing.T) {
+	buf := configure(t, Options{})
+
+	ctx := requestctx.WithUser(context.Background(), "alice")
+	ctx = requestctx.WithRemoteIP(ctx, "192.0.2.1")
+	ctx = requestctx.WithMessageID(ctx, "m1")
+	ctx = requestctx.WithSessionID(ctx, "s1")
+	for range 10 {
+		InfoContext(ctx, "email dispatched")
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		assert.Contains(t, line, "session_id=s1 message_id=m1 remote_ip=192.0.2.1 user=alice")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	buf := configure(t, Options{Format: FormatJSON, Redact: true})
+
+	InfoContext(context.Background(), "sending to bob@example.com", "from", "alice@example.org", "subject", "Quarterly results")
+
+	record := decode(t, buf)
+	assert.Equal(t, "sending to ***@example.com", record["msg"])
+	assert.Equal(t, "***@example.org", record["from"])
+	assert.Equal(t, "[redacted]", record["subject"])
+}
+
+func TestNoRedactByDefault(t *testing.T) {
+	buf := configure(t, Options{Format: FormatJSON})
+
+	InfoContext(context.Background(), "queued", "from", "alice@example.org", "subject", "Hello")
+
+	record := decode(t, buf)
+	assert.Equal(t, "alice@example.org", record["from"])
+	assert.Equal(t, "Hello", record["subject"])
+}
+
+func TestRedactAddresses(t *testing.T) {
+	assert.Equal(t, "rcpt <***@example.com>, ***@b.org", RedactAddresses("rcpt <bob@example.com>, a.b+c@b.org"))
+	assert.Equal(t, "no address here", RedactAddresses("no address here"))
+}
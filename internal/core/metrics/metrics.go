@@ -0,0 +1,154 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "smtproxy"
+
+// Registry holds every smtproxy metric plus Go runtime and process collectors
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	// SessionsActive is the number of SMTP sessions currently open
+	SessionsActive = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sessions_active",
+		Help:      "Number of SMTP sessions currently open.",
+	})
+
+	// ConnectionsRejected counts sessions refused before EHLO completed, by reason
+	ConnectionsRejected = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "connections_rejected_total",
+		Help:      "SMTP sessions rejected, by reason.",
+	}, []string{"reason"})
+
+	// RateLimited counts messages refused by a rate limit, by scope (ip or user)
+	RateLimited = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Messages rejected by a rate limit, by scope.",
+	}, []string{"scope"})
+
+	// AuthFailures counts failed SMTP AUTH attempts
+	AuthFailures = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_failures_total",
+		Help:      "Failed SMTP AUTH attempts.",
+	})
+
+	// AuthLockouts counts client addresses temporarily banned after repeated AUTH failures
+	AuthLockouts = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_lockouts_total",
+		Help:      "Client addresses banned after repeated AUTH failures.",
+	})
+
+	// BalancerSelections counts sends assigned to each provider by weighted balancing
+	BalancerSelections = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "balancer_selections_total",
+		Help:      "Sends assigned to a provider by weighted balancing, by provider.",
+	}, []string{"provider"})
+
+	// BalancerTrafficShare is each provider's fraction of the balanced sends since the weights were loaded
+	BalancerTrafficShare = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "balancer_traffic_share",
+		Help:      "Fraction of balanced sends assigned to a provider since the weights were loaded, by provider.",
+	}, []string{"provider"})
+
+	// CircuitState is each provider's circuit breaker state: 0 closed, 1 half-open, 2 open
+	CircuitState = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "circuit_state",
+		Help:      "Circuit breaker state by provider (0 closed, 1 half-open, 2 open).",
+	}, []string{"provider"})
+
+	// CircuitTransitions counts circuit breaker state changes, by provider and new state
+	CircuitTransitions = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "circuit_transitions_total",
+		Help:      "Circuit breaker state changes, by provider and new state.",
+	}, []string{"provider", "state"})
+
+	// CircuitRejections counts sends refused or failed over because a provider's circuit was open
+	CircuitRejections = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "circuit_rejections_total",
+		Help:      "Sends refused or failed over while a provider's circuit was open, by provider.",
+	}, []string{"provider"})
+
+	// ProviderThrottled counts sends held back by a provider's rate limit, by
+	// provider and outcome (waited or rejected)
+	ProviderThrottled = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_throttled_total",
+		Help:      "Sends held back by a provider rate limit, by provider and outcome (waited or rejected).",
+	}, []string{"provider", "outcome"})
+
+	// ProviderQuotaRemaining is the quota left in a provider's current rate limit window, as last reported by the provider
+	ProviderQuotaRemaining = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "provider_quota_remaining",
+		Help:      "Requests left in the provider's current rate limit window, as last reported by the provider.",
+	}, []string{"provider"})
+
+	// WebhookEvents counts delivery events received from provider webhooks,
+	// by provider, event type and whether they matched an audited message
+	WebhookEvents = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_events_total",
+		Help:      "Delivery events received from provider webhooks, by provider, type and outcome (matched or unmatched).",
+	}, []string{"provider", "type", "outcome"})
+
+	// WebhookRejected counts webhook requests refused, by provider and reason
+	WebhookRejected = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_rejected_total",
+		Help:      "Webhook requests refused, by provider and reason (forbidden, unauthorized or invalid).",
+	}, []string{"provider", "reason"})
+
+	// EventForwards counts batches of delivery events forwarded to the
+	// callback URL, by outcome
+	EventForwards = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "event_forwards_total",
+		Help:      "Batches of delivery events forwarded to the callback URL, by outcome (success or failure).",
+	}, []string{"outcome"})
+
+	// SuppressedRecipients counts recipients found on the suppression list,
+	// by action (rejected, dropped or tagged)
+	SuppressedRecipients = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "suppressed_recipients_total",
+		Help:      "Recipients found on the suppression list, by action (rejected, dropped or tagged).",
+	}, []string{"action"})
+
+	// Limits reports the configured limits, where 0 means unlimited
+	Limits = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "limit",
+		Help:      "Configured connection, rate and lockout limits (0 means unlimited).",
+	}, []string{"name"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
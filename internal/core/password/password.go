@@ -0,0 +1,121 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported hashing schemes
+const (
+	SchemeBcrypt      = "bcrypt"
+	SchemeArgon2id    = "argon2id"
+	SchemeSHA512Crypt = "sha512-crypt"
+)
+
+// argon2id parameters for newly generated hashes (RFC 9106 second recommendation)
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+)
+
+// ErrUnknownScheme is returned when hashing with an unsupported scheme
+var ErrUnknownScheme = errors.New("unknown password scheme")
+
+// Hash encodes plain with the given scheme in its standard crypt(3)-style format
+func Hash(scheme, plain string) (string, error) {
+	switch scheme {
+	case SchemeBcrypt, "":
+		hash, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	case SchemeArgon2id:
+		salt := make([]byte, argon2SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(plain), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, argon2Memory, argon2Time, argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key)), nil
+	case SchemeSHA512Crypt:
+		salt := make([]byte, sha512SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		for i := range salt {
+			salt[i] = cryptAlphabet[int(salt[i])%len(cryptAlphabet)]
+		}
+		return sha512Crypt([]byte(plain), string(salt), sha512DefaultRounds, false), nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownScheme, scheme)
+	}
+}
+
+// Verify reports whether plain matches encoded. Values without a recognised
+// hash prefix are treated as plaintext and compared in constant time.
+func Verify(encoded, plain string) bool {
+	switch {
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(plain)) == nil
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return verifyArgon2id(encoded, plain)
+	case strings.HasPrefix(encoded, "$6$"):
+		return verifySHA512Crypt(encoded, plain)
+	default:
+		return subtle.ConstantTimeCompare([]byte(encoded), []byte(plain)) == 1
+	}
+}
+
+// IsHashed reports whether encoded uses one of the supported hash formats
+func IsHashed(encoded string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$", "$argon2id$", "$6$"} {
+		if strings.HasPrefix(encoded, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyArgon2id checks a PHC-formatted argon2id hash
+func verifyArgon2id(encoded, plain string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false
+	}
+
+	computed := argon2.IDKey([]byte(plain), salt, time, memory, threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, computed) == 1
+}
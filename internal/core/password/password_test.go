@@ -0,0 +1,65 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashAndVerify(t *testing.T) {
+	for _, scheme := range []string{SchemeBcrypt, SchemeArgon2id, SchemeSHA512Crypt} {
+		t.Run(scheme, func(t *testing.T) {
+			hash, err := Hash(scheme, "s3cret")
+			assert.NoError(t, err)
+			assert.True(t, IsHashed(hash))
+
+			assert.True(t, Verify(hash, "s3cret"))
+			assert.False(t, Verify(hash, "wrong"))
+		})
+	}
+}
+
+func TestHash_UnknownScheme(t *testing.T) {
+	_, err := Hash("md5", "s3cret")
+	assert.ErrorIs(t, err, ErrUnknownScheme)
+}
+
+func TestVerify_Plaintext(t *testing.T) {
+	assert.True(t, Verify("pass1", "pass1"))
+	assert.False(t, Verify("pass1", "pass2"))
+	assert.False(t, IsHashed("pass1"))
+}
+
+func TestVerify_SHA512CryptVectors(t *testing.T) {
+	// Test vectors from Drepper's specification
+	tests := []struct {
+		hash  string
+		plain string
+	}{
+		{
+			hash:  "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1",
+			plain: "Hello world!",
+		},
+		{
+			hash:  "$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.",
+			plain: "Hello world!",
+		},
+		{
+			hash:  "$6$rounds=1400$anotherlongsalts$POfYwTEok97VWcjxIiSOjiykti.o/pQs.wPvMxQ6Fm7I6IoYN3CmLs66x9t0oSwbtEW7o7UmJEiDwGqd8p4ur1",
+			plain: "a very much longer text to encrypt.  This one even stretches over morethan one line.",
+		},
+	}
+
+	for _, tt := range tests {
+		assert.True(t, Verify(tt.hash, tt.plain), tt.hash)
+		assert.False(t, Verify(tt.hash, tt.plain+"x"), tt.hash)
+	}
+}
+
+func TestVerify_MalformedHashes(t *testing.T) {
+	assert.False(t, Verify("$argon2id$v=19$broken", "s3cret"))
+	assert.False(t, Verify("$6$rounds=abc$salt$hash", "s3cret"))
+	assert.False(t, Verify("$2a$10$short", "s3cret"))
+	assert.False(t, Verify(strings.Repeat("$", 3), "s3cret"))
+}
@@ -0,0 +1,170 @@
+package password
+
+import (
+	"crypto/sha512"
+	"crypto/subtle"
+	"strconv"
+	"strings"
+)
+
+// SHA-512-crypt as specified by Ulrich Drepper ("Unix crypt using SHA-256 and SHA-512")
+const (
+	sha512SaltLen       = 16
+	sha512DefaultRounds = 5000
+	sha512MinRounds     = 1000
+	sha512MaxRounds     = 999999999
+	cryptAlphabet       = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+// verifySHA512Crypt checks a "$6$[rounds=N$]salt$hash" value
+func verifySHA512Crypt(encoded, plain string) bool {
+	rest := strings.TrimPrefix(encoded, "$6$")
+
+	rounds := sha512DefaultRounds
+	explicitRounds := false
+	if strings.HasPrefix(rest, "rounds=") {
+		end := strings.IndexByte(rest, '$')
+		if end < 0 {
+			return false
+		}
+		n, err := strconv.Atoi(rest[len("rounds="):end])
+		if err != nil {
+			return false
+		}
+		rounds = n
+		explicitRounds = true
+		rest = rest[end+1:]
+	}
+
+	end := strings.LastIndexByte(rest, '$')
+	if end < 0 {
+		return false
+	}
+
+	computed := sha512Crypt([]byte(plain), rest[:end], rounds, explicitRounds)
+	return subtle.ConstantTimeCompare([]byte(encoded), []byte(computed)) == 1
+}
+
+// sha512Crypt computes the full encoded SHA-512-crypt string
+func sha512Crypt(key []byte, salt string, rounds int, explicitRounds bool) string {
+	if len(salt) > sha512SaltLen {
+		salt = salt[:sha512SaltLen]
+	}
+	if rounds < sha512MinRounds {
+		rounds = sha512MinRounds
+	}
+	if rounds > sha512MaxRounds {
+		rounds = sha512MaxRounds
+	}
+	saltBytes := []byte(salt)
+
+	// Digest B
+	b := sha512.New()
+	b.Write(key)
+	b.Write(saltBytes)
+	b.Write(key)
+	digestB := b.Sum(nil)
+
+	// Digest A
+	a := sha512.New()
+	a.Write(key)
+	a.Write(saltBytes)
+	for i := len(key); i > 0; i -= 64 {
+		if i > 64 {
+			a.Write(digestB)
+		} else {
+			a.Write(digestB[:i])
+		}
+	}
+	for i := len(key); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			a.Write(digestB)
+		} else {
+			a.Write(key)
+		}
+	}
+	digestA := a.Sum(nil)
+
+	// Digest DP and sequence P
+	dp := sha512.New()
+	for range key {
+		dp.Write(key)
+	}
+	p := repeatDigest(dp.Sum(nil), len(key))
+
+	// Digest DS and sequence S
+	ds := sha512.New()
+	for i := 0; i < 16+int(digestA[0]); i++ {
+		ds.Write(saltBytes)
+	}
+	s := repeatDigest(ds.Sum(nil), len(saltBytes))
+
+	// Rounds
+	c := digestA
+	for i := 0; i < rounds; i++ {
+		h := sha512.New()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(s)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(p)
+		}
+		c = h.Sum(nil)
+	}
+
+	var out strings.Builder
+	out.WriteString("$6$")
+	if explicitRounds {
+		out.WriteString("rounds=" + strconv.Itoa(rounds) + "$")
+	}
+	out.WriteString(salt)
+	out.WriteByte('$')
+	out.WriteString(encodeSHA512(c))
+	return out.String()
+}
+
+// repeatDigest fills a sequence of length n with copies of digest
+func repeatDigest(digest []byte, n int) []byte {
+	seq := make([]byte, 0, n)
+	for len(seq)+len(digest) <= n {
+		seq = append(seq, digest...)
+	}
+	return append(seq, digest[:n-len(seq)]...)
+}
+
+// sha512Order is the byte permutation used when base64-encoding the final digest
+var sha512Order = [...][3]int{
+	{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4},
+	{47, 5, 26}, {6, 27, 48}, {28, 49, 7}, {50, 8, 29}, {9, 30, 51},
+	{31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13}, {56, 14, 35},
+	{15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19},
+	{62, 20, 41},
+}
+
+// encodeSHA512 applies the crypt-specific base64 encoding to a 64-byte digest
+func encodeSHA512(digest []byte) string {
+	var out strings.Builder
+	encode := func(b2, b1, b0 byte, n int) {
+		w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+		for ; n > 0; n-- {
+			out.WriteByte(cryptAlphabet[w&0x3f])
+			w >>= 6
+		}
+	}
+
+	for _, idx := range sha512Order {
+		encode(digest[idx[0]], digest[idx[1]], digest[idx[2]], 4)
+	}
+	encode(0, 0, digest[63], 2)
+	return out.String()
+}
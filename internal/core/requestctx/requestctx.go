@@ -0,0 +1,70 @@
+// Package requestctx carries SMTP session and message identifiers, the client
+// address and the authenticated user through a context so that dispatchers,
+// providers and logs can correlate their work.
+package requestctx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+type contextKey int
+
+const (
+	sessionIDKey contextKey = iota
+	messageIDKey
+	remoteIPKey
+	userKey
+)
+
+// NewID generates a random identifier for a session or message
+func NewID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithSessionID returns a copy of ctx carrying the SMTP session ID
+func WithSessionID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, sessionIDKey, id)
+}
+
+// SessionID returns the SMTP session ID carried by ctx, or ""
+func SessionID(ctx context.Context) string {
+	id, _ := ctx.Value(sessionIDKey).(string)
+	return id
+}
+
+// WithMessageID returns a copy of ctx carrying the message ID
+func WithMessageID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, messageIDKey, id)
+}
+
+// MessageID returns the message ID carried by ctx, or ""
+func MessageID(ctx context.Context) string {
+	id, _ := ctx.Value(messageIDKey).(string)
+	return id
+}
+
+// WithRemoteIP returns a copy of ctx carrying the SMTP client address
+func WithRemoteIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, remoteIPKey, ip)
+}
+
+// RemoteIP returns the SMTP client address carried by ctx, or ""
+func RemoteIP(ctx context.Context) string {
+	ip, _ := ctx.Value(remoteIPKey).(string)
+	return ip
+}
+
+// WithUser returns a copy of ctx carrying the authenticated SMTP user
+func WithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userKey, user)
+}
+
+// User returns the authenticated SMTP user carried by ctx, or ""
+func User(ctx context.Context) string {
+	user, _ := ctx.Value(userKey).(string)
+	return user
+}
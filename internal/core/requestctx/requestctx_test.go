@@ -0,0 +1,36 @@
+package requestctx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIDs(t *testing.T) {
+	ctx := context.Background()
+	assert.Empty(t, SessionID(ctx))
+	assert.Empty(t, MessageID(ctx))
+
+	ctx = WithSessionID(ctx, "session-1")
+	ctx = WithMessageID(ctx, "message-1")
+	assert.Equal(t, "session-1", SessionID(ctx))
+	assert.Equal(t, "message-1", MessageID(ctx))
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	assert.Empty(t, RemoteIP(ctx))
+	assert.Empty(t, User(ctx))
+
+	ctx = WithRemoteIP(ctx, "192.0.2.1")
+	ctx = WithUser(ctx, "alice")
+	assert.Equal(t, "192.0.2.1", RemoteIP(ctx))
+	assert.Equal(t, "alice", User(ctx))
+}
+
+func TestNewID(t *testing.T) {
+	id := NewID()
+	assert.Len(t, id, 16)
+	assert.NotEqual(t, id, NewID())
+}
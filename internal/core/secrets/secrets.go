@@ -0,0 +1,98 @@
+// Package secrets resolves secret references such as file:///run/secrets/key,
+// env://NAME or vault://secret/data/app#key into their values.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Supported reference schemes
+const (
+	SchemeFile  = "file"
+	SchemeEnv   = "env"
+	SchemeVault = "vault"
+)
+
+// Resolver looks up the secret a reference points to. ref is the part of
+// the reference after "scheme://".
+type Resolver interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// ResolverFunc adapts a function to the Resolver interface
+type ResolverFunc func(ctx context.Context, ref string) (string, error)
+
+// Resolve calls f
+func (f ResolverFunc) Resolve(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+// Resolvers dispatches references to the resolver registered for their scheme
+type Resolvers struct {
+	schemes map[string]Resolver
+}
+
+// New creates resolvers for the file and env schemes
+func New() *Resolvers {
+	return &Resolvers{
+		schemes: map[string]Resolver{
+			SchemeFile: ResolverFunc(resolveFile),
+			SchemeEnv:  ResolverFunc(resolveEnv),
+		},
+	}
+}
+
+// Register makes references with scheme resolve through resolver
+func (r *Resolvers) Register(scheme string, resolver Resolver) {
+	r.schemes[scheme] = resolver
+}
+
+// Resolve returns the secret value references point to. Values without a
+// registered scheme are returned unchanged, so plain secrets keep working.
+func (r *Resolvers) Resolve(ctx context.Context, value string) (string, error) {
+	scheme, ref, found := strings.Cut(value, "://")
+	if !found {
+		return value, nil
+	}
+	resolver, exists := r.schemes[scheme]
+	if !exists {
+		return value, nil
+	}
+
+	secret, err := resolver.Resolve(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s:// secret: %w", scheme, err)
+	}
+	return secret, nil
+}
+
+// ReadFile reads a secret file, dropping the trailing newline editors and
+// secret mounts usually add
+func ReadFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// resolveFile reads file:///absolute/path or file://relative/path
+func resolveFile(_ context.Context, path string) (string, error) {
+	if path == "" {
+		return "", errors.New("missing file path")
+	}
+	return ReadFile(path)
+}
+
+// resolveEnv reads env://NAME, which must be set
+func resolveEnv(_ context.Context, name string) (string, error) {
+	value, found := os.LookupEnv(name)
+	if !found {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
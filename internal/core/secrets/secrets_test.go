@@ -0,0 +1,60 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolvers_Literal(t *testing.T) {
+	resolvers := New()
+
+	for _, value := range []string{"", "plain-secret", "https://example.com/not-a-reference"} {
+		secret, err := resolvers.Resolve(context.Background(), value)
+		assert.NoError(t, err)
+		assert.Equal(t, value, secret)
+	}
+}
+
+func TestResolvers_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api_key")
+	assert.NoError(t, os.WriteFile(path, []byte("s3cret\n"), 0o600))
+
+	secret, err := New().Resolve(context.Background(), "file://"+path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", secret)
+}
+
+func TestResolvers_FileMissing(t *testing.T) {
+	_, err := New().Resolve(context.Background(), "file://"+filepath.Join(t.TempDir(), "missing"))
+
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestResolvers_Env(t *testing.T) {
+	t.Setenv("SMTPROXY_TEST_SECRET", "s3cret")
+	resolvers := New()
+
+	secret, err := resolvers.Resolve(context.Background(), "env://SMTPROXY_TEST_SECRET")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", secret)
+
+	_, err = resolvers.Resolve(context.Background(), "env://SMTPROXY_TEST_UNSET")
+	assert.ErrorContains(t, err, "SMTPROXY_TEST_UNSET is not set")
+}
+
+func TestResolvers_Register(t *testing.T) {
+	resolvers := New()
+	resolvers.Register("test", ResolverFunc(func(ctx context.Context, ref string) (string, error) {
+		return "resolved " + ref, nil
+	}))
+
+	secret, err := resolvers.Resolve(context.Background(), "test://key")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "resolved key", secret)
+}
@@ -0,0 +1,130 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultVaultTimeout bounds each request to Vault
+	defaultVaultTimeout = 10 * time.Second
+	// maxVaultResponseSize caps how much of a Vault response is read
+	maxVaultResponseSize = 1 << 20 // 1MB
+)
+
+// VaultConfig locates a Vault server and authenticates to it
+type VaultConfig struct {
+	Addr      string
+	Token     string
+	Namespace string
+	Timeout   time.Duration
+}
+
+// Vault resolves vault://<path>#<key> references, such as
+// vault://secret/data/smtproxy#brevo_api_key, from a KV version 1 or 2
+// secrets engine over the HTTP API. Each path is fetched once per Vault.
+type Vault struct {
+	config VaultConfig
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]map[string]any
+}
+
+// NewVault creates a Vault resolver
+func NewVault(config VaultConfig) *Vault {
+	if config.Timeout <= 0 {
+		config.Timeout = defaultVaultTimeout
+	}
+	return &Vault{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+		cache:  make(map[string]map[string]any),
+	}
+}
+
+// Resolve returns the key of the secret at path in ref
+func (v *Vault) Resolve(ctx context.Context, ref string) (string, error) {
+	path, key, found := strings.Cut(ref, "#")
+	path = strings.Trim(path, "/")
+	if !found || path == "" || key == "" {
+		return "", fmt.Errorf("reference %q must have the form vault://<path>#<key>", ref)
+	}
+
+	data, err := v.read(ctx, path)
+	if err != nil {
+		return "", err
+	}
+
+	value, exists := data[key]
+	if !exists {
+		return "", fmt.Errorf("secret %s has no key %q", path, key)
+	}
+	secret, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("secret %s key %q is not a string", path, key)
+	}
+	return secret, nil
+}
+
+// read fetches the key/value pairs of the secret at path
+func (v *Vault) read(ctx context.Context, path string) (map[string]any, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if data, cached := v.cache[path]; cached {
+		return data, nil
+	}
+	if v.config.Addr == "" {
+		return nil, errors.New("VAULT_ADDR is not set")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(v.config.Addr, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", v.config.Token)
+	if v.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.config.Namespace)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret %s: %w", path, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("secret %s not found", path)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("failed to read secret %s: vault returned %s", path, resp.Status)
+	}
+
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxVaultResponseSize)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode secret %s: %w", path, err)
+	}
+
+	// KV version 2 nests the pairs under data.data next to data.metadata
+	data := body.Data
+	if nested, ok := data["data"].(map[string]any); ok {
+		if _, versioned := data["metadata"]; versioned {
+			data = nested
+		}
+	}
+
+	v.cache[path] = data
+	return data, nil
+}
@@ -0,0 +1,88 @@
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeVault serves KV secrets at /v1/<path> to requests with the right token
+func fakeVault(t *testing.T, secrets map[string]string) (*httptest.Server, *int) {
+	t.Helper()
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		body, exists := secrets[r.URL.Path]
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestVault_KVv2(t *testing.T) {
+	server, requests := fakeVault(t, map[string]string{
+		"/v1/secret/data/smtproxy": `{"data":{"data":{"brevo_api_key":"xkeysib","admin_token":"t0k3n"},"metadata":{"version":3}}}`,
+	})
+	vault := NewVault(VaultConfig{Addr: server.URL, Token: "root"})
+
+	apiKey, err := vault.Resolve(context.Background(), "secret/data/smtproxy#brevo_api_key")
+	assert.NoError(t, err)
+	assert.Equal(t, "xkeysib", apiKey)
+
+	token, err := vault.Resolve(context.Background(), "secret/data/smtproxy#admin_token")
+	assert.NoError(t, err)
+	assert.Equal(t, "t0k3n", token)
+	assert.Equal(t, 1, *requests)
+}
+
+func TestVault_KVv1(t *testing.T) {
+	server, _ := fakeVault(t, map[string]string{
+		"/v1/kv/smtproxy": `{"data":{"brevo_api_key":"xkeysib"}}`,
+	})
+	resolvers := New()
+	resolvers.Register(SchemeVault, NewVault(VaultConfig{Addr: server.URL, Token: "root"}))
+
+	secret, err := resolvers.Resolve(context.Background(), "vault://kv/smtproxy#brevo_api_key")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "xkeysib", secret)
+}
+
+func TestVault_Errors(t *testing.T) {
+	server, _ := fakeVault(t, map[string]string{
+		"/v1/kv/smtproxy": `{"data":{"port":25}}`,
+	})
+
+	tests := []struct {
+		name   string
+		config VaultConfig
+		ref    string
+		want   string
+	}{
+		{name: "missing key", config: VaultConfig{Addr: server.URL, Token: "root"}, ref: "kv/smtproxy", want: "must have the form"},
+		{name: "unknown key", config: VaultConfig{Addr: server.URL, Token: "root"}, ref: "kv/smtproxy#api_key", want: `has no key "api_key"`},
+		{name: "not a string", config: VaultConfig{Addr: server.URL, Token: "root"}, ref: "kv/smtproxy#port", want: "is not a string"},
+		{name: "not found", config: VaultConfig{Addr: server.URL, Token: "root"}, ref: "kv/other#api_key", want: "secret kv/other not found"},
+		{name: "forbidden", config: VaultConfig{Addr: server.URL, Token: "wrong"}, ref: "kv/smtproxy#port", want: "403 Forbidden"},
+		{name: "no address", config: VaultConfig{Token: "root"}, ref: "kv/smtproxy#port", want: "VAULT_ADDR is not set"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewVault(tt.config).Resolve(context.Background(), tt.ref)
+			assert.ErrorContains(t, err, tt.want)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		_ = provider.Shutdown(context.Background())
+	})
+	return exporter
+}
+
+func TestTransport(t *testing.T) {
+	exporter := recordSpans(t)
+
+	var traceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	ctx, parent := Start(context.Background(), "parent")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, upstream.URL+"/smtp/email", nil)
+	assert.NoError(t, err)
+
+	client := &http.Client{Transport: Transport(nil)}
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	_ = resp.Body.Close()
+	parent.End()
+
+	assert.Empty(t, req.Header.Get("traceparent"), "caller's request must not be modified")
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 2)
+	httpSpan := spans[0]
+	assert.Equal(t, "HTTP POST", httpSpan.Name)
+	assert.Equal(t, trace.SpanKindClient, httpSpan.SpanKind)
+	assert.Equal(t, parent.SpanContext().SpanID(), httpSpan.Parent.SpanID())
+	assert.Equal(t, codes.Error, httpSpan.Status.Code)
+	assert.Contains(t, httpSpan.Attributes, attribute.Int("http.response.status_code", http.StatusServiceUnavailable))
+
+	// The upstream sees the client span as the parent of its work
+	assert.Contains(t, traceparent, httpSpan.SpanContext.TraceID().String())
+	assert.Contains(t, traceparent, httpSpan.SpanContext.SpanID().String())
+}
+
+func TestTransport_Error(t *testing.T) {
+	exporter := recordSpans(t)
+
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	upstream.Close()
+
+	client := &http.Client{Transport: Transport(nil)}
+	_, err := client.Get(upstream.URL)
+	assert.Error(t, err)
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.NotEmpty(t, spans[0].Events, "error should be recorded")
+}
+
+func TestEnd(t *testing.T) {
+	exporter := recordSpans(t)
+
+	_, ok := Start(context.Background(), "ok")
+	End(ok, nil)
+	_, failed := Start(context.Background(), "failed")
+	End(failed, errors.New("boom"))
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, codes.Unset, spans[0].Status.Code)
+	assert.Equal(t, codes.Error, spans[1].Status.Code)
+	assert.Equal(t, "boom", spans[1].Status.Description)
+}
@@ -1,18 +1,19 @@
 package entity
 
 import (
-	"io"
 	"net/mail"
 	"time"
 )
 
 // Email represents a normalized email message
 type Email struct {
+	Envelope    Envelope
 	Headers     Headers
 	TextBody    string
 	HTMLBody    string
 	Attachments []Attachment
 	RawSize     int64
+	Raw         []byte // original message, kept only when a full DSN return is requested
 }
 
 // Headers contains normalized email headers
@@ -26,6 +27,30 @@ type Headers struct {
 	MessageID   string
 	ContentType string
 	Custom      map[string][]string
+	Raw         map[string][]string
+}
+
+// Envelope holds the SMTP transaction addresses, which may differ from the headers
+type Envelope struct {
+	From string
+	To   []string
+	UTF8 bool // client used SMTPUTF8 (RFC 6531)
+
+	// DSN parameters from MAIL FROM and RCPT TO (RFC 3461)
+	Return     string
+	EnvelopeID string
+	Recipients map[string]RecipientParams
+}
+
+// RecipientParams holds the DSN parameters given for a single recipient
+type RecipientParams struct {
+	Notify            []string
+	OriginalRecipient string
+}
+
+// IsNullSender reports whether the envelope has the null reverse-path used by notifications
+func (e Envelope) IsNullSender() bool {
+	return e.From == "" || e.From == "<>"
 }
 
 // Attachment represents an email attachment
@@ -33,5 +58,6 @@ type Attachment struct {
 	Filename    string
 	ContentType string
 	Size        int64
-	Content     io.Reader
+	// Content is kept in memory so that every delivery attempt can read it
+	Content []byte
 }
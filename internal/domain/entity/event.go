@@ -0,0 +1,34 @@
+package entity
+
+import "time"
+
+// EventType is the normalized kind of a provider delivery event
+type EventType string
+
+const (
+	EventDelivered    EventType = "delivered"
+	EventDeferred     EventType = "deferred"
+	EventBounced      EventType = "bounced"
+	EventRejected     EventType = "rejected"
+	EventComplained   EventType = "complained"
+	EventOpened       EventType = "opened"
+	EventClicked      EventType = "clicked"
+	EventUnsubscribed EventType = "unsubscribed"
+)
+
+// DeliveryEvent is a provider's report of what happened to a message after
+// it accepted it, normalized across providers
+type DeliveryEvent struct {
+	Type EventType `json:"type"`
+	// Provider is the type of provider that reported the event, e.g. brevo
+	Provider string `json:"provider"`
+	// MessageID is the ID the provider assigned to the message when sending it
+	MessageID string    `json:"message_id"`
+	Recipient string    `json:"recipient,omitempty"`
+	At        time.Time `json:"at"`
+	// Permanent marks a bounce that retrying won't fix
+	Permanent bool   `json:"permanent,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	// URL is the link followed by a click
+	URL string `json:"url,omitempty"`
+}
@@ -0,0 +1,301 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/core/logger"
+	"github.com/itsLeonB/smtproxy/internal/core/requestctx"
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+)
+
+// ErrNotFound is returned by a Store when no record has the given ID
+var ErrNotFound = errors.New("audit record not found")
+
+// Status is the current outcome of an accepted message
+type Status string
+
+const (
+	StatusAccepted  Status = "accepted"
+	StatusQueued    Status = "queued"
+	StatusDelivered Status = "delivered"
+	StatusFailed    Status = "failed"
+	// StatusBounced is a message the provider accepted but could not deliver
+	StatusBounced Status = "bounced"
+	// StatusSuppressed is a message not sent because every recipient is suppressed
+	StatusSuppressed Status = "suppressed"
+)
+
+// Attempt is a single provider delivery attempt
+type Attempt struct {
+	At         time.Time `json:"at"`
+	Provider   string    `json:"provider"`
+	MessageID  string    `json:"message_id,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Record is the history of one message received through DATA
+type Record struct {
+	ID          string     `json:"id"`
+	SessionID   string     `json:"session_id,omitempty"`
+	ReceivedAt  time.Time  `json:"received_at"`
+	User        string     `json:"user,omitempty"`
+	RemoteIP    string     `json:"remote_ip,omitempty"`
+	From        string     `json:"from"`
+	To          []string   `json:"to"`
+	Subject     string     `json:"subject"`
+	Size        int64      `json:"size"`
+	Attempts    []Attempt  `json:"attempts"`
+	Status      Status     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	// Events are the delivery events providers reported after accepting the message
+	Events []entity.DeliveryEvent `json:"events,omitempty"`
+	// Suppressed are the recipients found on the suppression list
+	Suppressed []string `json:"suppressed,omitempty"`
+}
+
+// ProviderMessageIDs returns the IDs providers assigned to the message
+func (r *Record) ProviderMessageIDs() []string {
+	var ids []string
+	for _, attempt := range r.Attempts {
+		if attempt.MessageID != "" {
+			ids = append(ids, attempt.MessageID)
+		}
+	}
+	return ids
+}
+
+// Query selects records. Empty fields match everything.
+type Query struct {
+	ID        string
+	Sender    string
+	Recipient string
+	Since     time.Time
+	Until     time.Time
+	// ProviderMessageID matches the ID a provider assigned to the message
+	ProviderMessageID string
+	// Limit caps the number of records returned, newest first
+	Limit int
+}
+
+// Matches reports whether r satisfies every criterion in q
+func (q Query) Matches(r *Record) bool {
+	if q.ID != "" && r.ID != q.ID {
+		return false
+	}
+	if q.ProviderMessageID != "" && !slices.Contains(r.ProviderMessageIDs(), q.ProviderMessageID) {
+		return false
+	}
+	if q.Sender != "" && !strings.EqualFold(r.From, q.Sender) {
+		return false
+	}
+	if q.Recipient != "" && !containsFold(r.To, q.Recipient) {
+		return false
+	}
+	if !q.Since.IsZero() && r.ReceivedAt.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && r.ReceivedAt.After(q.Until) {
+		return false
+	}
+	return true
+}
+
+func containsFold(values []string, target string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Store persists audit records
+type Store interface {
+	Put(r *Record) error
+	// Update applies fn to the stored record and saves it, or returns ErrNotFound
+	Update(id string, fn func(r *Record)) error
+	Search(q Query) ([]*Record, error)
+	// Prune deletes records received before cutoff and returns how many were removed
+	Prune(cutoff time.Time) (int, error)
+	Close() error
+}
+
+// Trail records message history in a Store. Storage errors are logged rather
+// than returned so that auditing never affects delivery.
+type Trail struct {
+	store     Store
+	retention time.Duration
+	now       func() time.Time
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewTrail creates a trail that keeps records for retention; zero keeps them forever
+func NewTrail(store Store, retention time.Duration) *Trail {
+	return &Trail{
+		store:     store,
+		retention: retention,
+		now:       time.Now,
+		stop:      make(chan struct{}),
+	}
+}
+
+// Accepted records a message received in the session carried by ctx
+func (t *Trail) Accepted(ctx context.Context, email *entity.Email, size int64, status Status) {
+	record := &Record{
+		ID:         requestctx.MessageID(ctx),
+		SessionID:  requestctx.SessionID(ctx),
+		ReceivedAt: t.now().UTC(),
+		User:       requestctx.User(ctx),
+		RemoteIP:   requestctx.RemoteIP(ctx),
+		From:       email.Envelope.From,
+		To:         append([]string(nil), email.Envelope.To...),
+		Subject:    email.Headers.Subject,
+		Size:       size,
+		Attempts:   []Attempt{},
+		Status:     status,
+	}
+	if record.ID == "" {
+		return
+	}
+	if err := t.store.Put(record); err != nil {
+		logger.ErrorContext(ctx, "failed to write audit record", "error", err)
+	}
+}
+
+// Attempt records a provider call for the message carried by ctx that began
+// at start. messageID is the ID the provider assigned to the message, if any.
+func (t *Trail) Attempt(ctx context.Context, provider, messageID string, start time.Time, err error) {
+	id := requestctx.MessageID(ctx)
+	if id == "" {
+		return
+	}
+
+	attempt := Attempt{
+		At:         start.UTC(),
+		Provider:   provider,
+		MessageID:  messageID,
+		DurationMS: t.now().Sub(start).Milliseconds(),
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	t.update(id, func(r *Record) {
+		r.Attempts = append(r.Attempts, attempt)
+	})
+}
+
+// Suppressed records the recipients of the message carried by ctx that are
+// on the suppression list
+func (t *Trail) Suppressed(ctx context.Context, addresses []string) {
+	id := requestctx.MessageID(ctx)
+	if id == "" || len(addresses) == 0 {
+		return
+	}
+	t.update(id, func(r *Record) {
+		r.Suppressed = append([]string(nil), addresses...)
+	})
+}
+
+// Complete records the final outcome of message id
+func (t *Trail) Complete(id string, status Status, err error) {
+	completedAt := t.now().UTC()
+	t.update(id, func(r *Record) {
+		r.Status = status
+		r.CompletedAt = &completedAt
+		if err != nil {
+			r.Error = err.Error()
+		}
+	})
+}
+
+// Event adds a delivery event to the record of the message the provider
+// assigned e.MessageID to, and reports whether there was one. A permanent
+// bounce or a rejection marks the message bounced. Events the provider
+// delivers again are recorded once.
+func (t *Trail) Event(ctx context.Context, e entity.DeliveryEvent) bool {
+	records, err := t.store.Search(Query{ProviderMessageID: e.MessageID, Limit: 1})
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to look up audit record", "provider_message_id", e.MessageID, "error", err)
+		return false
+	}
+	if len(records) == 0 {
+		return false
+	}
+
+	t.update(records[0].ID, func(r *Record) {
+		if slices.ContainsFunc(r.Events, func(recorded entity.DeliveryEvent) bool {
+			return recorded.Type == e.Type && recorded.Recipient == e.Recipient && recorded.At.Equal(e.At)
+		}) {
+			return
+		}
+		r.Events = append(r.Events, e)
+		if e.Type == entity.EventRejected || e.Type == entity.EventBounced && e.Permanent {
+			r.Status = StatusBounced
+			r.Error = e.Reason
+		}
+	})
+	return true
+}
+
+func (t *Trail) update(id string, fn func(r *Record)) {
+	if err := t.store.Update(id, fn); err != nil {
+		logger.Errorf("failed to update audit record %s: %v", id, err)
+	}
+}
+
+// Search returns the records matching q, newest first
+func (t *Trail) Search(q Query) ([]*Record, error) {
+	return t.store.Search(q)
+}
+
+// Start prunes expired records now and then hourly until Stop
+func (t *Trail) Start() {
+	if t.retention <= 0 {
+		return
+	}
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			t.prune()
+			select {
+			case <-ticker.C:
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends pruning and closes the store
+func (t *Trail) Stop() {
+	close(t.stop)
+	t.wg.Wait()
+	if err := t.store.Close(); err != nil {
+		logger.Errorf("failed to close audit store: %v", err)
+	}
+}
+
+func (t *Trail) prune() {
+	removed, err := t.store.Prune(t.now().Add(-t.retention))
+	if err != nil {
+		logger.Errorf("failed to prune audit records: %v", err)
+		return
+	}
+	if removed > 0 {
+		logger.Infof("pruned %d audit record(s) older than %s", removed, t.retention)
+	}
+}
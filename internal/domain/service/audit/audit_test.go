@@ -0,0 +1,193 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/core/requestctx"
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryStore keeps records in a map
+type memoryStore struct {
+	records map[string]*Record
+	closed  bool
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{records: make(map[string]*Record)}
+}
+
+func (m *memoryStore) Put(r *Record) error {
+	m.records[r.ID] = r
+	return nil
+}
+
+func (m *memoryStore) Update(id string, fn func(r *Record)) error {
+	r, exists := m.records[id]
+	if !exists {
+		return ErrNotFound
+	}
+	fn(r)
+	return nil
+}
+
+func (m *memoryStore) Search(q Query) ([]*Record, error) {
+	var results []*Record
+	for _, r := range m.records {
+		if q.Matches(r) {
+			results = append(results, r)
+		}
+	}
+	return results, nil
+}
+
+func (m *memoryStore) Prune(cutoff time.Time) (int, error) {
+	removed := 0
+	for id, r := range m.records {
+		if r.ReceivedAt.Before(cutoff) {
+			delete(m.records, id)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (m *memoryStore) Close() error {
+	m.closed = true
+	return nil
+}
+
+func testEmail() *entity.Email {
+	return &entity.Email{
+		Headers:  entity.Headers{Subject: "Invoice"},
+		Envelope: entity.Envelope{From: "app@example.com", To: []string{"bob@example.org"}},
+	}
+}
+
+func TestTrail_History(t *testing.T) {
+	store := newMemoryStore()
+	trail := NewTrail(store, 0)
+
+	ctx := requestctx.WithSessionID(context.Background(), "s1")
+	ctx = requestctx.WithMessageID(ctx, "m1")
+	ctx = requestctx.WithUser(ctx, "alice")
+	ctx = requestctx.WithRemoteIP(ctx, "192.0.2.1")
+
+	trail.Accepted(ctx, testEmail(), 42, StatusQueued)
+	trail.Attempt(ctx, "brevo", "", time.Now(), errors.New("503 unavailable"))
+	trail.Attempt(ctx, "brevo", "<abc@smtp-relay.mailin.fr>", time.Now(), nil)
+	trail.Complete("m1", StatusDelivered, nil)
+
+	r := store.records["m1"]
+	assert.NotNil(t, r)
+	assert.Equal(t, "s1", r.SessionID)
+	assert.Equal(t, "alice", r.User)
+	assert.Equal(t, "192.0.2.1", r.RemoteIP)
+	assert.Equal(t, "app@example.com", r.From)
+	assert.Equal(t, []string{"bob@example.org"}, r.To)
+	assert.Equal(t, "Invoice", r.Subject)
+	assert.Equal(t, int64(42), r.Size)
+	assert.Equal(t, StatusDelivered, r.Status)
+	assert.NotNil(t, r.CompletedAt)
+	assert.Len(t, r.Attempts, 2)
+	assert.Equal(t, "503 unavailable", r.Attempts[0].Error)
+	assert.Empty(t, r.Attempts[1].Error)
+	assert.Empty(t, r.Attempts[0].MessageID)
+	assert.Equal(t, "<abc@smtp-relay.mailin.fr>", r.Attempts[1].MessageID)
+}
+
+func TestTrail_IgnoresContextWithoutMessageID(t *testing.T) {
+	store := newMemoryStore()
+	trail := NewTrail(store, 0)
+
+	trail.Accepted(context.Background(), testEmail(), 1, StatusAccepted)
+	trail.Attempt(context.Background(), "brevo", "", time.Now(), nil)
+
+	assert.Empty(t, store.records)
+}
+
+func TestTrail_Event(t *testing.T) {
+	store := newMemoryStore()
+	trail := NewTrail(store, 0)
+	ctx := requestctx.WithMessageID(context.Background(), "m1")
+	trail.Accepted(ctx, testEmail(), 42, StatusAccepted)
+	trail.Attempt(ctx, "brevo", "<p1@example.com>", time.Now(), nil)
+	trail.Complete("m1", StatusDelivered, nil)
+
+	opened := entity.DeliveryEvent{Type: entity.EventOpened, MessageID: "<p1@example.com>", At: time.Now()}
+	assert.True(t, trail.Event(ctx, opened))
+	assert.Equal(t, StatusDelivered, store.records["m1"].Status)
+	// A redelivered webhook doesn't duplicate the event
+	assert.True(t, trail.Event(ctx, opened))
+
+	assert.True(t, trail.Event(ctx, entity.DeliveryEvent{Type: entity.EventBounced, MessageID: "<p1@example.com>", Permanent: true, Reason: "mailbox unavailable"}))
+	r := store.records["m1"]
+	assert.Len(t, r.Events, 2)
+	assert.Equal(t, StatusBounced, r.Status)
+	assert.Equal(t, "mailbox unavailable", r.Error)
+
+	assert.False(t, trail.Event(ctx, entity.DeliveryEvent{Type: entity.EventDelivered, MessageID: "<unknown@example.com>"}))
+}
+
+func TestTrail_Suppressed(t *testing.T) {
+	store := newMemoryStore()
+	trail := NewTrail(store, 0)
+	ctx := requestctx.WithMessageID(context.Background(), "m1")
+
+	trail.Accepted(ctx, testEmail(), 42, StatusSuppressed)
+	trail.Suppressed(ctx, []string{"bob@example.org"})
+	trail.Complete("m1", StatusSuppressed, nil)
+
+	r := store.records["m1"]
+	assert.Equal(t, []string{"bob@example.org"}, r.Suppressed)
+	assert.Equal(t, StatusSuppressed, r.Status)
+	assert.Empty(t, r.Error)
+}
+
+func TestTrail_Prune(t *testing.T) {
+	store := newMemoryStore()
+	trail := NewTrail(store, time.Hour)
+	now := time.Now()
+	store.records["old"] = &Record{ID: "old", ReceivedAt: now.Add(-2 * time.Hour)}
+	store.records["new"] = &Record{ID: "new", ReceivedAt: now}
+
+	trail.Start()
+	trail.Stop()
+
+	assert.NotContains(t, store.records, "old")
+	assert.Contains(t, store.records, "new")
+	assert.True(t, store.closed)
+}
+
+func TestQuery_Matches(t *testing.T) {
+	received := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	r := &Record{ID: "m1", From: "App@Example.com", To: []string{"a@example.org", "b@example.org"}, ReceivedAt: received, Attempts: []Attempt{{MessageID: "<p1@example.com>"}}}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  bool
+	}{
+		{"empty", Query{}, true},
+		{"id", Query{ID: "m1"}, true},
+		{"other id", Query{ID: "m2"}, false},
+		{"provider message id", Query{ProviderMessageID: "<p1@example.com>"}, true},
+		{"other provider message id", Query{ProviderMessageID: "<p2@example.com>"}, false},
+		{"sender case-insensitive", Query{Sender: "app@example.com"}, true},
+		{"other sender", Query{Sender: "x@example.com"}, false},
+		{"recipient", Query{Recipient: "B@example.org"}, true},
+		{"other recipient", Query{Recipient: "c@example.org"}, false},
+		{"in range", Query{Since: received.Add(-time.Minute), Until: received.Add(time.Minute)}, true},
+		{"before range", Query{Since: received.Add(time.Minute)}, false},
+		{"after range", Query{Until: received.Add(-time.Minute)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.query.Matches(r))
+		})
+	}
+}
@@ -2,45 +2,106 @@ package dispatcher
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync/atomic"
+	"time"
 
 	"github.com/itsLeonB/smtproxy/internal/core/logger"
+	"github.com/itsLeonB/smtproxy/internal/core/tracing"
 	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/audit"
 	"github.com/itsLeonB/smtproxy/internal/domain/service/provider"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 // Dispatcher handles the core email dispatch flow
 type Dispatcher struct {
-	registry *provider.Registry
+	// registry is swapped on configuration reloads while dispatches are running
+	registry atomic.Pointer[provider.Registry]
+	audit    *audit.Trail
 }
 
 // NewDispatcher creates a new email dispatcher
 func NewDispatcher(registry *provider.Registry) *Dispatcher {
-	return &Dispatcher{
-		registry: registry,
-	}
+	d := &Dispatcher{}
+	d.registry.Store(registry)
+	return d
+}
+
+// Registry returns the registry new dispatches are sent through
+func (d *Dispatcher) Registry() *provider.Registry {
+	return d.registry.Load()
+}
+
+// SetRegistry atomically replaces the registry. Dispatches already running
+// finish with the previous one.
+func (d *Dispatcher) SetRegistry(registry *provider.Registry) {
+	d.registry.Store(registry)
+}
+
+// SetAudit records every provider attempt in trail
+func (d *Dispatcher) SetAudit(trail *audit.Trail) {
+	d.audit = trail
 }
 
-// Dispatch sends an email through the provider system
-func (d *Dispatcher) Dispatch(ctx context.Context, email *entity.Email, providerName string) error {
+// Dispatch sends an email through the provider system and returns the
+// provider's message ID, which is empty if the provider assigns none
+func (d *Dispatcher) Dispatch(ctx context.Context, email *entity.Email, providerName string) (string, error) {
+	ctx, span := tracing.Start(ctx, "dispatcher.dispatch")
+	defer span.End()
+
 	// Log send attempt
 	if providerName != "" {
-		logger.Infof("dispatching email to provider: %s", providerName)
+		logger.InfoContext(ctx, "dispatching email", "provider", providerName, "subject", email.Headers.Subject)
 	} else {
-		logger.Info("dispatching email to default provider")
+		logger.InfoContext(ctx, "dispatching email to default provider", "subject", email.Headers.Subject)
 	}
 
 	// Send via registry
-	result, err := d.registry.Send(ctx, email, providerName)
+	start := time.Now()
+	result, err := d.registry.Load().Send(ctx, email, providerName)
+	if d.audit != nil {
+		d.audit.Attempt(ctx, result.ProviderName, result.MessageID, start, err)
+	}
+	span.SetAttributes(attribute.String("provider", result.ProviderName))
 
 	// Log result
 	if err != nil {
-		logger.Errorf("email dispatch failed - provider: %s, error: %v", result.ProviderName, err)
-		return d.translateError(err)
+		logger.ErrorContext(ctx, "email dispatch failed", "provider", result.ProviderName, logger.Latency(start), "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return "", d.translateError(err)
 	}
 
-	logger.Infof("email dispatched successfully - provider: %s", result.ProviderName)
-	return nil
+	logger.InfoContext(ctx, "email dispatched", "provider", result.ProviderName, "provider_message_id", result.MessageID, logger.Latency(start))
+	return result.MessageID, nil
+}
+
+// Error is a delivery failure expressed as an SMTP reply
+type Error struct {
+	Code         int
+	EnhancedCode [3]int // optional RFC 3463 code; derived from Code when zero
+	Message      string
+	// RetryAfter is how long the provider asked to wait before retrying, if it did
+	RetryAfter time.Duration
+}
+
+// Error returns the reply in "<code> <message>" form
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s", e.Code, e.Message)
+}
+
+// Permanent reports whether retrying the delivery cannot succeed
+func (e *Error) Permanent() bool {
+	return e.Code >= 500
+}
+
+// IsPermanent reports whether err is a permanent delivery failure
+func IsPermanent(err error) bool {
+	var dispatchErr *Error
+	return errors.As(err, &dispatchErr) && dispatchErr.Permanent()
 }
 
 // translateError converts provider errors to SMTP errors
@@ -49,22 +110,42 @@ func (d *Dispatcher) translateError(err error) error {
 		return nil
 	}
 
+	if errors.Is(err, provider.ErrEAIUnsupported) {
+		return &Error{Code: 553, EnhancedCode: [3]int{5, 6, 7}, Message: "Provider does not support internationalized addresses"}
+	}
+	if errors.Is(err, provider.ErrInvalidDomain) {
+		return &Error{Code: 553, EnhancedCode: [3]int{5, 1, 3}, Message: "Invalid domain in address"}
+	}
+	if errors.Is(err, provider.ErrCircuitOpen) {
+		return &Error{Code: 451, EnhancedCode: [3]int{4, 4, 1}, Message: "Provider unavailable, try again later"}
+	}
+	if wait := provider.RetryAfter(err); wait > 0 {
+		// Round up so that retrying after the hint is never too early
+		seconds := int((wait + time.Second - 1) / time.Second)
+		return &Error{
+			Code:         451,
+			EnhancedCode: [3]int{4, 7, 0},
+			Message:      fmt.Sprintf("Rate limit exceeded, try again in %d seconds", seconds),
+			RetryAfter:   time.Duration(seconds) * time.Second,
+		}
+	}
+
 	// Map common provider errors to SMTP-friendly messages
 	errMsg := err.Error()
 
 	switch {
 	case contains(errMsg, "authentication", "unauthorized", "invalid key", "forbidden"):
-		return fmt.Errorf("550 Authentication failed")
+		return &Error{Code: 550, Message: "Authentication failed"}
 	case contains(errMsg, "rate limit", "quota", "throttle"):
-		return fmt.Errorf("451 Rate limit exceeded, try again later")
+		return &Error{Code: 451, Message: "Rate limit exceeded, try again later"}
 	case contains(errMsg, "invalid email", "invalid recipient", "bad address"):
-		return fmt.Errorf("550 Invalid recipient address")
+		return &Error{Code: 550, Message: "Invalid recipient address"}
 	case contains(errMsg, "timeout", "deadline"):
-		return fmt.Errorf("451 Timeout occurred, try again later")
+		return &Error{Code: 451, Message: "Timeout occurred, try again later"}
 	case contains(errMsg, "service unavailable", "maintenance"):
-		return fmt.Errorf("451 Service temporarily unavailable")
+		return &Error{Code: 451, Message: "Service temporarily unavailable"}
 	default:
-		return fmt.Errorf("451 Temporary failure: %s", errMsg)
+		return &Error{Code: 451, Message: "Temporary failure: " + errMsg}
 	}
 }
 
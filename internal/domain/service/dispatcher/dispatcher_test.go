@@ -3,7 +3,9 @@ package dispatcher
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/itsLeonB/smtproxy/internal/domain/entity"
 	"github.com/itsLeonB/smtproxy/internal/domain/service/provider"
@@ -13,14 +15,16 @@ import (
 func TestDispatcher_Dispatch_Success(t *testing.T) {
 	registry := provider.NewRegistry()
 	mockProvider := provider.NewMockProvider("test-provider")
+	mockProvider.SetMessageID("<abc@example.com>")
 	_ = registry.Register(mockProvider)
 
 	dispatcher := NewDispatcher(registry)
 
 	email := &entity.Email{}
 
-	err := dispatcher.Dispatch(context.Background(), email, "")
+	messageID, err := dispatcher.Dispatch(context.Background(), email, "")
 	assert.NoError(t, err)
+	assert.Equal(t, "<abc@example.com>", messageID)
 }
 
 func TestDispatcher_Dispatch_SpecificProvider(t *testing.T) {
@@ -32,7 +36,7 @@ func TestDispatcher_Dispatch_SpecificProvider(t *testing.T) {
 
 	email := &entity.Email{}
 
-	err := dispatcher.Dispatch(context.Background(), email, "specific-provider")
+	_, err := dispatcher.Dispatch(context.Background(), email, "specific-provider")
 	assert.NoError(t, err)
 }
 
@@ -46,7 +50,7 @@ func TestDispatcher_Dispatch_ProviderError(t *testing.T) {
 
 	email := &entity.Email{}
 
-	err := dispatcher.Dispatch(context.Background(), email, "")
+	_, err := dispatcher.Dispatch(context.Background(), email, "")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "451 Temporary failure")
 }
@@ -104,3 +108,66 @@ func TestDispatcher_TranslateError_Generic(t *testing.T) {
 
 	assert.Contains(t, translated.Error(), "451 Temporary failure")
 }
+
+func TestIsPermanent(t *testing.T) {
+	dispatcher := NewDispatcher(nil)
+
+	assert.True(t, IsPermanent(dispatcher.translateError(errors.New("invalid email address"))))
+	assert.False(t, IsPermanent(dispatcher.translateError(errors.New("rate limit exceeded"))))
+	assert.False(t, IsPermanent(errors.New("550 not a dispatch error")))
+}
+
+func TestDispatcher_TranslateError_EAIUnsupported(t *testing.T) {
+	dispatcher := NewDispatcher(nil)
+
+	translated := dispatcher.translateError(provider.ErrEAIUnsupported)
+
+	assert.Contains(t, translated.Error(), "553")
+	assert.True(t, IsPermanent(translated))
+}
+
+func TestDispatcher_TranslateError_InvalidDomain(t *testing.T) {
+	dispatcher := NewDispatcher(nil)
+
+	translated := dispatcher.translateError(fmt.Errorf("%w %q: bad label", provider.ErrInvalidDomain, "exa_mple.测试"))
+
+	assert.Equal(t, &Error{Code: 553, EnhancedCode: [3]int{5, 1, 3}, Message: "Invalid domain in address"}, translated)
+	assert.True(t, IsPermanent(translated))
+}
+
+func TestDispatcher_TranslateError_CircuitOpen(t *testing.T) {
+	dispatcher := NewDispatcher(nil)
+
+	translated := dispatcher.translateError(fmt.Errorf("%w: brevo", provider.ErrCircuitOpen))
+
+	assert.Contains(t, translated.Error(), "451")
+	assert.False(t, IsPermanent(translated))
+}
+
+func TestDispatcher_TranslateError_RetryAfter(t *testing.T) {
+	dispatcher := NewDispatcher(nil)
+
+	translated := dispatcher.translateError(&provider.RateLimitError{Provider: "brevo", Wait: 1500 * time.Millisecond})
+
+	var dispatchErr *Error
+	assert.ErrorAs(t, translated, &dispatchErr)
+	assert.Equal(t, 451, dispatchErr.Code)
+	assert.Equal(t, "Rate limit exceeded, try again in 2 seconds", dispatchErr.Message)
+	assert.Equal(t, 2*time.Second, dispatchErr.RetryAfter)
+}
+
+func TestDispatcher_SetRegistry(t *testing.T) {
+	failing := provider.NewMockProvider("test-provider")
+	failing.SetSendError(errors.New("401 unauthorized"))
+	oldRegistry := provider.NewRegistry()
+	_ = oldRegistry.Register(failing)
+	newRegistry := provider.NewRegistry()
+	_ = newRegistry.Register(provider.NewMockProvider("test-provider"))
+
+	dispatcher := NewDispatcher(oldRegistry)
+	dispatcher.SetRegistry(newRegistry)
+
+	assert.Same(t, newRegistry, dispatcher.Registry())
+	_, err := dispatcher.Dispatch(context.Background(), &entity.Email{}, "")
+	assert.NoError(t, err)
+}
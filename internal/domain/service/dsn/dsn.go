@@ -0,0 +1,311 @@
+package dsn
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/core/logger"
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+)
+
+// Action is the per-recipient delivery outcome reported in a DSN (RFC 3464 section 2.3.3)
+type Action string
+
+const (
+	ActionFailed    Action = "failed"
+	ActionDelayed   Action = "delayed"
+	ActionDelivered Action = "delivered"
+	ActionRelayed   Action = "relayed"
+)
+
+// DSN keywords from the NOTIFY and RET parameters (RFC 3461)
+const (
+	NotifyNever   = "NEVER"
+	NotifySuccess = "SUCCESS"
+	NotifyFailure = "FAILURE"
+	NotifyDelay   = "DELAY"
+	ReturnFull    = "FULL"
+	ReturnHeaders = "HDRS"
+)
+
+// Status describes the outcome being reported for an original message
+type Status struct {
+	Action     Action
+	Code       string // enhanced status code, e.g. "5.0.0"
+	Diagnostic string
+	ArrivedAt  time.Time
+	Recipients []string // recipients to report on; all envelope recipients when empty
+}
+
+// Sender sends a generated notification through the provider registry
+type Sender interface {
+	Dispatch(ctx context.Context, email *entity.Email, providerName string) (string, error)
+}
+
+// Generator builds and sends delivery status notifications
+type Generator struct {
+	reportingMTA string
+	from         string
+	sender       Sender
+	now          func() time.Time
+}
+
+// NewGenerator creates a DSN generator reporting as the given MTA hostname.
+// Notifications are sent from the address from, which the provider must
+// accept as a sender.
+func NewGenerator(reportingMTA, from string, sender Sender) *Generator {
+	return &Generator{
+		reportingMTA: reportingMTA,
+		from:         from,
+		sender:       sender,
+		now:          time.Now,
+	}
+}
+
+// Notify sends a DSN for original to its envelope sender, unless loop protection applies
+func (g *Generator) Notify(ctx context.Context, original *entity.Email, providerName string, status Status) error {
+	if !ShouldNotify(original) {
+		logger.Debugf("dsn suppressed for null sender or notification message")
+		return nil
+	}
+
+	status.Recipients = NotifyRecipients(original.Envelope, status.Action)
+	if len(status.Recipients) == 0 {
+		logger.Debugf("dsn not requested: action=%s", status.Action)
+		return nil
+	}
+
+	report := g.Build(original, status)
+	if _, err := g.sender.Dispatch(ctx, report, providerName); err != nil {
+		return fmt.Errorf("failed to send delivery status notification: %w", err)
+	}
+
+	logger.Infof("dsn sent: action=%s to=%s", status.Action, original.Envelope.From)
+	return nil
+}
+
+// ShouldNotify reports whether a DSN may be generated for the message. Messages
+// with a null sender and notifications themselves never get one, preventing loops.
+func ShouldNotify(email *entity.Email) bool {
+	if email == nil || email.Envelope.IsNullSender() {
+		return false
+	}
+	if strings.Contains(strings.ToLower(email.Headers.ContentType), "report-type=delivery-status") {
+		return false
+	}
+	for key, values := range email.Headers.Custom {
+		if strings.EqualFold(key, "Auto-Submitted") && len(values) > 0 && !strings.EqualFold(values[0], "no") {
+			return false
+		}
+	}
+	return true
+}
+
+// NotifyRecipients returns the envelope recipients whose NOTIFY parameter asks
+// for a report of the given action. Without NOTIFY only failures are reported.
+func NotifyRecipients(envelope entity.Envelope, action Action) []string {
+	var recipients []string
+	for _, rcpt := range envelope.To {
+		notify := envelope.Recipients[rcpt].Notify
+		if len(notify) == 0 {
+			notify = []string{NotifyFailure}
+		}
+		if wantsNotify(notify, action) {
+			recipients = append(recipients, rcpt)
+		}
+	}
+	return recipients
+}
+
+// wantsNotify checks a NOTIFY keyword list against an action
+func wantsNotify(notify []string, action Action) bool {
+	var keyword string
+	switch action {
+	case ActionFailed:
+		keyword = NotifyFailure
+	case ActionDelayed:
+		keyword = NotifyDelay
+	case ActionDelivered, ActionRelayed:
+		keyword = NotifySuccess
+	}
+
+	for _, n := range notify {
+		if strings.EqualFold(n, NotifyNever) {
+			return false
+		}
+		if strings.EqualFold(n, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// Build creates a multipart/report notification for original
+func (g *Generator) Build(original *entity.Email, status Status) *entity.Email {
+	postmaster := &mail.Address{
+		Name:    "Mail Delivery System",
+		Address: g.from,
+	}
+
+	if len(status.Recipients) == 0 {
+		status.Recipients = original.Envelope.To
+	}
+
+	deliveryStatus := g.deliveryStatus(original, status)
+
+	return &entity.Email{
+		// Null reverse-path so a failing notification never triggers another one
+		Envelope: entity.Envelope{
+			From: "",
+			To:   []string{original.Envelope.From},
+		},
+		Headers: entity.Headers{
+			From:        postmaster,
+			To:          []*mail.Address{{Address: original.Envelope.From}},
+			Subject:     subject(status.Action),
+			Date:        g.now(),
+			ContentType: "multipart/report; report-type=delivery-status",
+			Custom: map[string][]string{
+				"Auto-Submitted": {"auto-replied"},
+			},
+		},
+		TextBody: g.humanReadable(original, status),
+		Attachments: []entity.Attachment{
+			{
+				Filename:    "delivery-status.txt",
+				ContentType: "message/delivery-status",
+				Size:        int64(len(deliveryStatus)),
+				Content:     []byte(deliveryStatus),
+			},
+			returnedContent(original, status.Action),
+		},
+	}
+}
+
+// returnedContent attaches the full original message for failures when RET=FULL
+// was requested and it was kept, otherwise only its headers
+func returnedContent(original *entity.Email, action Action) entity.Attachment {
+	if action == ActionFailed && strings.EqualFold(original.Envelope.Return, ReturnFull) && len(original.Raw) > 0 {
+		return entity.Attachment{
+			Filename:    "message.eml",
+			ContentType: "message/rfc822",
+			Size:        int64(len(original.Raw)),
+			Content:     original.Raw,
+		}
+	}
+
+	headers := formatHeaders(original.Headers.Raw)
+	return entity.Attachment{
+		Filename:    "headers.txt",
+		ContentType: "text/rfc822-headers",
+		Size:        int64(len(headers)),
+		Content:     []byte(headers),
+	}
+}
+
+// humanReadable renders the first part of the report
+func (g *Generator) humanReadable(original *entity.Email, status Status) string {
+	var b strings.Builder
+
+	switch status.Action {
+	case ActionDelivered:
+		b.WriteString("Your message was successfully delivered to the following recipients:\n\n")
+	case ActionRelayed:
+		b.WriteString("Your message was handed off to the delivery provider for the following recipients.\n" +
+			"No further notifications will be sent for them:\n\n")
+	case ActionDelayed:
+		b.WriteString("Delivery of your message has been delayed. It will be retried automatically.\n\n")
+	default:
+		b.WriteString("Your message could not be delivered to the following recipients:\n\n")
+	}
+
+	for _, rcpt := range status.Recipients {
+		fmt.Fprintf(&b, "    %s\n", rcpt)
+	}
+	if status.Diagnostic != "" {
+		fmt.Fprintf(&b, "\nReason: %s\n", status.Diagnostic)
+	}
+	if original.Headers.Subject != "" {
+		fmt.Fprintf(&b, "\nOriginal subject: %s\n", original.Headers.Subject)
+	}
+
+	return b.String()
+}
+
+// deliveryStatus renders the message/delivery-status part (RFC 3464 section 2.1)
+func (g *Generator) deliveryStatus(original *entity.Email, status Status) string {
+	var b bytes.Buffer
+
+	if original.Envelope.EnvelopeID != "" {
+		fmt.Fprintf(&b, "Original-Envelope-Id: %s\r\n", original.Envelope.EnvelopeID)
+	}
+	fmt.Fprintf(&b, "Reporting-MTA: dns; %s\r\n", g.reportingMTA)
+	if !status.ArrivedAt.IsZero() {
+		fmt.Fprintf(&b, "Arrival-Date: %s\r\n", status.ArrivedAt.Format(time.RFC1123Z))
+	}
+
+	for _, rcpt := range status.Recipients {
+		b.WriteString("\r\n")
+		if orcpt := original.Envelope.Recipients[rcpt].OriginalRecipient; orcpt != "" {
+			fmt.Fprintf(&b, "Original-Recipient: %s\r\n", orcpt)
+		}
+		fmt.Fprintf(&b, "Final-Recipient: rfc822; %s\r\n", rcpt)
+		fmt.Fprintf(&b, "Action: %s\r\n", status.Action)
+		fmt.Fprintf(&b, "Status: %s\r\n", statusCode(status))
+		if status.Diagnostic != "" {
+			fmt.Fprintf(&b, "Diagnostic-Code: smtp; %s\r\n", status.Diagnostic)
+		}
+		fmt.Fprintf(&b, "Last-Attempt-Date: %s\r\n", g.now().Format(time.RFC1123Z))
+	}
+
+	return b.String()
+}
+
+// statusCode returns the enhanced status code, defaulting by action
+func statusCode(status Status) string {
+	if status.Code != "" {
+		return status.Code
+	}
+	switch status.Action {
+	case ActionDelivered, ActionRelayed:
+		return "2.0.0"
+	case ActionDelayed:
+		return "4.0.0"
+	default:
+		return "5.0.0"
+	}
+}
+
+// subject returns the notification subject for an action
+func subject(action Action) string {
+	switch action {
+	case ActionDelivered, ActionRelayed:
+		return "Delivery Status Notification (Success)"
+	case ActionDelayed:
+		return "Delivery Status Notification (Delay)"
+	default:
+		return "Undelivered Mail Returned to Sender"
+	}
+}
+
+// formatHeaders renders headers as a text/rfc822-headers body in a stable order
+func formatHeaders(raw map[string][]string) string {
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		for _, value := range raw[key] {
+			fmt.Fprintf(&b, "%s: %s\r\n", key, value)
+		}
+	}
+	return b.String()
+}
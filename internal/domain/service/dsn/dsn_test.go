@@ -0,0 +1,177 @@
+package dsn
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingSender struct {
+	sent []*entity.Email
+	err  error
+}
+
+func (r *recordingSender) Dispatch(ctx context.Context, email *entity.Email, providerName string) (string, error) {
+	r.sent = append(r.sent, email)
+	return "", r.err
+}
+
+func newOriginal() *entity.Email {
+	return &entity.Email{
+		Envelope: entity.Envelope{
+			From: "sender@example.com",
+			To:   []string{"bad@example.net"},
+		},
+		Headers: entity.Headers{
+			Subject: "Hello",
+			Raw: map[string][]string{
+				"Subject":    {"Hello"},
+				"Message-Id": {"<abc@example.com>"},
+			},
+		},
+	}
+}
+
+func TestGenerator_Build(t *testing.T) {
+	generator := NewGenerator("mx.example.com", "bounces@example.com", nil)
+	generator.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	report := generator.Build(newOriginal(), Status{
+		Action:     ActionFailed,
+		Diagnostic: "550 Invalid recipient address",
+	})
+
+	assert.True(t, report.Envelope.IsNullSender())
+	assert.Equal(t, []string{"sender@example.com"}, report.Envelope.To)
+	assert.Equal(t, "bounces@example.com", report.Headers.From.Address)
+	assert.Equal(t, "sender@example.com", report.Headers.To[0].Address)
+	assert.Equal(t, "Undelivered Mail Returned to Sender", report.Headers.Subject)
+	assert.Contains(t, report.Headers.ContentType, "multipart/report")
+	assert.Contains(t, report.TextBody, "bad@example.net")
+	assert.Len(t, report.Attachments, 2)
+
+	status := report.Attachments[0].Content
+	assert.Equal(t, "message/delivery-status", report.Attachments[0].ContentType)
+	assert.Contains(t, string(status), "Reporting-MTA: dns; mx.example.com")
+	assert.Contains(t, string(status), "Final-Recipient: rfc822; bad@example.net")
+	assert.Contains(t, string(status), "Action: failed")
+	assert.Contains(t, string(status), "Status: 5.0.0")
+
+	headers := report.Attachments[1].Content
+	assert.Equal(t, "text/rfc822-headers", report.Attachments[1].ContentType)
+	assert.Equal(t, "Message-Id: <abc@example.com>\r\nSubject: Hello\r\n", string(headers))
+}
+
+func TestGenerator_Notify(t *testing.T) {
+	sender := &recordingSender{}
+	generator := NewGenerator("mx.example.com", "bounces@example.com", sender)
+
+	err := generator.Notify(context.Background(), newOriginal(), "", Status{Action: ActionFailed})
+	assert.NoError(t, err)
+	assert.Len(t, sender.sent, 1)
+}
+
+func TestGenerator_NotifySendError(t *testing.T) {
+	sender := &recordingSender{err: errors.New("boom")}
+	generator := NewGenerator("mx.example.com", "bounces@example.com", sender)
+
+	err := generator.Notify(context.Background(), newOriginal(), "", Status{Action: ActionFailed})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "boom")
+}
+
+func TestGenerator_NotifyNullSender(t *testing.T) {
+	sender := &recordingSender{}
+	generator := NewGenerator("mx.example.com", "bounces@example.com", sender)
+
+	original := newOriginal()
+	original.Envelope.From = ""
+
+	err := generator.Notify(context.Background(), original, "", Status{Action: ActionFailed})
+	assert.NoError(t, err)
+	assert.Empty(t, sender.sent)
+}
+
+func TestShouldNotify(t *testing.T) {
+	assert.True(t, ShouldNotify(newOriginal()))
+	assert.False(t, ShouldNotify(nil))
+
+	nullSender := newOriginal()
+	nullSender.Envelope.From = "<>"
+	assert.False(t, ShouldNotify(nullSender))
+
+	report := newOriginal()
+	report.Headers.ContentType = "multipart/report; report-type=delivery-status; boundary=x"
+	assert.False(t, ShouldNotify(report))
+
+	autoReply := newOriginal()
+	autoReply.Headers.Custom = map[string][]string{"Auto-Submitted": {"auto-replied"}}
+	assert.False(t, ShouldNotify(autoReply))
+
+	explicitNo := newOriginal()
+	explicitNo.Headers.Custom = map[string][]string{"Auto-Submitted": {"no"}}
+	assert.True(t, ShouldNotify(explicitNo))
+}
+
+func TestNotifyRecipients(t *testing.T) {
+	envelope := entity.Envelope{
+		To: []string{"default@example.net", "never@example.net", "success@example.net", "delay@example.net"},
+		Recipients: map[string]entity.RecipientParams{
+			"never@example.net":   {Notify: []string{NotifyNever}},
+			"success@example.net": {Notify: []string{NotifySuccess, NotifyFailure}},
+			"delay@example.net":   {Notify: []string{NotifyDelay}},
+		},
+	}
+
+	assert.Equal(t, []string{"default@example.net", "success@example.net"}, NotifyRecipients(envelope, ActionFailed))
+	assert.Equal(t, []string{"success@example.net"}, NotifyRecipients(envelope, ActionRelayed))
+	assert.Equal(t, []string{"delay@example.net"}, NotifyRecipients(envelope, ActionDelayed))
+}
+
+func TestGenerator_NotifyNotRequested(t *testing.T) {
+	sender := &recordingSender{}
+	generator := NewGenerator("mx.example.com", "bounces@example.com", sender)
+
+	err := generator.Notify(context.Background(), newOriginal(), "", Status{Action: ActionRelayed})
+	assert.NoError(t, err)
+	assert.Empty(t, sender.sent)
+}
+
+func TestGenerator_BuildWithDSNParameters(t *testing.T) {
+	generator := NewGenerator("mx.example.com", "bounces@example.com", nil)
+
+	original := newOriginal()
+	original.Envelope.EnvelopeID = "QQ314159"
+	original.Envelope.Return = ReturnFull
+	original.Envelope.Recipients = map[string]entity.RecipientParams{
+		"bad@example.net": {Notify: []string{NotifyFailure}, OriginalRecipient: "rfc822;alias@example.net"},
+	}
+	original.Raw = []byte("Subject: Hello\r\n\r\nBody")
+
+	report := generator.Build(original, Status{Action: ActionFailed})
+
+	status := report.Attachments[0].Content
+	assert.Contains(t, string(status), "Original-Envelope-Id: QQ314159")
+	assert.Contains(t, string(status), "Original-Recipient: rfc822;alias@example.net")
+
+	assert.Equal(t, "message/rfc822", report.Attachments[1].ContentType)
+	full := report.Attachments[1].Content
+	assert.Equal(t, "Subject: Hello\r\n\r\nBody", string(full))
+}
+
+func TestGenerator_BuildSuccessReturnsHeadersOnly(t *testing.T) {
+	generator := NewGenerator("mx.example.com", "bounces@example.com", nil)
+
+	original := newOriginal()
+	original.Envelope.Return = ReturnFull
+	original.Raw = []byte("Subject: Hello\r\n\r\nBody")
+
+	report := generator.Build(original, Status{Action: ActionRelayed})
+
+	assert.Equal(t, "Delivery Status Notification (Success)", report.Headers.Subject)
+	assert.Equal(t, "text/rfc822-headers", report.Attachments[1].ContentType)
+}
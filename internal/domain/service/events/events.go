@@ -0,0 +1,72 @@
+package events
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/itsLeonB/smtproxy/internal/core/logger"
+	"github.com/itsLeonB/smtproxy/internal/core/metrics"
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+)
+
+// Recorder adds delivery events to the history of the messages they are
+// about, reporting whether it knows the message
+type Recorder interface {
+	Event(ctx context.Context, e entity.DeliveryEvent) bool
+}
+
+// Forwarder passes delivery events on to another system
+type Forwarder interface {
+	Forward(ctx context.Context, events []entity.DeliveryEvent) error
+}
+
+// Suppressor stops sending to the recipients of events such as hard
+// bounces and complaints
+type Suppressor interface {
+	SuppressEvent(ctx context.Context, e entity.DeliveryEvent)
+}
+
+// Handler takes the delivery events received from provider webhooks
+type Handler struct {
+	recorder   Recorder
+	forwarder  Forwarder
+	suppressor Suppressor
+}
+
+// NewHandler creates a handler that records events with recorder and
+// passes them to forwarder. Either may be nil.
+func NewHandler(recorder Recorder, forwarder Forwarder) *Handler {
+	return &Handler{recorder: recorder, forwarder: forwarder}
+}
+
+// SetSuppressor passes every event to suppressor
+func (h *Handler) SetSuppressor(suppressor Suppressor) {
+	h.suppressor = suppressor
+}
+
+// HandleEvents records events and forwards them. It fails only if they
+// could not be forwarded, so that the provider delivers them again.
+func (h *Handler) HandleEvents(ctx context.Context, events []entity.DeliveryEvent) error {
+	for _, e := range events {
+		outcome := "unmatched"
+		if h.recorder != nil && h.recorder.Event(ctx, e) {
+			outcome = "matched"
+		}
+		if h.suppressor != nil {
+			h.suppressor.SuppressEvent(ctx, e)
+		}
+		metrics.WebhookEvents.WithLabelValues(e.Provider, string(e.Type), outcome).Inc()
+		logger.DebugContext(ctx, "delivery event received", "provider", e.Provider, "type", e.Type, "provider_message_id", e.MessageID, "outcome", outcome)
+	}
+
+	if h.forwarder == nil || len(events) == 0 {
+		return nil
+	}
+	if err := h.forwarder.Forward(ctx, events); err != nil {
+		metrics.EventForwards.WithLabelValues("failure").Inc()
+		logger.WarnContext(ctx, "failed to forward delivery events", "events", len(events), "error", err)
+		return fmt.Errorf("failed to forward delivery events: %w", err)
+	}
+	metrics.EventForwards.WithLabelValues("success").Inc()
+	return nil
+}
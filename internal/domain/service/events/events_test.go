@@ -0,0 +1,84 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/itsLeonB/smtproxy/internal/core/metrics"
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRecorder knows the messages in known and records the events for them
+type fakeRecorder struct {
+	known    map[string]bool
+	recorded []entity.DeliveryEvent
+}
+
+func (f *fakeRecorder) Event(ctx context.Context, e entity.DeliveryEvent) bool {
+	if !f.known[e.MessageID] {
+		return false
+	}
+	f.recorded = append(f.recorded, e)
+	return true
+}
+
+// fakeForwarder collects forwarded events and fails with err
+type fakeForwarder struct {
+	forwarded []entity.DeliveryEvent
+	err       error
+}
+
+func (f *fakeForwarder) Forward(ctx context.Context, events []entity.DeliveryEvent) error {
+	f.forwarded = append(f.forwarded, events...)
+	return f.err
+}
+
+// fakeSuppressor collects the events it is given
+type fakeSuppressor struct {
+	events []entity.DeliveryEvent
+}
+
+func (f *fakeSuppressor) SuppressEvent(ctx context.Context, e entity.DeliveryEvent) {
+	f.events = append(f.events, e)
+}
+
+func TestHandler_HandleEvents(t *testing.T) {
+	recorder := &fakeRecorder{known: map[string]bool{"<m1@example.com>": true}}
+	forwarder := &fakeForwarder{}
+	suppressor := &fakeSuppressor{}
+	handler := NewHandler(recorder, forwarder)
+	handler.SetSuppressor(suppressor)
+	matched := testutil.ToFloat64(metrics.WebhookEvents.WithLabelValues("test", "delivered", "matched"))
+	unmatched := testutil.ToFloat64(metrics.WebhookEvents.WithLabelValues("test", "delivered", "unmatched"))
+
+	events := []entity.DeliveryEvent{
+		{Type: entity.EventDelivered, Provider: "test", MessageID: "<m1@example.com>"},
+		{Type: entity.EventDelivered, Provider: "test", MessageID: "<m2@example.com>"},
+	}
+	assert.NoError(t, handler.HandleEvents(context.Background(), events))
+
+	assert.Equal(t, events[:1], recorder.recorded)
+	assert.Equal(t, events, forwarder.forwarded)
+	assert.Equal(t, events, suppressor.events)
+	assert.Equal(t, matched+1, testutil.ToFloat64(metrics.WebhookEvents.WithLabelValues("test", "delivered", "matched")))
+	assert.Equal(t, unmatched+1, testutil.ToFloat64(metrics.WebhookEvents.WithLabelValues("test", "delivered", "unmatched")))
+}
+
+func TestHandler_ForwardFailure(t *testing.T) {
+	recorder := &fakeRecorder{known: map[string]bool{"<m1@example.com>": true}}
+	handler := NewHandler(recorder, &fakeForwarder{err: errors.New("connection refused")})
+
+	err := handler.HandleEvents(context.Background(), []entity.DeliveryEvent{{Type: entity.EventOpened, MessageID: "<m1@example.com>"}})
+
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Len(t, recorder.recorded, 1)
+}
+
+func TestHandler_WithoutRecorderOrForwarder(t *testing.T) {
+	handler := NewHandler(nil, nil)
+
+	assert.NoError(t, handler.HandleEvents(context.Background(), []entity.DeliveryEvent{{Type: entity.EventOpened}}))
+}
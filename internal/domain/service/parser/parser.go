@@ -1,7 +1,6 @@
 package parser
 
 import (
-	"bytes"
 	"encoding/base64"
 	"io"
 	"mime"
@@ -60,6 +59,7 @@ func (p *Parser) Parse(r io.Reader) (*entity.Email, error) {
 func (p *Parser) parseHeaders(h mail.Header) entity.Headers {
 	headers := entity.Headers{
 		Custom: make(map[string][]string),
+		Raw:    make(map[string][]string, len(h)),
 	}
 
 	// Standard headers
@@ -80,8 +80,9 @@ func (p *Parser) parseHeaders(h mail.Header) entity.Headers {
 	headers.CC = p.parseAddressList(h.Get("CC"))
 	headers.BCC = p.parseAddressList(h.Get("BCC"))
 
-	// Store custom headers
+	// Store custom headers, keeping every header verbatim for notifications
 	for key, values := range h {
+		headers.Raw[key] = values
 		if !p.isStandardHeader(key) {
 			headers.Custom[key] = values
 		}
@@ -175,7 +176,7 @@ func (p *Parser) processAttachment(part *multipart.Part, msg *entity.Email, para
 		Filename:    filename,
 		ContentType: part.Header.Get("Content-Type"),
 		Size:        int64(len(content)),
-		Content:     bytes.NewReader(content),
+		Content:     content,
 	}
 
 	msg.Attachments = append(msg.Attachments, attachment)
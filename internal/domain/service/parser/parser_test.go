@@ -333,3 +333,23 @@ aGVsbG8=
 	assert.Len(t, email.Attachments, 1)
 	assert.Equal(t, "inline.png", email.Attachments[0].Filename)
 }
+
+func TestParser_ParseUTF8Headers(t *testing.T) {
+	rawEmail := "From: Jöhn Dœ <jöhn@exämple.com>\r\n" +
+		"To: 用户@例子.广告, \"Ünï\" <ü@bücher.de>\r\n" +
+		"Subject: Grüße 你好\r\n" +
+		"\r\n" +
+		"Hallo"
+
+	parser := New(1024 * 1024)
+	email, err := parser.Parse(strings.NewReader(rawEmail))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Jöhn Dœ", email.Headers.From.Name)
+	assert.Equal(t, "jöhn@exämple.com", email.Headers.From.Address)
+	assert.Len(t, email.Headers.To, 2)
+	assert.Equal(t, "用户@例子.广告", email.Headers.To[0].Address)
+	assert.Equal(t, "Ünï", email.Headers.To[1].Name)
+	assert.Equal(t, "ü@bücher.de", email.Headers.To[1].Address)
+	assert.Equal(t, "Grüße 你好", email.Headers.Subject)
+}
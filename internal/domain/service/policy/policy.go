@@ -0,0 +1,203 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrQuotaExceeded is returned when a user has used up their daily quota
+var ErrQuotaExceeded = errors.New("daily quota exceeded")
+
+// Policy restricts what an authenticated user may send. Zero values mean no limit.
+type Policy struct {
+	// AllowedSenders lists addresses ("app@example.com") or domains
+	// ("example.com" or "@example.com") the user may send from
+	AllowedSenders []string `json:"allowed_senders"`
+	MaxRecipients  int      `json:"max_recipients"`
+	MaxMessageSize int64    `json:"max_message_size"`
+	Provider       string   `json:"provider"`
+	DailyQuota     int      `json:"daily_quota"`
+}
+
+// AllowsSender reports whether address may be used as the sender
+func (p Policy) AllowsSender(address string) bool {
+	if len(p.AllowedSenders) == 0 {
+		return true
+	}
+
+	address = strings.ToLower(strings.TrimSpace(address))
+	_, domain, found := strings.Cut(address, "@")
+	if !found {
+		return false
+	}
+
+	for _, allowed := range p.AllowedSenders {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		switch {
+		case strings.Contains(strings.TrimPrefix(allowed, "@"), "@"):
+			if address == allowed {
+				return true
+			}
+		case domain == strings.TrimPrefix(allowed, "@"):
+			return true
+		}
+	}
+	return false
+}
+
+// File is the on-disk policy format
+type File struct {
+	Default *Policy           `json:"default"`
+	Users   map[string]Policy `json:"users"`
+}
+
+// LoadFile reads per-user policies from a JSON file
+func LoadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file %s: %w", path, err)
+	}
+	return &file, nil
+}
+
+// usage tracks messages sent by a user on a given day
+type usage struct {
+	day   string
+	count int
+}
+
+// Manager resolves user policies and tracks daily quota usage
+type Manager struct {
+	mu            sync.Mutex
+	defaultPolicy Policy
+	policies      map[string]Policy
+	usage         map[string]*usage
+	now           func() time.Time
+}
+
+// NewManager creates a policy manager. Users without an entry get defaultPolicy.
+func NewManager(policies map[string]Policy, defaultPolicy Policy) *Manager {
+	if policies == nil {
+		policies = make(map[string]Policy)
+	}
+	return &Manager{
+		defaultPolicy: defaultPolicy,
+		policies:      policies,
+		usage:         make(map[string]*usage),
+		now:           time.Now,
+	}
+}
+
+// NewManagerFromFile creates a policy manager from a loaded policy file
+func NewManagerFromFile(file *File) *Manager {
+	var defaultPolicy Policy
+	if file.Default != nil {
+		defaultPolicy = *file.Default
+	}
+	return NewManager(file.Users, defaultPolicy)
+}
+
+// Reload replaces the policies with those in file, keeping today's quota usage
+func (m *Manager) Reload(file *File) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.defaultPolicy = Policy{}
+	if file.Default != nil {
+		m.defaultPolicy = *file.Default
+	}
+	m.policies = file.Users
+	if m.policies == nil {
+		m.policies = make(map[string]Policy)
+	}
+}
+
+// Lookup returns the effective policy for username
+func (m *Manager) Lookup(username string) Policy {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if p, exists := m.policies[username]; exists {
+		return p
+	}
+	return m.defaultPolicy
+}
+
+// Reservation holds a message against a user's daily quota until it is
+// committed once the message is accepted, or released if it is not
+type Reservation struct {
+	manager  *Manager
+	username string
+	day      string
+	done     bool
+}
+
+// Reserve counts a message against username's daily quota before it is
+// received, so that concurrent sessions cannot together exceed the quota.
+// It returns ErrQuotaExceeded if username cannot send another message today.
+func (m *Manager) Reserve(username string) (*Reservation, error) {
+	p := m.Lookup(username)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.current(username)
+	if p.DailyQuota > 0 && u.count >= p.DailyQuota {
+		return nil, ErrQuotaExceeded
+	}
+	u.count++
+	return &Reservation{manager: m, username: username, day: u.day}, nil
+}
+
+// Commit keeps the reserved message counted
+func (r *Reservation) Commit() {
+	r.manager.mu.Lock()
+	defer r.manager.mu.Unlock()
+
+	r.done = true
+}
+
+// Release gives the reserved message back to the quota. It has no effect
+// once the reservation is committed or released, or after UTC midnight.
+func (r *Reservation) Release() {
+	r.manager.mu.Lock()
+	defer r.manager.mu.Unlock()
+
+	if r.done {
+		return
+	}
+	r.done = true
+	if u, exists := r.manager.usage[r.username]; exists && u.day == r.day && u.count > 0 {
+		u.count--
+	}
+}
+
+// Usage returns how many messages username has sent today
+func (m *Manager) Usage(username string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.current(username).count
+}
+
+// current returns today's usage for username, resetting it at UTC midnight.
+// Callers must hold m.mu.
+func (m *Manager) current(username string) *usage {
+	day := m.now().UTC().Format(time.DateOnly)
+	u, exists := m.usage[username]
+	if !exists || u.day != day {
+		u = &usage{day: day}
+		m.usage[username] = u
+	}
+	return u
+}
@@ -0,0 +1,150 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_AllowsSender(t *testing.T) {
+	p := Policy{AllowedSenders: []string{"app-a.example.com", "@mail.example.org", "Billing@Example.net"}}
+
+	assert.True(t, p.AllowsSender("noreply@app-a.example.com"))
+	assert.True(t, p.AllowsSender("alerts@MAIL.example.org"))
+	assert.True(t, p.AllowsSender("billing@example.net"))
+	assert.False(t, p.AllowsSender("other@example.net"))
+	assert.False(t, p.AllowsSender("noreply@app-b.example.com"))
+	assert.False(t, p.AllowsSender("no-at-sign"))
+}
+
+func TestPolicy_AllowsSenderUnrestricted(t *testing.T) {
+	assert.True(t, Policy{}.AllowsSender("anyone@anywhere.example"))
+}
+
+func TestManager_Lookup(t *testing.T) {
+	manager := NewManager(map[string]Policy{
+		"app-a": {MaxRecipients: 10},
+	}, Policy{MaxRecipients: 1})
+
+	assert.Equal(t, 10, manager.Lookup("app-a").MaxRecipients)
+	assert.Equal(t, 1, manager.Lookup("unknown").MaxRecipients)
+}
+
+func TestManager_DailyQuota(t *testing.T) {
+	manager := NewManager(map[string]Policy{
+		"app-a": {DailyQuota: 2},
+	}, Policy{})
+
+	day := time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC)
+	manager.now = func() time.Time { return day }
+
+	first, err := manager.Reserve("app-a")
+	assert.NoError(t, err)
+	first.Commit()
+	second, err := manager.Reserve("app-a")
+	assert.NoError(t, err)
+	_, err = manager.Reserve("app-a")
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.Equal(t, 2, manager.Usage("app-a"))
+
+	// A released reservation frees its place, and releasing again or after
+	// committing changes nothing
+	second.Release()
+	second.Release()
+	first.Release()
+	assert.Equal(t, 1, manager.Usage("app-a"))
+	pending, err := manager.Reserve("app-a")
+	assert.NoError(t, err)
+
+	// Users without a quota are never limited
+	for range 3 {
+		_, err = manager.Reserve("other")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 3, manager.Usage("other"))
+
+	// Usage resets the next UTC day, and yesterday's reservations no longer count
+	manager.now = func() time.Time { return day.Add(2 * time.Hour) }
+	assert.Equal(t, 0, manager.Usage("app-a"))
+	third, err := manager.Reserve("app-a")
+	assert.NoError(t, err)
+	pending.Release()
+	assert.Equal(t, 1, manager.Usage("app-a"))
+	third.Release()
+	assert.Equal(t, 0, manager.Usage("app-a"))
+}
+
+func TestManager_ReserveConcurrently(t *testing.T) {
+	manager := NewManager(map[string]Policy{"app-a": {DailyQuota: 5}}, Policy{})
+
+	var wg sync.WaitGroup
+	var accepted atomic.Int32
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := manager.Reserve("app-a"); err == nil {
+				accepted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(5), accepted.Load())
+	assert.Equal(t, 5, manager.Usage("app-a"))
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.json")
+	content := `{
+		"default": {"max_recipients": 5},
+		"users": {
+			"app-a": {"allowed_senders": ["app-a.example.com"], "max_message_size": 1024, "provider": "brevo", "daily_quota": 100}
+		}
+	}`
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	file, err := LoadFile(path)
+	assert.NoError(t, err)
+
+	manager := NewManagerFromFile(file)
+	appA := manager.Lookup("app-a")
+	assert.Equal(t, []string{"app-a.example.com"}, appA.AllowedSenders)
+	assert.Equal(t, int64(1024), appA.MaxMessageSize)
+	assert.Equal(t, "brevo", appA.Provider)
+	assert.Equal(t, 100, appA.DailyQuota)
+	assert.Equal(t, 5, manager.Lookup("someone").MaxRecipients)
+}
+
+func TestLoadFile_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.json")
+	assert.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+
+	_, err := LoadFile(path)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse policy file")
+}
+
+func TestManager_ReloadKeepsUsage(t *testing.T) {
+	manager := NewManager(map[string]Policy{
+		"app-a": {DailyQuota: 2},
+	}, Policy{})
+	reservation, err := manager.Reserve("app-a")
+	assert.NoError(t, err)
+	reservation.Commit()
+
+	manager.Reload(&File{
+		Default: &Policy{MaxRecipients: 5},
+		Users:   map[string]Policy{"app-a": {DailyQuota: 1}},
+	})
+
+	assert.Equal(t, 1, manager.Usage("app-a"))
+	_, err = manager.Reserve("app-a")
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.Equal(t, 5, manager.Lookup("unknown").MaxRecipients)
+}
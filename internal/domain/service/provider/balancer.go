@@ -0,0 +1,150 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"math/rand/v2"
+	"sort"
+	"strings"
+
+	"github.com/itsLeonB/smtproxy/internal/core/metrics"
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+)
+
+// balancer splits traffic across providers in proportion to their weights
+type balancer struct {
+	weights map[string]int
+	// names fixes the order providers are laid out in, so sticky picks are stable
+	names  []string
+	sticky bool
+	// selections counts the picks per provider for the traffic share metric
+	selections map[string]uint64
+	total      uint64
+}
+
+// SetWeights makes sends that don't name a provider go to one of the
+// weighted providers, chosen at random in proportion to its weight. With
+// sticky set, messages to the same recipient domain always choose the same
+// provider. Disabled providers are skipped. Empty weights restore sending
+// through the default provider.
+func (r *Registry) SetWeights(weights map[string]int, sticky bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(weights) == 0 {
+		r.balancer = nil
+		return nil
+	}
+
+	total := 0
+	for name, weight := range weights {
+		if _, exists := r.providers[name]; !exists {
+			return errors.New("provider not found: " + name)
+		}
+		if weight < 0 {
+			return fmt.Errorf("weight of provider %s must not be negative", name)
+		}
+		total += weight
+	}
+	if total == 0 {
+		return errors.New("provider weights must not all be zero")
+	}
+
+	b := &balancer{
+		weights:    maps.Clone(weights),
+		sticky:     sticky,
+		selections: make(map[string]uint64),
+	}
+	for name := range weights {
+		b.names = append(b.names, name)
+	}
+	// Sorting keeps sticky picks stable across restarts
+	sort.Strings(b.names)
+	r.balancer = b
+	return nil
+}
+
+// Weights returns the configured provider weights, or nil when sends go to the default provider
+func (r *Registry) Weights() map[string]int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.balancer == nil {
+		return nil
+	}
+	return maps.Clone(r.balancer.weights)
+}
+
+// Balance picks a weighted provider for email, or returns "" when weights
+// are not configured or every weighted provider is disabled. Callers that
+// retry should pick once and name the chosen provider on every attempt, so
+// that a retry is not balanced again to another provider.
+func (r *Registry) Balance(email *entity.Email) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b := r.balancer
+	if b == nil {
+		return ""
+	}
+
+	total := 0
+	for _, name := range b.names {
+		if !r.disabled[name] {
+			total += b.weights[name]
+		}
+	}
+	if total == 0 {
+		return ""
+	}
+
+	var point int
+	if key := stickyKey(email); b.sticky && key != "" {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(key))
+		point = int(h.Sum64() % uint64(total))
+	} else {
+		point = r.pick(total)
+	}
+
+	for _, name := range b.names {
+		if r.disabled[name] {
+			continue
+		}
+		if point < b.weights[name] {
+			b.record(name)
+			return name
+		}
+		point -= b.weights[name]
+	}
+	return ""
+}
+
+// record counts a pick and publishes every provider's share of the picks so far
+func (b *balancer) record(name string) {
+	b.selections[name]++
+	b.total++
+	metrics.BalancerSelections.WithLabelValues(name).Inc()
+	for _, n := range b.names {
+		metrics.BalancerTrafficShare.WithLabelValues(n).Set(float64(b.selections[n]) / float64(b.total))
+	}
+}
+
+// stickyKey returns the lowercase domain of the first envelope recipient
+func stickyKey(email *entity.Email) string {
+	if email == nil || len(email.Envelope.To) == 0 {
+		return ""
+	}
+	to := email.Envelope.To[0]
+	if i := strings.LastIndex(to, "@"); i >= 0 {
+		return strings.ToLower(strings.Trim(to[i+1:], "<> "))
+	}
+	return ""
+}
+
+// randomPick returns a uniformly random number in [0, n)
+func randomPick(n int) int {
+	return rand.IntN(n)
+}
@@ -0,0 +1,103 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/itsLeonB/smtproxy/internal/core/metrics"
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newBalancedRegistry(t *testing.T, sticky bool) *Registry {
+	t.Helper()
+	registry := NewRegistry()
+	for _, name := range []string{"brevo", "ses", "spare"} {
+		assert.NoError(t, registry.Register(NewMockProvider(name)))
+	}
+	assert.NoError(t, registry.SetWeights(map[string]int{"brevo": 90, "ses": 10}, sticky))
+	return registry
+}
+
+func emailTo(to ...string) *entity.Email {
+	return &entity.Email{Envelope: entity.Envelope{From: "app@example.com", To: to}}
+}
+
+func TestRegistry_WeightedSplit(t *testing.T) {
+	registry := newBalancedRegistry(t, false)
+	// Walk every point of the weight range once to get the exact split
+	point := 0
+	registry.pick = func(n int) int {
+		defer func() { point++ }()
+		return point % n
+	}
+
+	counts := map[string]int{}
+	for range 100 {
+		result, err := registry.Send(context.Background(), emailTo("user@example.org"), "")
+		assert.NoError(t, err)
+		counts[result.ProviderName]++
+	}
+
+	assert.Equal(t, map[string]int{"brevo": 90, "ses": 10}, counts)
+	assert.InDelta(t, 0.1, testutil.ToFloat64(metrics.BalancerTrafficShare.WithLabelValues("ses")), 0.001)
+}
+
+func TestRegistry_WeightedExplicitProvider(t *testing.T) {
+	registry := newBalancedRegistry(t, false)
+
+	result, err := registry.Send(context.Background(), emailTo("user@example.org"), "spare")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "spare", result.ProviderName)
+}
+
+func TestRegistry_WeightedSticky(t *testing.T) {
+	registry := newBalancedRegistry(t, true)
+	registry.pick = func(n int) int {
+		t.Fatal("sticky balancing must not pick at random")
+		return 0
+	}
+
+	chosen := map[string]string{}
+	for _, domain := range []string{"gmail.com", "example.org", "example.net", "outlook.com"} {
+		for range 5 {
+			result, err := registry.Send(context.Background(), emailTo("someone@"+domain), "")
+			assert.NoError(t, err)
+			if previous, seen := chosen[domain]; seen {
+				assert.Equal(t, previous, result.ProviderName, domain)
+			}
+			chosen[domain] = result.ProviderName
+		}
+	}
+
+	// Recipient domains are case-insensitive
+	result, _ := registry.Send(context.Background(), emailTo("someone@GMAIL.com"), "")
+	assert.Equal(t, chosen["gmail.com"], result.ProviderName)
+}
+
+func TestRegistry_WeightedSkipsDisabled(t *testing.T) {
+	registry := newBalancedRegistry(t, false)
+	registry.pick = func(n int) int { return n - 1 }
+	assert.NoError(t, registry.Disable("ses"))
+
+	result, err := registry.Send(context.Background(), emailTo("user@example.org"), "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "brevo", result.ProviderName)
+}
+
+func TestRegistry_SetWeightsErrors(t *testing.T) {
+	registry := NewRegistry()
+	_ = registry.Register(NewMockProvider("brevo"))
+
+	assert.ErrorContains(t, registry.SetWeights(map[string]int{"ses": 10}, false), "provider not found: ses")
+	assert.ErrorContains(t, registry.SetWeights(map[string]int{"brevo": -1}, false), "must not be negative")
+	assert.ErrorContains(t, registry.SetWeights(map[string]int{"brevo": 0}, false), "must not all be zero")
+
+	assert.NoError(t, registry.SetWeights(map[string]int{"brevo": 1}, false))
+	assert.Equal(t, map[string]int{"brevo": 1}, registry.Weights())
+	assert.NoError(t, registry.SetWeights(nil, false))
+	assert.Nil(t, registry.Weights())
+}
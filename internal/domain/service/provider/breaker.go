@@ -0,0 +1,252 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/core/logger"
+	"github.com/itsLeonB/smtproxy/internal/core/metrics"
+)
+
+// ErrCircuitOpen is returned when sending through a provider whose circuit
+// breaker is open and no other provider can take the message
+var ErrCircuitOpen = errors.New("provider circuit open")
+
+// CircuitState is the state of a provider's circuit breaker
+type CircuitState int
+
+const (
+	// CircuitClosed lets every send through
+	CircuitClosed CircuitState = iota
+	// CircuitHalfOpen lets one probe send through at a time
+	CircuitHalfOpen
+	// CircuitOpen refuses sends until the cooldown has passed
+	CircuitOpen
+)
+
+// String returns the state as reported by the health endpoint
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitHalfOpen:
+		return "half_open"
+	case CircuitOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// BreakerConfig configures the circuit breaker kept for each provider
+type BreakerConfig struct {
+	// Threshold is the number of consecutive transient failures that open
+	// a circuit; zero disables the breaker
+	Threshold int
+	// Cooldown is how long a circuit stays open before probes are let through
+	Cooldown time.Duration
+	// Probes is the number of consecutive successful probes that close a
+	// half-open circuit
+	Probes int
+	// Failover sends messages for a provider whose circuit is open through
+	// another provider instead of failing fast
+	Failover bool
+}
+
+// Transient is implemented by provider errors that know whether they were
+// caused by the provider, such as a server error, rather than by the message
+type Transient interface {
+	Transient() bool
+}
+
+// IsTransient reports whether err means the provider is unreachable or
+// failing: an error that says so, a network error or a timeout
+func IsTransient(err error) bool {
+	var transient Transient
+	if errors.As(err, &transient) {
+		return transient.Transient()
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// breaker tracks the consecutive failures of one provider
+type breaker struct {
+	state     CircuitState
+	failures  int
+	successes int
+	openedAt  time.Time
+	// probing is set while a half-open circuit's probe is in flight
+	probing bool
+}
+
+// SetBreaker configures the circuit breakers, closing every circuit
+func (r *Registry) SetBreaker(config BreakerConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.breakerConfig = config
+	r.breakers = make(map[string]*breaker)
+	for name := range r.providers {
+		metrics.CircuitState.WithLabelValues(name).Set(float64(CircuitClosed))
+	}
+}
+
+// Circuit returns the state of a provider's circuit breaker. An open
+// circuit whose cooldown has passed is reported as half-open.
+func (r *Registry) Circuit(name string) CircuitState {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	b, exists := r.breakers[name]
+	if !exists {
+		return CircuitClosed
+	}
+	if b.state == CircuitOpen && r.now().Sub(b.openedAt) >= r.breakerConfig.Cooldown {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// allow reports whether a send through the named provider may go ahead,
+// half-opening its circuit once the cooldown has passed. A send allowed
+// through a half-open circuit is its probe and must be followed by record
+// or release.
+func (r *Registry) allow(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, exists := r.breakers[name]
+	if r.breakerConfig.Threshold <= 0 || !exists {
+		return true
+	}
+
+	switch b.state {
+	case CircuitOpen:
+		if r.now().Sub(b.openedAt) < r.breakerConfig.Cooldown {
+			return false
+		}
+		r.transition(name, b, CircuitHalfOpen)
+		b.probing = true
+		return true
+	case CircuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// release frees the probe slot of a send that was allowed but never made
+func (r *Registry) release(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if b, exists := r.breakers[name]; exists {
+		b.probing = false
+	}
+}
+
+// failoverKey marks contexts whose send may move to another provider
+type failoverKey struct{}
+
+// WithFailover returns ctx marking its send as free to go through another
+// provider while the chosen one's circuit is open. Only sends whose provider
+// was picked by weight should carry it: a provider named by a policy, a
+// routing rule or an operator is never swapped for another.
+func WithFailover(ctx context.Context) context.Context {
+	return context.WithValue(ctx, failoverKey{}, true)
+}
+
+// CanFailover reports whether ctx was marked by WithFailover
+func CanFailover(ctx context.Context) bool {
+	allowed, _ := ctx.Value(failoverKey{}).(bool)
+	return allowed
+}
+
+// failover returns a provider other than name that can take a send while
+// name's circuit is open: the default provider, else the first in
+// alphabetical order that is enabled and whose circuit allows it
+func (r *Registry) failover(name string) Provider {
+	r.mu.RLock()
+	enabled := r.breakerConfig.Failover
+	candidates := []string{r.defaultProvider}
+	r.mu.RUnlock()
+	if !enabled {
+		return nil
+	}
+
+	for _, candidate := range append(candidates, r.ListProviders()...) {
+		if candidate == name || candidate == "" || !r.Enabled(candidate) {
+			continue
+		}
+		if r.allow(candidate) {
+			p, err := r.GetProvider(candidate)
+			if err != nil {
+				r.release(candidate)
+				continue
+			}
+			return p
+		}
+	}
+	return nil
+}
+
+// trip updates a provider's circuit with the outcome of a send. Only
+// transient failures count against a provider; any other outcome shows it
+// is answering. The caller must hold r.mu.
+func (r *Registry) trip(name string, err error) {
+	if r.breakerConfig.Threshold <= 0 {
+		return
+	}
+	b, exists := r.breakers[name]
+	if !exists {
+		b = &breaker{}
+		r.breakers[name] = b
+	}
+	b.probing = false
+
+	if err != nil && IsTransient(err) {
+		b.successes = 0
+		b.failures++
+		// Sends that started before the circuit opened don't extend the cooldown
+		if b.state == CircuitOpen {
+			return
+		}
+		if b.state == CircuitHalfOpen || b.failures >= r.breakerConfig.Threshold {
+			b.openedAt = r.now()
+			r.transition(name, b, CircuitOpen)
+		}
+		return
+	}
+
+	b.failures = 0
+	if b.state == CircuitHalfOpen {
+		b.successes++
+		if b.successes >= r.breakerConfig.Probes {
+			b.successes = 0
+			r.transition(name, b, CircuitClosed)
+		}
+	}
+}
+
+// transition moves a circuit to state and publishes the change
+func (r *Registry) transition(name string, b *breaker, state CircuitState) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	metrics.CircuitState.WithLabelValues(name).Set(float64(state))
+	metrics.CircuitTransitions.WithLabelValues(name, state.String()).Inc()
+
+	switch state {
+	case CircuitOpen:
+		logger.WarnContext(context.Background(), "provider circuit opened", "provider", name, "failures", b.failures, "cooldown", r.breakerConfig.Cooldown)
+	default:
+		logger.InfoContext(context.Background(), "provider circuit "+strings.ReplaceAll(state.String(), "_", "-"), "provider", name)
+	}
+}
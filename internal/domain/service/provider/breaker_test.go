@@ -0,0 +1,133 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// transientError is a provider error that reports whether it is transient
+type transientError bool
+
+func (e transientError) Error() string   { return "provider error" }
+func (e transientError) Transient() bool { return bool(e) }
+
+func newBreakerRegistry(t *testing.T, config BreakerConfig) (*Registry, *MockProvider, *fakeClock) {
+	t.Helper()
+	mock := NewMockProvider("brevo")
+	registry, clock := newClockedRegistry(t, mock)
+	registry.SetBreaker(config)
+	return registry, mock, clock
+}
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, IsTransient(transientError(true)))
+	assert.False(t, IsTransient(fmt.Errorf("send: %w", transientError(false))))
+	assert.True(t, IsTransient(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+	assert.True(t, IsTransient(fmt.Errorf("request failed: %w", context.DeadlineExceeded)))
+	assert.False(t, IsTransient(errors.New("authentication failed")))
+}
+
+func TestRegistry_CircuitOpensAfterThreshold(t *testing.T) {
+	registry, mock, _ := newBreakerRegistry(t, BreakerConfig{Threshold: 3, Cooldown: time.Minute, Probes: 1})
+	mock.SetSendError(transientError(true))
+
+	for range 3 {
+		_, err := registry.Send(context.Background(), emailTo("user@example.org"), "")
+		assert.ErrorIs(t, err, transientError(true))
+	}
+	assert.Equal(t, CircuitOpen, registry.Circuit("brevo"))
+
+	result, err := registry.Send(context.Background(), emailTo("user@example.org"), "")
+
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, "brevo", result.ProviderName)
+	assert.Equal(t, uint64(3), registry.Stats("brevo").Failed)
+}
+
+func TestRegistry_CircuitIgnoresPermanentFailures(t *testing.T) {
+	registry, mock, _ := newBreakerRegistry(t, BreakerConfig{Threshold: 2, Cooldown: time.Minute, Probes: 1})
+
+	for _, err := range []error{transientError(true), errors.New("invalid email address"), transientError(true)} {
+		mock.SetSendError(err)
+		_, _ = registry.Send(context.Background(), emailTo("user@example.org"), "")
+	}
+
+	assert.Equal(t, CircuitClosed, registry.Circuit("brevo"))
+}
+
+func TestRegistry_CircuitHalfOpenProbes(t *testing.T) {
+	registry, mock, clock := newBreakerRegistry(t, BreakerConfig{Threshold: 1, Cooldown: time.Minute, Probes: 2})
+	mock.SetSendError(transientError(true))
+	_, _ = registry.Send(context.Background(), emailTo("user@example.org"), "")
+	assert.Equal(t, CircuitOpen, registry.Circuit("brevo"))
+
+	// A failed probe opens the circuit for another cooldown
+	clock.Advance(time.Minute)
+	assert.Equal(t, CircuitHalfOpen, registry.Circuit("brevo"))
+	_, err := registry.Send(context.Background(), emailTo("user@example.org"), "")
+	assert.ErrorIs(t, err, transientError(true))
+	assert.Equal(t, CircuitOpen, registry.Circuit("brevo"))
+
+	clock.Advance(time.Minute)
+	mock.SetSendError(nil)
+	assert.True(t, registry.allow("brevo"))
+	assert.False(t, registry.allow("brevo"), "only one probe at a time")
+	registry.record("brevo", nil)
+	assert.Equal(t, CircuitHalfOpen, registry.Circuit("brevo"))
+
+	_, err = registry.Send(context.Background(), emailTo("user@example.org"), "")
+	assert.NoError(t, err)
+	assert.Equal(t, CircuitClosed, registry.Circuit("brevo"))
+}
+
+func TestRegistry_CircuitFailover(t *testing.T) {
+	registry, mock, _ := newBreakerRegistry(t, BreakerConfig{Threshold: 1, Cooldown: time.Minute, Probes: 1, Failover: true})
+	assert.NoError(t, registry.Register(NewMockProvider("ses")))
+	mock.SetSendError(transientError(true))
+	_, _ = registry.Send(context.Background(), emailTo("user@example.org"), "brevo")
+
+	// Sends to the default or to a weighted pick move to another provider
+	result, err := registry.Send(context.Background(), emailTo("user@example.org"), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "ses", result.ProviderName)
+
+	result, err = registry.Send(WithFailover(context.Background()), emailTo("user@example.org"), "brevo")
+	assert.NoError(t, err)
+	assert.Equal(t, "ses", result.ProviderName)
+
+	// A provider asked for by name is never swapped for another
+	result, err = registry.Send(context.Background(), emailTo("user@example.org"), "brevo")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, "brevo", result.ProviderName)
+
+	// Without another usable provider the send fails fast
+	assert.NoError(t, registry.Disable("ses"))
+	_, err = registry.Send(context.Background(), emailTo("user@example.org"), "")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+}
+
+func TestRegistry_CircuitDisabled(t *testing.T) {
+	registry, mock, _ := newBreakerRegistry(t, BreakerConfig{})
+	mock.SetSendError(transientError(true))
+
+	for range 10 {
+		_, _ = registry.Send(context.Background(), emailTo("user@example.org"), "")
+	}
+
+	assert.Equal(t, CircuitClosed, registry.Circuit("brevo"))
+}
+
+func TestRegistry_CircuitIgnoresCancelledSends(t *testing.T) {
+	registry, mock, _ := newBreakerRegistry(t, BreakerConfig{Threshold: 1, Cooldown: time.Minute, Probes: 1})
+	mock.SetSendError(&net.OpError{Op: "read", Err: context.Canceled})
+
+	_, _ = registry.Send(context.Background(), emailTo("user@example.org"), "")
+
+	assert.Equal(t, CircuitClosed, registry.Circuit("brevo"))
+}
@@ -0,0 +1,135 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+	"golang.org/x/net/idna"
+)
+
+// ErrEAIUnsupported is returned when an address needs SMTPUTF8 but the provider cannot handle it
+var ErrEAIUnsupported = errors.New("internationalized address not supported by provider")
+
+// ErrInvalidDomain is returned when an internationalized domain has no valid ASCII form
+var ErrInvalidDomain = errors.New("invalid address domain")
+
+// EAICapable is implemented by providers that accept UTF-8 addresses (RFC 6531)
+type EAICapable interface {
+	SupportsEAI() bool
+}
+
+// supportsEAI reports whether a provider declares EAI support
+func supportsEAI(provider Provider) bool {
+	capable, ok := provider.(EAICapable)
+	return ok && capable.SupportsEAI()
+}
+
+// ToASCII returns a copy of email whose address domains are punycoded. It fails
+// with ErrEAIUnsupported when a local part is non-ASCII, since that has no ASCII
+// form, and with ErrInvalidDomain when a domain cannot be punycoded.
+func ToASCII(email *entity.Email) (*entity.Email, error) {
+	converted := *email
+
+	var err error
+	if converted.Envelope.From, err = addressToASCII(email.Envelope.From); err != nil {
+		return nil, err
+	}
+	if converted.Envelope.To, err = addressesToASCII(email.Envelope.To); err != nil {
+		return nil, err
+	}
+
+	if converted.Headers.From, err = mailAddressToASCII(email.Headers.From); err != nil {
+		return nil, err
+	}
+	if converted.Headers.To, err = mailAddressListToASCII(email.Headers.To); err != nil {
+		return nil, err
+	}
+	if converted.Headers.CC, err = mailAddressListToASCII(email.Headers.CC); err != nil {
+		return nil, err
+	}
+	if converted.Headers.BCC, err = mailAddressListToASCII(email.Headers.BCC); err != nil {
+		return nil, err
+	}
+
+	return &converted, nil
+}
+
+// IsASCII reports whether s contains only ASCII characters
+func IsASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// addressToASCII punycodes the domain of a bare address
+func addressToASCII(address string) (string, error) {
+	if IsASCII(address) {
+		return address, nil
+	}
+
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return "", fmt.Errorf("%w: %s", ErrEAIUnsupported, address)
+	}
+
+	local, domain := address[:at], address[at+1:]
+	if !IsASCII(local) {
+		return "", fmt.Errorf("%w: %s", ErrEAIUnsupported, address)
+	}
+
+	asciiDomain, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return "", fmt.Errorf("%w %q: %v", ErrInvalidDomain, domain, err)
+	}
+
+	return local + "@" + asciiDomain, nil
+}
+
+func addressesToASCII(addresses []string) ([]string, error) {
+	if addresses == nil {
+		return nil, nil
+	}
+
+	converted := make([]string, len(addresses))
+	for i, address := range addresses {
+		var err error
+		if converted[i], err = addressToASCII(address); err != nil {
+			return nil, err
+		}
+	}
+	return converted, nil
+}
+
+func mailAddressToASCII(address *mail.Address) (*mail.Address, error) {
+	if address == nil {
+		return nil, nil
+	}
+
+	ascii, err := addressToASCII(address.Address)
+	if err != nil {
+		return nil, err
+	}
+	return &mail.Address{Name: address.Name, Address: ascii}, nil
+}
+
+func mailAddressListToASCII(addresses []*mail.Address) ([]*mail.Address, error) {
+	if addresses == nil {
+		return nil, nil
+	}
+
+	converted := make([]*mail.Address, len(addresses))
+	for i, address := range addresses {
+		var err error
+		if converted[i], err = mailAddressToASCII(address); err != nil {
+			return nil, err
+		}
+	}
+	return converted, nil
+}
@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"context"
+	"net/mail"
+	"testing"
+
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToASCII_PunycodesDomains(t *testing.T) {
+	email := &entity.Email{
+		Envelope: entity.Envelope{
+			From: "sender@bücher.de",
+			To:   []string{"user@例子.广告"},
+		},
+		Headers: entity.Headers{
+			From: &mail.Address{Name: "Bücher", Address: "sender@bücher.de"},
+			To:   []*mail.Address{{Address: "user@例子.广告"}},
+			CC:   []*mail.Address{{Address: "plain@example.com"}},
+		},
+	}
+
+	converted, err := ToASCII(email)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "sender@xn--bcher-kva.de", converted.Envelope.From)
+	assert.Equal(t, []string{"user@xn--fsqu00a.xn--4rr70v"}, converted.Envelope.To)
+	assert.Equal(t, "Bücher", converted.Headers.From.Name)
+	assert.Equal(t, "sender@xn--bcher-kva.de", converted.Headers.From.Address)
+	assert.Equal(t, "user@xn--fsqu00a.xn--4rr70v", converted.Headers.To[0].Address)
+	assert.Equal(t, "plain@example.com", converted.Headers.CC[0].Address)
+
+	// The original is left untouched for other providers and retries
+	assert.Equal(t, "sender@bücher.de", email.Headers.From.Address)
+}
+
+func TestToASCII_RejectsUTF8LocalPart(t *testing.T) {
+	email := &entity.Email{
+		Headers: entity.Headers{
+			To: []*mail.Address{{Address: "用户@example.com"}},
+		},
+	}
+
+	_, err := ToASCII(email)
+
+	assert.ErrorIs(t, err, ErrEAIUnsupported)
+}
+
+func TestToASCII_InvalidDomain(t *testing.T) {
+	email := &entity.Email{Envelope: entity.Envelope{To: []string{"user@exa_mple.测试"}}}
+
+	_, err := ToASCII(email)
+
+	assert.ErrorIs(t, err, ErrInvalidDomain)
+}
+
+func TestRegistry_SendEAI(t *testing.T) {
+	email := &entity.Email{
+		Headers: entity.Headers{
+			To: []*mail.Address{{Address: "用户@example.com"}},
+		},
+	}
+
+	registry := NewRegistry()
+	_ = registry.Register(NewMockProvider("ascii-only"))
+
+	_, err := registry.Send(context.Background(), email, "")
+	assert.ErrorIs(t, err, ErrEAIUnsupported)
+
+	eaiProvider := NewMockProvider("eai")
+	eaiProvider.SetEAI(true)
+	_ = registry.Register(eaiProvider)
+
+	result, err := registry.Send(context.Background(), email, "eai")
+	assert.NoError(t, err)
+	assert.Equal(t, "eai", result.ProviderName)
+}
@@ -10,8 +10,10 @@ import (
 // MockProvider is a test implementation of Provider
 type MockProvider struct {
 	name      string
+	messageID string
 	sendError error
 	healthy   bool
+	eai       bool
 }
 
 // NewMockProvider creates a new mock provider
@@ -28,8 +30,11 @@ func (m *MockProvider) Name() string {
 }
 
 // Send simulates sending an email
-func (m *MockProvider) Send(ctx context.Context, email *entity.Email) error {
-	return m.sendError
+func (m *MockProvider) Send(ctx context.Context, email *entity.Email) (string, error) {
+	if m.sendError != nil {
+		return "", m.sendError
+	}
+	return m.messageID, nil
 }
 
 // IsHealthy returns the health status
@@ -45,7 +50,22 @@ func (m *MockProvider) SetSendError(err error) {
 	m.sendError = err
 }
 
+// SetMessageID sets the message ID returned by successful sends
+func (m *MockProvider) SetMessageID(id string) {
+	m.messageID = id
+}
+
 // SetHealthy sets the health status
 func (m *MockProvider) SetHealthy(healthy bool) {
 	m.healthy = healthy
 }
+
+// SupportsEAI reports whether the mock accepts UTF-8 addresses
+func (m *MockProvider) SupportsEAI() bool {
+	return m.eai
+}
+
+// SetEAI sets whether the mock accepts UTF-8 addresses
+func (m *MockProvider) SetEAI(eai bool) {
+	m.eai = eai
+}
@@ -11,8 +11,9 @@ type Provider interface {
 	// Name returns the provider identifier
 	Name() string
 	
-	// Send sends an email via the provider's API
-	Send(ctx context.Context, email *entity.Email) error
+	// Send sends an email via the provider's API and returns the ID the
+	// provider assigned to it, or "" if it assigns none
+	Send(ctx context.Context, email *entity.Email) (string, error)
 	
 	// IsHealthy checks if the provider is available
 	IsHealthy(ctx context.Context) error
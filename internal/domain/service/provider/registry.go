@@ -3,22 +3,56 @@ package provider
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/itsLeonB/smtproxy/internal/core/logger"
+	"github.com/itsLeonB/smtproxy/internal/core/metrics"
 	"github.com/itsLeonB/smtproxy/internal/domain/entity"
 )
 
+// ErrProviderDisabled is returned when sending through a provider an operator disabled
+var ErrProviderDisabled = errors.New("provider disabled")
+
+// Stats counts the sends made through a provider since startup
+type Stats struct {
+	Sent        uint64
+	Failed      uint64
+	LastSuccess time.Time
+	LastFailure time.Time
+	LastError   string
+}
+
 // Registry manages registered providers and routing
 type Registry struct {
 	mu              sync.RWMutex
 	providers       map[string]Provider
 	defaultProvider string
+	disabled        map[string]bool
+	stats           map[string]*Stats
+	balancer        *balancer
+	breakerConfig   BreakerConfig
+	breakers        map[string]*breaker
+	throttles       map[string]*throttle
+	throttleWait    time.Duration
+	now             func() time.Time
+	// pick returns a random number in [0, n) for weighted balancing
+	pick func(n int) int
 }
 
 // NewRegistry creates a new provider registry
 func NewRegistry() *Registry {
 	return &Registry{
-		providers: make(map[string]Provider),
+		providers:    make(map[string]Provider),
+		disabled:     make(map[string]bool),
+		stats:        make(map[string]*Stats),
+		breakers:     make(map[string]*breaker),
+		throttles:    make(map[string]*throttle),
+		throttleWait: defaultThrottleWait,
+		now:          time.Now,
+		pick:         randomPick,
 	}
 }
 
@@ -33,6 +67,11 @@ func (r *Registry) Register(provider Provider) error {
 	}
 	
 	r.providers[name] = provider
+	if reporter, ok := provider.(RateLimitReporter); ok {
+		reporter.OnRateLimit(func(remaining int, reset time.Duration) {
+			r.observeRateLimit(name, remaining, reset)
+		})
+	}
 	
 	// Set as default if it's the first provider
 	if r.defaultProvider == "" {
@@ -80,11 +119,17 @@ func (r *Registry) GetDefault() (Provider, error) {
 	return r.providers[r.defaultProvider], nil
 }
 
-// Send routes email to the specified provider or default
+// Send routes email to the specified provider, else a weighted one, else the
+// default. Only a send to the default or a weighted provider, or one whose ctx
+// carries WithFailover, fails over while its provider's circuit is open.
 func (r *Registry) Send(ctx context.Context, email *entity.Email, providerName string) (*SendResult, error) {
 	var provider Provider
 	var err error
 	
+	canFailover := providerName == "" || CanFailover(ctx)
+	if providerName == "" {
+		providerName = r.Balance(email)
+	}
 	if providerName != "" {
 		provider, err = r.GetProvider(providerName)
 		if err != nil {
@@ -97,14 +142,53 @@ func (r *Registry) Send(ctx context.Context, email *entity.Email, providerName s
 		}
 	}
 	
-	err = provider.Send(ctx, email)
+	if !r.Enabled(provider.Name()) {
+		err = fmt.Errorf("%w: %s", ErrProviderDisabled, provider.Name())
+		return &SendResult{ProviderName: provider.Name(), Error: err}, err
+	}
+
+	// An open circuit fails fast instead of waiting for the provider to time out
+	if !r.allow(provider.Name()) {
+		metrics.CircuitRejections.WithLabelValues(provider.Name()).Inc()
+		var fallback Provider
+		if canFailover {
+			fallback = r.failover(provider.Name())
+		}
+		if fallback == nil {
+			err = fmt.Errorf("%w: %s", ErrCircuitOpen, provider.Name())
+			return &SendResult{ProviderName: provider.Name(), Error: err}, err
+		}
+		logger.WarnContext(ctx, "provider circuit open, failing over", "provider", provider.Name(), "failover", fallback.Name())
+		provider = fallback
+	}
+
+	// Providers without EAI support get punycoded domains, or a rejection for UTF-8 local parts
+	if !supportsEAI(provider) {
+		email, err = ToASCII(email)
+		if err != nil {
+			r.release(provider.Name())
+			return &SendResult{ProviderName: provider.Name(), Error: err}, err
+		}
+	}
+
+	if err = r.wait(ctx, provider.Name()); err != nil {
+		r.release(provider.Name())
+		return &SendResult{ProviderName: provider.Name(), Error: err}, err
+	}
+
+	messageID, err := provider.Send(ctx, email)
+	if wait := RetryAfter(err); wait > 0 {
+		r.holdOff(provider.Name(), wait)
+	}
+	r.record(provider.Name(), err)
 	return &SendResult{
 		ProviderName: provider.Name(),
+		MessageID:    messageID,
 		Error:        err,
 	}, err
 }
 
-// ListProviders returns all registered provider names
+// ListProviders returns all registered provider names in alphabetical order
 func (r *Registry) ListProviders() []string {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -113,5 +197,126 @@ func (r *Registry) ListProviders() []string {
 	for name := range r.providers {
 		names = append(names, name)
 	}
+	sort.Strings(names)
 	return names
 }
+
+// Default returns the name of the default provider, or "" if there is none
+func (r *Registry) Default() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.defaultProvider
+}
+
+// Enable lets a disabled provider send again
+func (r *Registry) Enable(name string) error {
+	return r.setEnabled(name, true)
+}
+
+// Disable makes sends through a provider fail with ErrProviderDisabled
+// until it is enabled again
+func (r *Registry) Disable(name string) error {
+	return r.setEnabled(name, false)
+}
+
+func (r *Registry) setEnabled(name string, enabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.providers[name]; !exists {
+		return errors.New("provider not found: " + name)
+	}
+	if enabled {
+		delete(r.disabled, name)
+	} else {
+		r.disabled[name] = true
+	}
+	return nil
+}
+
+// Enabled reports whether a provider has not been disabled
+func (r *Registry) Enabled(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return !r.disabled[name]
+}
+
+// Stats returns the send counters for a provider
+func (r *Registry) Stats(name string) Stats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if stats, exists := r.stats[name]; exists {
+		return *stats
+	}
+	return Stats{}
+}
+
+// Inherit carries the runtime state of previous over to the providers r
+// shares with it, so that replacing previous on a reload keeps what
+// operators and providers changed: which are disabled, their send counters,
+// their circuit breakers unless the breaker settings changed, and their
+// throttles unless their rate limit changed. r must not be in use yet.
+func (r *Registry) Inherit(previous *Registry) {
+	previous.mu.RLock()
+	defer previous.mu.RUnlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for name := range r.providers {
+		if previous.disabled[name] {
+			r.disabled[name] = true
+		}
+		if stats, exists := previous.stats[name]; exists {
+			copied := *stats
+			r.stats[name] = &copied
+		}
+		if b, exists := previous.breakers[name]; exists && r.breakerConfig == previous.breakerConfig {
+			copied := *b
+			// A probe still in flight reports to previous, so r starts a new one
+			copied.probing = false
+			r.breakers[name] = &copied
+			metrics.CircuitState.WithLabelValues(name).Set(float64(copied.state))
+		}
+		if t, exists := previous.throttles[name]; exists {
+			current := r.throttleFor(name)
+			if current.configured == t.configured {
+				// The limiter is safe to share with sends still going through previous
+				*current = *t
+			} else {
+				current.until = t.until
+			}
+		}
+	}
+}
+
+// record updates a provider's send counters and circuit breaker
+func (r *Registry) record(name string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// A send cancelled by the caller says nothing about the provider
+	if errors.Is(err, context.Canceled) {
+		if b, exists := r.breakers[name]; exists {
+			b.probing = false
+		}
+	} else {
+		r.trip(name, err)
+	}
+
+	stats, exists := r.stats[name]
+	if !exists {
+		stats = &Stats{}
+		r.stats[name] = stats
+	}
+	if err != nil {
+		stats.Failed++
+		stats.LastFailure = r.now()
+		stats.LastError = err.Error()
+		return
+	}
+	stats.Sent++
+	stats.LastSuccess = r.now()
+}
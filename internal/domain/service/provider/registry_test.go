@@ -2,12 +2,32 @@ package provider
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/itsLeonB/smtproxy/internal/domain/entity"
 	"github.com/stretchr/testify/assert"
 )
 
+// fakeClock is a time source that only moves when a test advances it
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// newClockedRegistry returns a registry holding p that reads its time from a fake clock
+func newClockedRegistry(t *testing.T, p Provider) (*Registry, *fakeClock) {
+	t.Helper()
+	registry := NewRegistry()
+	assert.NoError(t, registry.Register(p))
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	registry.now = clock.Now
+	return registry, clock
+}
+
 func TestRegistry_Register(t *testing.T) {
 	registry := NewRegistry()
 	provider := NewMockProvider("test-provider")
@@ -84,6 +104,7 @@ func TestRegistry_GetDefaultNoProviders(t *testing.T) {
 func TestRegistry_Send(t *testing.T) {
 	registry := NewRegistry()
 	provider := NewMockProvider("test-provider")
+	provider.SetMessageID("<abc@example.com>")
 	_ = registry.Register(provider)
 
 	email := &entity.Email{}
@@ -91,6 +112,7 @@ func TestRegistry_Send(t *testing.T) {
 	result, err := registry.Send(context.Background(), email, "")
 	assert.NoError(t, err)
 	assert.Equal(t, "test-provider", result.ProviderName)
+	assert.Equal(t, "<abc@example.com>", result.MessageID)
 	assert.NoError(t, result.Error)
 }
 
@@ -131,3 +153,89 @@ func TestRegistry_ListProviders(t *testing.T) {
 	assert.Contains(t, providers, "provider1")
 	assert.Contains(t, providers, "provider2")
 }
+
+func TestRegistry_Disable(t *testing.T) {
+	registry := NewRegistry()
+	_ = registry.Register(NewMockProvider("provider1"))
+	email := &entity.Email{}
+
+	assert.NoError(t, registry.Disable("provider1"))
+	assert.False(t, registry.Enabled("provider1"))
+
+	_, err := registry.Send(context.Background(), email, "")
+	assert.ErrorIs(t, err, ErrProviderDisabled)
+
+	assert.NoError(t, registry.Enable("provider1"))
+	_, err = registry.Send(context.Background(), email, "")
+	assert.NoError(t, err)
+
+	assert.Error(t, registry.Disable("nonexistent"))
+}
+
+func TestRegistry_Stats(t *testing.T) {
+	registry := NewRegistry()
+	provider := NewMockProvider("provider1")
+	_ = registry.Register(provider)
+	email := &entity.Email{}
+
+	_, _ = registry.Send(context.Background(), email, "")
+	provider.SetSendError(errors.New("rate limit"))
+	_, _ = registry.Send(context.Background(), email, "")
+
+	stats := registry.Stats("provider1")
+	assert.Equal(t, uint64(1), stats.Sent)
+	assert.Equal(t, uint64(1), stats.Failed)
+	assert.Equal(t, "rate limit", stats.LastError)
+	assert.False(t, stats.LastSuccess.IsZero())
+	assert.Equal(t, Stats{}, registry.Stats("nonexistent"))
+}
+
+func TestRegistry_Default(t *testing.T) {
+	registry := NewRegistry()
+	assert.Empty(t, registry.Default())
+
+	_ = registry.Register(NewMockProvider("provider1"))
+	assert.Equal(t, "provider1", registry.Default())
+}
+
+func TestRegistry_Inherit(t *testing.T) {
+	breakers := BreakerConfig{Threshold: 1, Cooldown: time.Minute, Probes: 1}
+	previous := NewRegistry()
+	failing := NewMockProvider("brevo")
+	failing.SetSendError(transientError(true))
+	_ = previous.Register(failing)
+	_ = previous.Register(NewMockProvider("backup"))
+	_ = previous.Register(NewMockProvider("removed"))
+	previous.SetBreaker(breakers)
+	_ = previous.SetRateLimit("brevo", 10)
+	_, _ = previous.Send(context.Background(), &entity.Email{}, "brevo")
+	previous.holdOff("brevo", time.Minute)
+	assert.NoError(t, previous.Disable("backup"))
+	assert.NoError(t, previous.Disable("removed"))
+
+	registry := NewRegistry()
+	_ = registry.Register(NewMockProvider("brevo"))
+	_ = registry.Register(NewMockProvider("backup"))
+	registry.SetBreaker(breakers)
+	_ = registry.SetRateLimit("brevo", 10)
+	registry.Inherit(previous)
+
+	assert.False(t, registry.Enabled("backup"))
+	assert.True(t, registry.Enabled("brevo"))
+	assert.Equal(t, uint64(1), registry.Stats("brevo").Failed)
+	assert.Equal(t, CircuitOpen, registry.Circuit("brevo"))
+	assert.Equal(t, previous.throttles["brevo"].until, registry.throttles["brevo"].until)
+	assert.Same(t, previous.throttles["brevo"].limiter, registry.throttles["brevo"].limiter)
+	assert.NotContains(t, registry.providers, "removed")
+
+	// Changed settings start afresh
+	changed := NewRegistry()
+	_ = changed.Register(NewMockProvider("brevo"))
+	changed.SetBreaker(BreakerConfig{Threshold: 5, Cooldown: time.Minute, Probes: 1})
+	_ = changed.SetRateLimit("brevo", 20)
+	changed.Inherit(previous)
+
+	assert.Equal(t, CircuitClosed, changed.Circuit("brevo"))
+	assert.NotSame(t, previous.throttles["brevo"].limiter, changed.throttles["brevo"].limiter)
+	assert.Equal(t, previous.throttles["brevo"].until, changed.throttles["brevo"].until)
+}
@@ -0,0 +1,210 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/core/metrics"
+	"golang.org/x/time/rate"
+)
+
+// defaultThrottleWait is how long a send waits for a rate-limited provider
+// unless SetThrottleWait says otherwise
+const defaultThrottleWait = 5 * time.Second
+
+// Throttled is implemented by errors that say how long to wait before the
+// provider accepts sends again, such as an HTTP 429 with Retry-After
+type Throttled interface {
+	RetryAfter() time.Duration
+}
+
+// RetryAfter returns how long err says to wait before retrying, or zero
+func RetryAfter(err error) time.Duration {
+	var throttled Throttled
+	if errors.As(err, &throttled) {
+		return max(throttled.RetryAfter(), 0)
+	}
+	return 0
+}
+
+// RateLimitError is returned when a provider's rate limit would make a
+// send wait longer than allowed
+type RateLimitError struct {
+	Provider string
+	Wait     time.Duration
+}
+
+// Error describes the limit and when to retry
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit exceeded for provider %s, retry in %s", e.Provider, e.Wait)
+}
+
+// RetryAfter returns how long until the provider accepts a send
+func (e *RateLimitError) RetryAfter() time.Duration {
+	return e.Wait
+}
+
+// RateLimitReporter is implemented by providers that learn their quota
+// from API responses, such as rate limit headers
+type RateLimitReporter interface {
+	// OnRateLimit registers a function called with the requests remaining
+	// in the provider's current window and the time until it resets
+	OnRateLimit(func(remaining int, reset time.Duration))
+}
+
+// throttle paces the sends through one provider
+type throttle struct {
+	// configured is the sends per second allowed by configuration, 0 for no limit
+	configured float64
+	limiter    *rate.Limiter
+	// until holds sends back after a provider asked to wait or ran out of quota
+	until time.Time
+	// adaptedUntil is when a limit slowed to the reported quota reverts to configured
+	adaptedUntil time.Time
+}
+
+// limit returns the configured rate as a limiter rate
+func (t *throttle) limit() rate.Limit {
+	if t.configured <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(t.configured)
+}
+
+// SetRateLimit caps sends through a provider at perSecond, in bursts of up
+// to the next whole number. Zero removes the cap, though the provider can
+// still slow sends down through its responses.
+func (r *Registry) SetRateLimit(name string, perSecond float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.providers[name]; !exists {
+		return errors.New("provider not found: " + name)
+	}
+	if perSecond < 0 {
+		return fmt.Errorf("rate limit of provider %s must not be negative", name)
+	}
+
+	t := r.throttleFor(name)
+	t.configured = perSecond
+	t.adaptedUntil = time.Time{}
+	t.limiter = rate.NewLimiter(t.limit(), max(int(math.Ceil(perSecond)), 1))
+	return nil
+}
+
+// SetThrottleWait sets how long a send waits for a rate-limited provider
+// before failing with a RateLimitError
+func (r *Registry) SetThrottleWait(wait time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.throttleWait = wait
+}
+
+// throttleFor returns the throttle of a provider, creating an unlimited one.
+// The caller must hold r.mu.
+func (r *Registry) throttleFor(name string) *throttle {
+	t, exists := r.throttles[name]
+	if !exists {
+		t = &throttle{limiter: rate.NewLimiter(rate.Inf, 1)}
+		r.throttles[name] = t
+	}
+	return t
+}
+
+// wait holds a send back until the provider's rate limit allows it. It fails
+// with a RateLimitError instead if that takes longer than the throttle wait
+// or the deadline of ctx.
+func (r *Registry) wait(ctx context.Context, name string) error {
+	r.mu.Lock()
+	t, exists := r.throttles[name]
+	if !exists {
+		r.mu.Unlock()
+		return nil
+	}
+
+	now := r.now()
+	if !t.adaptedUntil.IsZero() && !now.Before(t.adaptedUntil) {
+		t.adaptedUntil = time.Time{}
+		t.limiter.SetLimitAt(now, t.limit())
+	}
+	start := now
+	if t.until.After(now) {
+		start = t.until
+	}
+	reservation := t.limiter.ReserveN(start, 1)
+	delay := reservation.DelayFrom(now)
+
+	limit := r.throttleWait
+	if deadline, ok := ctx.Deadline(); ok {
+		limit = min(limit, time.Until(deadline))
+	}
+	if !reservation.OK() || delay > max(limit, 0) {
+		reservation.CancelAt(now)
+		r.mu.Unlock()
+		metrics.ProviderThrottled.WithLabelValues(name, "rejected").Inc()
+		return &RateLimitError{Provider: name, Wait: delay}
+	}
+	r.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	metrics.ProviderThrottled.WithLabelValues(name, "waited").Inc()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		reservation.Cancel()
+		return ctx.Err()
+	}
+}
+
+// holdOff stops sends through a provider until it is ready again after it
+// answered with a wait
+func (r *Registry) holdOff(name string, wait time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := r.throttleFor(name)
+	if until := r.now().Add(wait); until.After(t.until) {
+		t.until = until
+	}
+}
+
+// observeRateLimit adapts a provider's pace to the quota its responses
+// report: sends stop once the quota is used up and are otherwise spread
+// over the rest of the window when that is slower than configured
+func (r *Registry) observeRateLimit(name string, remaining int, reset time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	metrics.ProviderQuotaRemaining.WithLabelValues(name).Set(float64(remaining))
+	if reset <= 0 {
+		return
+	}
+
+	t := r.throttleFor(name)
+	now := r.now()
+	if remaining <= 0 {
+		if until := now.Add(reset); until.After(t.until) {
+			t.until = until
+		}
+		return
+	}
+
+	adapted := rate.Limit(float64(remaining) / reset.Seconds())
+	switch {
+	case adapted < t.limit():
+		t.limiter.SetLimitAt(now, adapted)
+		t.adaptedUntil = now.Add(reset)
+	case !t.adaptedUntil.IsZero():
+		t.limiter.SetLimitAt(now, t.limit())
+		t.adaptedUntil = time.Time{}
+	}
+}
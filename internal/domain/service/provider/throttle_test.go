@@ -0,0 +1,136 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// throttledError is a provider error asking to wait before retrying
+type throttledError time.Duration
+
+func (e throttledError) Error() string             { return "rate limit exceeded" }
+func (e throttledError) RetryAfter() time.Duration { return time.Duration(e) }
+
+// reportingProvider is a mock that reports its quota to the registry
+type reportingProvider struct {
+	*MockProvider
+	report func(remaining int, reset time.Duration)
+}
+
+func (p *reportingProvider) OnRateLimit(fn func(remaining int, reset time.Duration)) {
+	p.report = fn
+}
+
+func newThrottledRegistry(t *testing.T) (*Registry, *MockProvider, *fakeClock) {
+	t.Helper()
+	mock := NewMockProvider("brevo")
+	registry, clock := newClockedRegistry(t, mock)
+	registry.SetThrottleWait(0)
+	return registry, mock, clock
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, 30*time.Second, RetryAfter(fmt.Errorf("send: %w", throttledError(30*time.Second))))
+	assert.Equal(t, time.Duration(0), RetryAfter(throttledError(-time.Second)))
+	assert.Equal(t, time.Duration(0), RetryAfter(errors.New("rate limit exceeded")))
+}
+
+func TestRegistry_RateLimit(t *testing.T) {
+	registry, _, clock := newThrottledRegistry(t)
+	assert.NoError(t, registry.SetRateLimit("brevo", 2))
+
+	for range 2 {
+		_, err := registry.Send(context.Background(), emailTo("user@example.org"), "")
+		assert.NoError(t, err)
+	}
+	_, err := registry.Send(context.Background(), emailTo("user@example.org"), "")
+
+	var limitErr *RateLimitError
+	assert.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, "brevo", limitErr.Provider)
+	assert.Equal(t, 500*time.Millisecond, limitErr.RetryAfter())
+
+	clock.Advance(500 * time.Millisecond)
+	_, err = registry.Send(context.Background(), emailTo("user@example.org"), "")
+	assert.NoError(t, err)
+}
+
+func TestRegistry_RateLimitWaits(t *testing.T) {
+	registry := NewRegistry()
+	assert.NoError(t, registry.Register(NewMockProvider("brevo")))
+	assert.NoError(t, registry.SetRateLimit("brevo", 100))
+
+	start := time.Now()
+	for range 101 {
+		_, err := registry.Send(context.Background(), emailTo("user@example.org"), "")
+		assert.NoError(t, err)
+	}
+
+	assert.GreaterOrEqual(t, time.Since(start), 5*time.Millisecond)
+}
+
+func TestRegistry_RateLimitErrors(t *testing.T) {
+	registry, _, _ := newThrottledRegistry(t)
+
+	assert.ErrorContains(t, registry.SetRateLimit("ses", 1), "provider not found: ses")
+	assert.ErrorContains(t, registry.SetRateLimit("brevo", -1), "must not be negative")
+}
+
+func TestRegistry_HoldsOffAfterRetryAfter(t *testing.T) {
+	registry, mock, clock := newThrottledRegistry(t)
+	mock.SetSendError(throttledError(30 * time.Second))
+	_, _ = registry.Send(context.Background(), emailTo("user@example.org"), "")
+	mock.SetSendError(nil)
+
+	clock.Advance(10 * time.Second)
+	_, err := registry.Send(context.Background(), emailTo("user@example.org"), "")
+	assert.Equal(t, 20*time.Second, RetryAfter(err))
+
+	clock.Advance(20 * time.Second)
+	_, err = registry.Send(context.Background(), emailTo("user@example.org"), "")
+	assert.NoError(t, err)
+}
+
+func TestRegistry_AdaptsToReportedQuota(t *testing.T) {
+	p := &reportingProvider{MockProvider: NewMockProvider("brevo")}
+	registry, clock := newClockedRegistry(t, p)
+	registry.SetThrottleWait(0)
+
+	// An exhausted quota holds sends back until the window resets
+	p.report(0, time.Minute)
+	_, err := registry.Send(context.Background(), emailTo("user@example.org"), "")
+	assert.Equal(t, time.Minute, RetryAfter(err))
+
+	// A low quota spreads the remaining sends over the window
+	clock.Advance(time.Minute)
+	p.report(6, time.Minute)
+	_, err = registry.Send(context.Background(), emailTo("user@example.org"), "")
+	assert.NoError(t, err)
+	_, err = registry.Send(context.Background(), emailTo("user@example.org"), "")
+	assert.Equal(t, 10*time.Second, RetryAfter(err))
+
+	// The configured pace returns with the next window
+	clock.Advance(time.Minute)
+	_, err = registry.Send(context.Background(), emailTo("user@example.org"), "")
+	assert.NoError(t, err)
+	_, err = registry.Send(context.Background(), emailTo("user@example.org"), "")
+	assert.NoError(t, err)
+}
+
+func TestRegistry_RateLimitRespectsDeadline(t *testing.T) {
+	registry, _, _ := newThrottledRegistry(t)
+	registry.SetThrottleWait(time.Hour)
+	assert.NoError(t, registry.SetRateLimit("brevo", 0.01))
+	_, _ = registry.Send(context.Background(), emailTo("user@example.org"), "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := registry.Send(ctx, emailTo("user@example.org"), "")
+
+	assert.Equal(t, 100*time.Second, RetryAfter(err))
+}
@@ -0,0 +1,500 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/core/logger"
+	"github.com/itsLeonB/smtproxy/internal/core/requestctx"
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/dispatcher"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/provider"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrQueueFull is returned when the queue cannot accept more messages
+var ErrQueueFull = errors.New("queue is full")
+
+// ErrQueueClosed is returned when enqueueing after Stop
+var ErrQueueClosed = errors.New("queue is closed")
+
+// ErrMessageNotFound is returned for an ID that is not in the queue
+var ErrMessageNotFound = errors.New("message not found")
+
+// ErrPurged is passed to purge handlers for messages removed without delivery
+var ErrPurged = errors.New("purged by administrator")
+
+// ErrDiscarded describes messages still undelivered when the queue shut down
+var ErrDiscarded = errors.New("discarded undelivered at shutdown")
+
+// Deliverer sends a single message to a provider and returns the
+// provider's message ID, if it assigns one
+type Deliverer interface {
+	Dispatch(ctx context.Context, email *entity.Email, providerName string) (string, error)
+}
+
+// Handler is called on delivery events for a queued message
+type Handler func(ctx context.Context, msg *Message, err error)
+
+// Config holds queue tuning parameters
+type Config struct {
+	Workers       int
+	Capacity      int
+	RetryInterval time.Duration
+	MaxAge        time.Duration
+	// AttemptTimeout bounds each delivery attempt; zero means no limit
+	AttemptTimeout time.Duration
+	// DelayNotice is how long a message must have been queued before a
+	// failed attempt calls the delay handlers; zero means the first one does
+	DelayNotice time.Duration
+}
+
+// Message is a queued email awaiting delivery
+type Message struct {
+	ID          string
+	SessionID   string
+	Email       *entity.Email
+	Provider    string
+	Attempts    int
+	EnqueuedAt  time.Time
+	NextAttempt time.Time
+	LastError   error
+	// ProviderMessageID is the ID the provider assigned once delivered
+	ProviderMessageID string
+
+	// delayNotified is set once the delay handlers have been called
+	delayNotified bool
+	// failover is set when the provider may be swapped for another while
+	// its circuit is open, as marked by provider.WithFailover
+	failover bool
+	// spanContext links delivery attempts to the trace of the SMTP transaction
+	spanContext trace.SpanContext
+}
+
+// Queue delivers accepted messages asynchronously with retries
+type Queue struct {
+	config    Config
+	deliverer Deliverer
+	onFailure []Handler
+	onDelay   []Handler
+	onSuccess []Handler
+	onPurge   []Handler
+
+	mu       sync.Mutex
+	messages map[string]*Message
+	timers   map[string]*time.Timer
+	closed   bool
+
+	ready    chan string
+	stopping chan struct{}
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	now      func() time.Time
+}
+
+// New creates a new delivery queue
+func New(config Config, deliverer Deliverer) *Queue {
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+	if config.Capacity <= 0 {
+		config.Capacity = 1000
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = time.Minute
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Queue{
+		config:    config,
+		deliverer: deliverer,
+		messages:  make(map[string]*Message),
+		timers:    make(map[string]*time.Timer),
+		ready:     make(chan string, config.Capacity),
+		stopping:  make(chan struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+		now:       time.Now,
+	}
+}
+
+// OnFailure adds a handler for permanently failed or expired messages
+func (q *Queue) OnFailure(handler Handler) {
+	q.onFailure = append(q.onFailure, handler)
+}
+
+// OnDelay adds a handler called once per message, on the first transient
+// failure after it has been queued for Config.DelayNotice
+func (q *Queue) OnDelay(handler Handler) {
+	q.onDelay = append(q.onDelay, handler)
+}
+
+// OnSuccess adds a handler for delivered messages
+func (q *Queue) OnSuccess(handler Handler) {
+	q.onSuccess = append(q.onSuccess, handler)
+}
+
+// OnPurge adds a handler for messages removed by Purge or PurgeAll
+func (q *Queue) OnPurge(handler Handler) {
+	q.onPurge = append(q.onPurge, handler)
+}
+
+// Start launches the delivery workers
+func (q *Queue) Start() {
+	for i := 0; i < q.config.Workers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+}
+
+// Stop cancels pending retries and in-flight deliveries, then waits for workers to return
+func (q *Queue) Stop() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	q.Shutdown(ctx)
+}
+
+// Shutdown stops accepting messages and pending retries, and lets deliveries
+// already in progress finish until ctx is done, after which they are
+// cancelled. It returns the messages left undelivered, oldest first.
+func (q *Queue) Shutdown(ctx context.Context) []Message {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		for id, timer := range q.timers {
+			timer.Stop()
+			delete(q.timers, id)
+		}
+		close(q.stopping)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		q.cancel()
+		<-done
+	}
+	q.cancel()
+
+	return q.Messages()
+}
+
+// Enqueue accepts a message for asynchronous delivery and returns its queue ID.
+// The message and session IDs carried by ctx are kept for delivery attempts.
+func (q *Queue) Enqueue(ctx context.Context, email *entity.Email, providerName string) (string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return "", ErrQueueClosed
+	}
+	if len(q.messages) >= q.config.Capacity {
+		return "", ErrQueueFull
+	}
+
+	id := requestctx.MessageID(ctx)
+	if id == "" {
+		id = requestctx.NewID()
+	}
+
+	now := q.now()
+	msg := &Message{
+		ID:          id,
+		SessionID:   requestctx.SessionID(ctx),
+		spanContext: trace.SpanContextFromContext(ctx),
+		failover:    provider.CanFailover(ctx),
+		Email:       email,
+		Provider:    providerName,
+		EnqueuedAt:  now,
+		NextAttempt: now,
+	}
+	q.messages[msg.ID] = msg
+	q.ready <- msg.ID
+
+	return msg.ID, nil
+}
+
+// Len returns the number of messages awaiting delivery
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.messages)
+}
+
+// Messages returns a snapshot of the queued messages, oldest first
+func (q *Queue) Messages() []Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	messages := make([]Message, 0, len(q.messages))
+	for _, msg := range q.messages {
+		messages = append(messages, *msg)
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].EnqueuedAt.Before(messages[j].EnqueuedAt)
+	})
+	return messages
+}
+
+// Get returns a snapshot of the queued message with the given ID
+func (q *Queue) Get(id string) (Message, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	msg, exists := q.messages[id]
+	if !exists {
+		return Message{}, ErrMessageNotFound
+	}
+	return *msg, nil
+}
+
+// Retry makes a message waiting for its next retry due immediately.
+// Messages already due or being attempted are left as they are.
+func (q *Queue) Retry(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if _, exists := q.messages[id]; !exists {
+		return ErrMessageNotFound
+	}
+	q.retryNow(id)
+	return nil
+}
+
+// RetryAll makes every message waiting for a retry due immediately and
+// returns how many were rescheduled
+func (q *Queue) RetryAll() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return 0
+	}
+	retried := 0
+	for id := range q.timers {
+		if q.retryNow(id) {
+			retried++
+		}
+	}
+	return retried
+}
+
+// retryNow moves a message from its retry timer to the ready channel.
+// Callers must hold q.mu.
+func (q *Queue) retryNow(id string) bool {
+	timer, waiting := q.timers[id]
+	if !waiting || !timer.Stop() {
+		return false
+	}
+	delete(q.timers, id)
+	q.messages[id].NextAttempt = q.now()
+	q.ready <- id
+	return true
+}
+
+// Purge removes a message without delivering it
+func (q *Queue) Purge(id string) error {
+	q.mu.Lock()
+	msg, exists := q.messages[id]
+	if !exists {
+		q.mu.Unlock()
+		return ErrMessageNotFound
+	}
+	q.remove(id)
+	q.mu.Unlock()
+
+	logger.WarnContext(msg.context(q.ctx), "queued message purged", "attempts", msg.Attempts)
+	q.notify(q.onPurge, msg, ErrPurged)
+	return nil
+}
+
+// PurgeAll removes every queued message and returns how many were removed
+func (q *Queue) PurgeAll() int {
+	q.mu.Lock()
+	purged := make([]*Message, 0, len(q.messages))
+	for id, msg := range q.messages {
+		q.remove(id)
+		purged = append(purged, msg)
+	}
+	q.mu.Unlock()
+
+	for _, msg := range purged {
+		q.notify(q.onPurge, msg, ErrPurged)
+	}
+	if len(purged) > 0 {
+		logger.Warnf("purged %d queued message(s)", len(purged))
+	}
+	return len(purged)
+}
+
+// remove forgets a message and cancels its retry. Callers must hold q.mu.
+func (q *Queue) remove(id string) {
+	delete(q.messages, id)
+	if timer, waiting := q.timers[id]; waiting {
+		timer.Stop()
+		delete(q.timers, id)
+	}
+}
+
+func (q *Queue) worker() {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-q.stopping:
+			return
+		case id := <-q.ready:
+			q.attempt(id)
+		}
+	}
+}
+
+// attempt tries to deliver a message once and decides whether to retry
+func (q *Queue) attempt(id string) {
+	q.mu.Lock()
+	msg, exists := q.messages[id]
+	q.mu.Unlock()
+	if !exists {
+		return
+	}
+
+	providerMessageID, err := q.dispatch(msg)
+
+	q.mu.Lock()
+	msg.Attempts++
+	msg.LastError = err
+	msg.ProviderMessageID = providerMessageID
+
+	if q.messages[id] != msg {
+		// Purged during the attempt
+		q.mu.Unlock()
+		return
+	}
+
+	if err == nil {
+		delete(q.messages, id)
+		q.mu.Unlock()
+		logger.InfoContext(msg.context(q.ctx), "queued message delivered", "attempts", msg.Attempts, "provider_message_id", providerMessageID)
+		q.notify(q.onSuccess, msg, nil)
+		return
+	}
+
+	if q.ctx.Err() != nil {
+		// Shutting down; the message stays pending rather than counting as failed
+		q.mu.Unlock()
+		return
+	}
+
+	expired := q.config.MaxAge > 0 && q.now().Sub(msg.EnqueuedAt) >= q.config.MaxAge
+	if dispatcher.IsPermanent(err) || expired {
+		delete(q.messages, id)
+		q.mu.Unlock()
+		if expired && !dispatcher.IsPermanent(err) {
+			err = &dispatcher.Error{Code: 554, Message: fmt.Sprintf("Message expired after %d attempts: %v", msg.Attempts, err)}
+		}
+		logger.WarnContext(msg.context(q.ctx), "queued message failed permanently", "attempts", msg.Attempts, "error", err)
+		q.notify(q.onFailure, msg, err)
+		return
+	}
+
+	if q.closed {
+		// Draining; the message stays pending instead of scheduling a retry
+		q.mu.Unlock()
+		return
+	}
+
+	delay := q.backoff(msg.Attempts)
+	// A provider that said when to come back is retried then instead
+	var dispatchErr *dispatcher.Error
+	if errors.As(err, &dispatchErr) && dispatchErr.RetryAfter > 0 {
+		delay = dispatchErr.RetryAfter
+	}
+	msg.NextAttempt = q.now().Add(delay)
+	q.timers[id] = time.AfterFunc(delay, func() { q.requeue(id) })
+	notifyDelay := !msg.delayNotified && q.now().Sub(msg.EnqueuedAt) >= q.config.DelayNotice
+	if notifyDelay {
+		msg.delayNotified = true
+	}
+	q.mu.Unlock()
+
+	logger.WarnContext(msg.context(q.ctx), "queued message attempt failed", "attempts", msg.Attempts, "retry_in", delay, "error", err)
+	if notifyDelay {
+		q.notify(q.onDelay, msg, err)
+	}
+}
+
+// notify calls each handler in registration order
+func (q *Queue) notify(handlers []Handler, msg *Message, err error) {
+	for _, handler := range handlers {
+		handler(q.ctx, msg, err)
+	}
+}
+
+// dispatch makes one delivery attempt, bounded by the attempt timeout
+func (q *Queue) dispatch(msg *Message) (string, error) {
+	ctx := msg.context(q.ctx)
+	if q.config.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.config.AttemptTimeout)
+		defer cancel()
+	}
+	return q.deliverer.Dispatch(ctx, msg.Email, msg.Provider)
+}
+
+// context returns parent carrying the message and session IDs for dispatch and
+// logs, the trace of the transaction that enqueued the message and whether
+// its provider may fail over
+func (m *Message) context(parent context.Context) context.Context {
+	ctx := requestctx.WithMessageID(requestctx.WithSessionID(parent, m.SessionID), m.ID)
+	if m.spanContext.IsValid() {
+		ctx = trace.ContextWithSpanContext(ctx, m.spanContext)
+	}
+	if m.failover {
+		ctx = provider.WithFailover(ctx)
+	}
+	return ctx
+}
+
+// requeue puts a message waiting for retry back on the ready channel
+func (q *Queue) requeue(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.timers, id)
+	if q.closed {
+		return
+	}
+	if _, exists := q.messages[id]; exists {
+		q.ready <- id
+	}
+}
+
+// backoff doubles the retry interval per attempt, capped at one hour
+func (q *Queue) backoff(attempts int) time.Duration {
+	delay := q.config.RetryInterval
+	for i := 1; i < attempts && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > time.Hour {
+		delay = time.Hour
+	}
+	return delay
+}
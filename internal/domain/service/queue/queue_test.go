@@ -0,0 +1,458 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/core/requestctx"
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/dispatcher"
+	"github.com/itsLeonB/smtproxy/internal/domain/service/provider"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeDeliverer returns queued errors in order, then succeeds
+type fakeDeliverer struct {
+	mu     sync.Mutex
+	errs   []error
+	calls  int
+	called chan struct{}
+}
+
+func newFakeDeliverer(errs ...error) *fakeDeliverer {
+	return &fakeDeliverer{errs: errs, called: make(chan struct{}, 10)}
+}
+
+func (f *fakeDeliverer) Dispatch(ctx context.Context, email *entity.Email, providerName string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	defer func() { f.called <- struct{}{} }()
+	if len(f.errs) == 0 {
+		return "provider-id", nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return "", err
+}
+
+func waitCall(t *testing.T, f *fakeDeliverer) {
+	t.Helper()
+	select {
+	case <-f.called:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for delivery attempt")
+	}
+}
+
+func TestQueue_DeliversMessage(t *testing.T) {
+	deliverer := newFakeDeliverer()
+	q := New(Config{Workers: 1}, deliverer)
+	q.Start()
+	defer q.Stop()
+
+	id, err := q.Enqueue(context.Background(), &entity.Email{}, "")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, id)
+
+	waitCall(t, deliverer)
+	assert.Eventually(t, func() bool { return q.Len() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestQueue_RetriesTransientFailure(t *testing.T) {
+	deliverer := newFakeDeliverer(&dispatcher.Error{Code: 451, Message: "try later"})
+	q := New(Config{Workers: 1, RetryInterval: 10 * time.Millisecond}, deliverer)
+	q.Start()
+	defer q.Stop()
+
+	_, err := q.Enqueue(context.Background(), &entity.Email{}, "")
+	assert.NoError(t, err)
+
+	waitCall(t, deliverer)
+	waitCall(t, deliverer)
+	assert.Eventually(t, func() bool { return q.Len() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestQueue_RetriesAfterProviderHint(t *testing.T) {
+	deliverer := newFakeDeliverer(&dispatcher.Error{Code: 451, Message: "Rate limit exceeded", RetryAfter: 20 * time.Millisecond})
+	q := New(Config{Workers: 1, RetryInterval: time.Hour}, deliverer)
+	q.Start()
+	defer q.Stop()
+
+	_, err := q.Enqueue(context.Background(), &entity.Email{}, "")
+	assert.NoError(t, err)
+
+	// The hint replaces the hour-long backoff
+	waitCall(t, deliverer)
+	waitCall(t, deliverer)
+	assert.Eventually(t, func() bool { return q.Len() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestQueue_PermanentFailureCallsHandler(t *testing.T) {
+	deliverer := newFakeDeliverer(&dispatcher.Error{Code: 550, Message: "Invalid recipient address"})
+	q := New(Config{Workers: 1}, deliverer)
+
+	failed := make(chan error, 1)
+	q.OnFailure(func(ctx context.Context, msg *Message, err error) {
+		failed <- err
+	})
+	q.Start()
+	defer q.Stop()
+
+	_, err := q.Enqueue(context.Background(), &entity.Email{}, "")
+	assert.NoError(t, err)
+
+	select {
+	case err := <-failed:
+		assert.Contains(t, err.Error(), "550 Invalid recipient address")
+	case <-time.After(2 * time.Second):
+		t.Fatal("failure handler not called")
+	}
+	assert.Equal(t, 0, q.Len())
+}
+
+func TestQueue_ExpiredMessageCallsHandler(t *testing.T) {
+	deliverer := newFakeDeliverer(errors.New("service unavailable"))
+	q := New(Config{Workers: 1, MaxAge: time.Minute}, deliverer)
+
+	start := time.Now()
+	q.now = func() time.Time { return start }
+
+	failed := make(chan error, 1)
+	q.OnFailure(func(ctx context.Context, msg *Message, err error) {
+		failed <- err
+	})
+
+	_, err := q.Enqueue(context.Background(), &entity.Email{}, "")
+	assert.NoError(t, err)
+
+	q.now = func() time.Time { return start.Add(2 * time.Minute) }
+	q.Start()
+	defer q.Stop()
+
+	select {
+	case err := <-failed:
+		assert.True(t, dispatcher.IsPermanent(err))
+		assert.Contains(t, err.Error(), "expired")
+	case <-time.After(2 * time.Second):
+		t.Fatal("failure handler not called")
+	}
+}
+
+func TestQueue_EnqueueFull(t *testing.T) {
+	q := New(Config{Capacity: 1}, newFakeDeliverer())
+
+	_, err := q.Enqueue(context.Background(), &entity.Email{}, "")
+	assert.NoError(t, err)
+
+	_, err = q.Enqueue(context.Background(), &entity.Email{}, "")
+	assert.ErrorIs(t, err, ErrQueueFull)
+}
+
+func TestQueue_EnqueueAfterStop(t *testing.T) {
+	q := New(Config{}, newFakeDeliverer())
+	q.Start()
+	q.Stop()
+
+	_, err := q.Enqueue(context.Background(), &entity.Email{}, "")
+	assert.ErrorIs(t, err, ErrQueueClosed)
+}
+
+func TestQueue_Backoff(t *testing.T) {
+	q := New(Config{RetryInterval: time.Minute}, newFakeDeliverer())
+
+	assert.Equal(t, time.Minute, q.backoff(1))
+	assert.Equal(t, 2*time.Minute, q.backoff(2))
+	assert.Equal(t, 4*time.Minute, q.backoff(3))
+	assert.Equal(t, time.Hour, q.backoff(20))
+}
+
+func TestQueue_DelayAndSuccessHandlers(t *testing.T) {
+	deliverer := newFakeDeliverer(&dispatcher.Error{Code: 451, Message: "try later"})
+	q := New(Config{Workers: 1, RetryInterval: 10 * time.Millisecond}, deliverer)
+
+	events := make(chan string, 2)
+	q.OnDelay(func(ctx context.Context, msg *Message, err error) {
+		events <- "delay"
+	})
+	q.OnSuccess(func(ctx context.Context, msg *Message, err error) {
+		assert.Equal(t, "provider-id", msg.ProviderMessageID)
+		events <- "success"
+	})
+	q.Start()
+	defer q.Stop()
+
+	_, err := q.Enqueue(context.Background(), &entity.Email{}, "")
+	assert.NoError(t, err)
+
+	for _, want := range []string{"delay", "success"} {
+		select {
+		case got := <-events:
+			assert.Equal(t, want, got)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %s event", want)
+		}
+	}
+}
+
+func TestQueue_DelayNoticeWaitsForThreshold(t *testing.T) {
+	transient := &dispatcher.Error{Code: 451, Message: "try later"}
+	deliverer := newFakeDeliverer(transient, transient, transient)
+	q := New(Config{RetryInterval: time.Hour, DelayNotice: 4 * time.Hour}, deliverer)
+	defer q.Stop()
+
+	start := time.Now()
+	q.now = func() time.Time { return start }
+	delays := 0
+	q.OnDelay(func(ctx context.Context, msg *Message, err error) {
+		delays++
+	})
+
+	id, err := q.Enqueue(context.Background(), &entity.Email{}, "")
+	assert.NoError(t, err)
+
+	// Failures before the threshold stay quiet
+	q.attempt(id)
+	assert.Equal(t, 0, delays)
+
+	// The first failure past it sends the notice, and later ones don't repeat it
+	q.now = func() time.Time { return start.Add(5 * time.Hour) }
+	q.attempt(id)
+	assert.Equal(t, 1, delays)
+	q.attempt(id)
+	assert.Equal(t, 1, delays)
+}
+
+// blockingDeliverer holds each delivery until released or cancelled
+type blockingDeliverer struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingDeliverer) Dispatch(ctx context.Context, email *entity.Email, providerName string) (string, error) {
+	b.started <- struct{}{}
+	select {
+	case <-b.release:
+		return "", nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func TestQueue_ShutdownWaitsForInFlightDelivery(t *testing.T) {
+	deliverer := &blockingDeliverer{started: make(chan struct{}, 1), release: make(chan struct{})}
+	q := New(Config{Workers: 1}, deliverer)
+	q.Start()
+
+	_, err := q.Enqueue(context.Background(), &entity.Email{}, "")
+	assert.NoError(t, err)
+	<-deliverer.started
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(deliverer.release)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	assert.Empty(t, q.Shutdown(ctx))
+
+	_, err = q.Enqueue(context.Background(), &entity.Email{}, "")
+	assert.ErrorIs(t, err, ErrQueueClosed)
+}
+
+func TestQueue_ShutdownCancelsAtDeadline(t *testing.T) {
+	deliverer := &blockingDeliverer{started: make(chan struct{}, 1), release: make(chan struct{})}
+	q := New(Config{Workers: 1}, deliverer)
+	q.Start()
+
+	id, err := q.Enqueue(context.Background(), &entity.Email{}, "")
+	assert.NoError(t, err)
+	<-deliverer.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	undelivered := q.Shutdown(ctx)
+	if assert.Len(t, undelivered, 1, "the cancelled message is left undelivered") {
+		assert.Equal(t, id, undelivered[0].ID)
+	}
+}
+
+// recordingDeliverer captures the context of each delivery attempt
+type recordingDeliverer struct {
+	contexts chan context.Context
+}
+
+func (r *recordingDeliverer) Dispatch(ctx context.Context, email *entity.Email, providerName string) (string, error) {
+	r.contexts <- ctx
+	return "", nil
+}
+
+func TestQueue_CarriesRequestIDs(t *testing.T) {
+	deliverer := &recordingDeliverer{contexts: make(chan context.Context, 1)}
+	q := New(Config{Workers: 1, AttemptTimeout: time.Minute}, deliverer)
+	q.Start()
+	defer q.Stop()
+
+	ctx := requestctx.WithMessageID(requestctx.WithSessionID(context.Background(), "session-1"), "message-1")
+	id, err := q.Enqueue(ctx, &entity.Email{}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "message-1", id)
+
+	attemptCtx := <-deliverer.contexts
+	assert.Equal(t, "session-1", requestctx.SessionID(attemptCtx))
+	assert.Equal(t, "message-1", requestctx.MessageID(attemptCtx))
+	_, hasDeadline := attemptCtx.Deadline()
+	assert.True(t, hasDeadline)
+}
+
+func TestQueue_CarriesFailover(t *testing.T) {
+	deliverer := &recordingDeliverer{contexts: make(chan context.Context, 2)}
+	q := New(Config{Workers: 1}, deliverer)
+	q.Start()
+	defer q.Stop()
+
+	_, err := q.Enqueue(provider.WithFailover(context.Background()), &entity.Email{}, "brevo")
+	assert.NoError(t, err)
+	assert.True(t, provider.CanFailover(<-deliverer.contexts))
+
+	// A provider that was asked for by name keeps every attempt
+	_, err = q.Enqueue(context.Background(), &entity.Email{}, "brevo")
+	assert.NoError(t, err)
+	assert.False(t, provider.CanFailover(<-deliverer.contexts))
+}
+
+func TestQueue_AttemptTimeout(t *testing.T) {
+	deliverer := &blockingDeliverer{started: make(chan struct{}, 2), release: make(chan struct{})}
+	q := New(Config{Workers: 1, RetryInterval: time.Hour, AttemptTimeout: 20 * time.Millisecond}, deliverer)
+	q.Start()
+	defer q.Stop()
+
+	_, err := q.Enqueue(context.Background(), &entity.Email{}, "")
+	assert.NoError(t, err)
+	<-deliverer.started
+
+	// The timed out attempt is a transient failure and waits for a retry
+	assert.Eventually(t, func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return len(q.timers) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestQueue_Retry(t *testing.T) {
+	deliverer := newFakeDeliverer(&dispatcher.Error{Code: 451, Message: "try later"})
+	q := New(Config{Workers: 1, RetryInterval: time.Hour}, deliverer)
+	q.Start()
+	defer q.Stop()
+
+	id, err := q.Enqueue(context.Background(), &entity.Email{}, "")
+	assert.NoError(t, err)
+	waitCall(t, deliverer)
+
+	assert.Eventually(t, func() bool {
+		msg, err := q.Get(id)
+		return err == nil && msg.Attempts == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.NoError(t, q.Retry(id))
+
+	waitCall(t, deliverer)
+	assert.Eventually(t, func() bool { return q.Len() == 0 }, time.Second, 10*time.Millisecond)
+	assert.ErrorIs(t, q.Retry(id), ErrMessageNotFound)
+}
+
+func TestQueue_RetryAll(t *testing.T) {
+	deliverer := newFakeDeliverer(&dispatcher.Error{Code: 451, Message: "try later"}, &dispatcher.Error{Code: 451, Message: "try later"})
+	q := New(Config{Workers: 1, RetryInterval: time.Hour}, deliverer)
+	q.Start()
+	defer q.Stop()
+
+	for range 2 {
+		_, err := q.Enqueue(context.Background(), &entity.Email{}, "")
+		assert.NoError(t, err)
+	}
+	waitCall(t, deliverer)
+	waitCall(t, deliverer)
+
+	assert.Eventually(t, func() bool { return q.RetryAll() == 2 }, time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool { return q.Len() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestQueue_MessagesAndGet(t *testing.T) {
+	q := New(Config{Workers: 1}, newFakeDeliverer())
+	q.now = func() time.Time { return time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC) }
+	first, _ := q.Enqueue(requestctx.WithMessageID(context.Background(), "first"), &entity.Email{}, "brevo")
+	q.now = func() time.Time { return time.Date(2026, 1, 1, 0, 1, 0, 0, time.UTC) }
+	second, _ := q.Enqueue(requestctx.WithMessageID(context.Background(), "second"), &entity.Email{}, "")
+
+	messages := q.Messages()
+	assert.Len(t, messages, 2)
+	assert.Equal(t, first, messages[0].ID)
+	assert.Equal(t, second, messages[1].ID)
+
+	msg, err := q.Get(first)
+	assert.NoError(t, err)
+	assert.Equal(t, "brevo", msg.Provider)
+
+	_, err = q.Get("missing")
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+}
+
+func TestQueue_Purge(t *testing.T) {
+	deliverer := newFakeDeliverer(&dispatcher.Error{Code: 451, Message: "try later"})
+	q := New(Config{Workers: 1, RetryInterval: time.Hour}, deliverer)
+	purged := make(chan error, 1)
+	q.OnPurge(func(ctx context.Context, msg *Message, err error) {
+		purged <- err
+	})
+	q.Start()
+	defer q.Stop()
+
+	id, err := q.Enqueue(context.Background(), &entity.Email{}, "")
+	assert.NoError(t, err)
+	waitCall(t, deliverer)
+
+	assert.Eventually(t, func() bool { return q.Purge(id) == nil }, time.Second, 10*time.Millisecond)
+	assert.ErrorIs(t, <-purged, ErrPurged)
+	assert.Equal(t, 0, q.Len())
+	assert.ErrorIs(t, q.Purge(id), ErrMessageNotFound)
+}
+
+func TestQueue_PurgeAll(t *testing.T) {
+	q := New(Config{Workers: 1}, newFakeDeliverer())
+	for range 3 {
+		_, err := q.Enqueue(context.Background(), &entity.Email{}, "")
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, 3, q.PurgeAll())
+	assert.Equal(t, 0, q.Len())
+}
+
+func TestQueue_KeepsTraceContext(t *testing.T) {
+	deliverer := &recordingDeliverer{contexts: make(chan context.Context, 1)}
+	q := New(Config{Workers: 1}, deliverer)
+	q.Start()
+	defer q.Stop()
+
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), spanContext)
+	_, err := q.Enqueue(ctx, &entity.Email{}, "")
+	assert.NoError(t, err)
+
+	select {
+	case got := <-deliverer.contexts:
+		assert.Equal(t, spanContext, trace.SpanContextFromContext(got))
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for delivery attempt")
+	}
+}
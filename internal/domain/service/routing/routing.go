@@ -0,0 +1,217 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"regexp"
+	"strings"
+
+	"github.com/itsLeonB/smtproxy/internal/core/logger"
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+)
+
+// Rule sends messages matching every criterion in Match to Provider
+type Rule struct {
+	Name     string
+	Match    Match
+	Provider string
+}
+
+// Match lists the criteria of a rule. Empty criteria match every message.
+// Users, domains and header values are case-insensitive patterns in which
+// "*" matches any run of characters, so "*.example.com" matches subdomains.
+type Match struct {
+	// Users matches the authenticated user, or nothing for unauthenticated sessions
+	Users []string
+	// SenderDomains matches the domain of the envelope sender
+	SenderDomains []string
+	// RecipientDomains matches if any envelope recipient's domain matches
+	RecipientDomains []string
+	// Headers maps header names to a pattern one of their values must match
+	Headers map[string]string
+	// MinSize and MaxSize bound the message size in bytes; zero means no bound
+	MinSize int64
+	MaxSize int64
+	// HasAttachments requires attachments when true and their absence when false
+	HasAttachments *bool
+}
+
+// Message is what rules are evaluated against
+type Message struct {
+	User  string
+	Email *entity.Email
+	Size  int64
+}
+
+// Decision is the outcome of routing a message
+type Decision struct {
+	// Rule is the name of the matching rule, empty if none matched
+	Rule string
+	// Provider is the provider to send through, empty for the default
+	Provider string
+}
+
+// Router picks a provider with the first rule that matches a message
+type Router struct {
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	Rule
+	users      []*regexp.Regexp
+	senders    []*regexp.Regexp
+	recipients []*regexp.Regexp
+	headers    map[string]*regexp.Regexp
+}
+
+// NewRouter compiles rules in evaluation order. Rules without a name are
+// called "rule <n>", counting from 1.
+func NewRouter(rules []Rule) (*Router, error) {
+	router := &Router{rules: make([]compiledRule, 0, len(rules))}
+	var errs []error
+	for i, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		compiled, err := compile(rule)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("routing rule %q: %w", rule.Name, err))
+			continue
+		}
+		router.rules = append(router.rules, compiled)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return router, nil
+}
+
+func compile(rule Rule) (compiledRule, error) {
+	if rule.Provider == "" {
+		return compiledRule{}, errors.New("provider is required")
+	}
+	if rule.Match.MaxSize > 0 && rule.Match.MinSize > rule.Match.MaxSize {
+		return compiledRule{}, fmt.Errorf("min size %d exceeds max size %d", rule.Match.MinSize, rule.Match.MaxSize)
+	}
+
+	compiled := compiledRule{
+		Rule:       rule,
+		users:      compilePatterns(rule.Match.Users),
+		senders:    compilePatterns(rule.Match.SenderDomains),
+		recipients: compilePatterns(rule.Match.RecipientDomains),
+		headers:    make(map[string]*regexp.Regexp, len(rule.Match.Headers)),
+	}
+	for name, pattern := range rule.Match.Headers {
+		compiled.headers[textproto.CanonicalMIMEHeaderKey(name)] = compilePattern(pattern)
+	}
+	return compiled, nil
+}
+
+func compilePatterns(patterns []string) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		compiled[i] = compilePattern(pattern)
+	}
+	return compiled
+}
+
+// compilePattern turns a "*" wildcard pattern into an anchored case-insensitive regexp
+func compilePattern(pattern string) *regexp.Regexp {
+	parts := strings.Split(strings.TrimSpace(pattern), "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("(?is)^" + strings.Join(parts, ".*") + "$")
+}
+
+// Rules returns the rules in evaluation order
+func (r *Router) Rules() []Rule {
+	rules := make([]Rule, len(r.rules))
+	for i, rule := range r.rules {
+		rules[i] = rule.Rule
+	}
+	return rules
+}
+
+// Route returns the decision of the first matching rule and logs it
+func (r *Router) Route(ctx context.Context, msg Message) Decision {
+	decision := r.Evaluate(msg)
+	if decision.Rule == "" {
+		logger.DebugContext(ctx, "no routing rule matched, using the default provider")
+	} else {
+		logger.InfoContext(ctx, "message routed", "rule", decision.Rule, "provider", decision.Provider)
+	}
+	return decision
+}
+
+// Evaluate returns the decision of the first matching rule without logging
+func (r *Router) Evaluate(msg Message) Decision {
+	for _, rule := range r.rules {
+		if rule.matches(msg) {
+			return Decision{Rule: rule.Name, Provider: rule.Provider}
+		}
+	}
+	return Decision{}
+}
+
+func (r compiledRule) matches(msg Message) bool {
+	email := msg.Email
+	match := r.Match
+
+	if len(r.users) > 0 && (msg.User == "" || !matchAny(r.users, msg.User)) {
+		return false
+	}
+	if len(r.senders) > 0 && !matchAny(r.senders, domain(email.Envelope.From)) {
+		return false
+	}
+	if len(r.recipients) > 0 && !anyRecipient(r.recipients, email.Envelope.To) {
+		return false
+	}
+	for name, pattern := range r.headers {
+		if !matchAny([]*regexp.Regexp{pattern}, email.Headers.Raw[name]...) {
+			return false
+		}
+	}
+	if match.MinSize > 0 && msg.Size < match.MinSize {
+		return false
+	}
+	if match.MaxSize > 0 && msg.Size > match.MaxSize {
+		return false
+	}
+	if match.HasAttachments != nil && *match.HasAttachments != (len(email.Attachments) > 0) {
+		return false
+	}
+	return true
+}
+
+// matchAny reports whether any pattern matches any of values
+func matchAny(patterns []*regexp.Regexp, values ...string) bool {
+	for _, value := range values {
+		for _, pattern := range patterns {
+			if pattern.MatchString(strings.TrimSpace(value)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func anyRecipient(patterns []*regexp.Regexp, recipients []string) bool {
+	for _, recipient := range recipients {
+		if matchAny(patterns, domain(recipient)) {
+			return true
+		}
+	}
+	return false
+}
+
+// domain returns the part of address after the last @
+func domain(address string) string {
+	address = strings.Trim(address, "<>")
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		return address[i+1:]
+	}
+	return ""
+}
@@ -0,0 +1,99 @@
+package routing
+
+import (
+	"context"
+	"net/textproto"
+	"testing"
+
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMessage(from string, to ...string) Message {
+	return Message{
+		Email: &entity.Email{
+			Envelope: entity.Envelope{From: from, To: to},
+			Headers:  entity.Headers{Raw: map[string][]string{}},
+		},
+		Size: 1000,
+	}
+}
+
+func withHeader(msg Message, name, value string) Message {
+	key := textproto.CanonicalMIMEHeaderKey(name)
+	msg.Email.Headers.Raw[key] = append(msg.Email.Headers.Raw[key], value)
+	return msg
+}
+
+func TestRouter_Criteria(t *testing.T) {
+	yes, no := true, false
+	attachment := newMessage("app@example.com", "user@example.org")
+	attachment.Email.Attachments = []entity.Attachment{{Filename: "invoice.pdf"}}
+	authenticated := newMessage("app@example.com", "user@example.org")
+	authenticated.User = "billing"
+
+	tests := []struct {
+		name  string
+		match Match
+		msg   Message
+		want  bool
+	}{
+		{name: "empty match", match: Match{}, msg: newMessage("app@example.com", "user@example.org"), want: true},
+		{name: "user", match: Match{Users: []string{"billing"}}, msg: authenticated, want: true},
+		{name: "user glob", match: Match{Users: []string{"bill*"}}, msg: authenticated, want: true},
+		{name: "unauthenticated user", match: Match{Users: []string{"*"}}, msg: newMessage("app@example.com", "user@example.org"), want: false},
+		{name: "sender domain", match: Match{SenderDomains: []string{"Example.COM"}}, msg: newMessage("app@example.com", "user@example.org"), want: true},
+		{name: "sender subdomain", match: Match{SenderDomains: []string{"*.example.com"}}, msg: newMessage("app@mail.example.com", "user@example.org"), want: true},
+		{name: "sender domain mismatch", match: Match{SenderDomains: []string{"*.example.com"}}, msg: newMessage("app@example.com", "user@example.org"), want: false},
+		{name: "any recipient domain", match: Match{RecipientDomains: []string{"gmail.com"}}, msg: newMessage("app@example.com", "a@example.org", "b@gmail.com"), want: true},
+		{name: "recipient domain mismatch", match: Match{RecipientDomains: []string{"gmail.com"}}, msg: newMessage("app@example.com", "a@example.org"), want: false},
+		{name: "header", match: Match{Headers: map[string]string{"x-smtproxy-provider": "marketing"}}, msg: withHeader(newMessage("app@example.com", "a@example.org"), "X-Smtproxy-Provider", "Marketing"), want: true},
+		{name: "header glob", match: Match{Headers: map[string]string{"X-Mailer": "PHPMailer*"}}, msg: withHeader(newMessage("app@example.com", "a@example.org"), "X-Mailer", "PHPMailer 6.9 (https://github.com/PHPMailer/PHPMailer)"), want: true},
+		{name: "missing header", match: Match{Headers: map[string]string{"X-Mailer": "*"}}, msg: newMessage("app@example.com", "a@example.org"), want: false},
+		{name: "min size", match: Match{MinSize: 2000}, msg: newMessage("app@example.com", "a@example.org"), want: false},
+		{name: "max size", match: Match{MaxSize: 1000}, msg: newMessage("app@example.com", "a@example.org"), want: true},
+		{name: "has attachments", match: Match{HasAttachments: &yes}, msg: attachment, want: true},
+		{name: "no attachments", match: Match{HasAttachments: &no}, msg: attachment, want: false},
+		{name: "every criterion must match", match: Match{SenderDomains: []string{"example.com"}, RecipientDomains: []string{"gmail.com"}}, msg: newMessage("app@example.com", "a@example.org"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, err := NewRouter([]Rule{{Name: "rule", Match: tt.match, Provider: "p"}})
+			assert.NoError(t, err)
+
+			decision := router.Evaluate(tt.msg)
+			assert.Equal(t, tt.want, decision.Rule == "rule")
+		})
+	}
+}
+
+func TestRouter_FirstMatchWins(t *testing.T) {
+	router, err := NewRouter([]Rule{
+		{Name: "gmail", Match: Match{RecipientDomains: []string{"gmail.com"}}, Provider: "brevo-tx"},
+		{Match: Match{SenderDomains: []string{"example.com"}}, Provider: "brevo-mkt"},
+		{Name: "catch-all", Provider: "brevo"},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, Decision{Rule: "gmail", Provider: "brevo-tx"}, router.Route(context.Background(), newMessage("app@example.com", "a@gmail.com")))
+	assert.Equal(t, Decision{Rule: "rule 2", Provider: "brevo-mkt"}, router.Route(context.Background(), newMessage("app@example.com", "a@example.org")))
+	assert.Equal(t, Decision{Rule: "catch-all", Provider: "brevo"}, router.Route(context.Background(), newMessage("app@other.example", "a@example.org")))
+}
+
+func TestRouter_NoMatch(t *testing.T) {
+	router, err := NewRouter([]Rule{{Match: Match{Users: []string{"billing"}}, Provider: "brevo-tx"}})
+	assert.NoError(t, err)
+
+	assert.Equal(t, Decision{}, router.Evaluate(newMessage("app@example.com", "a@example.org")))
+}
+
+func TestNewRouter_InvalidRules(t *testing.T) {
+	_, err := NewRouter([]Rule{
+		{Name: "no provider"},
+		{Name: "sizes", Match: Match{MinSize: 10, MaxSize: 5}, Provider: "p"},
+	})
+
+	assert.ErrorContains(t, err, `routing rule "no provider": provider is required`)
+	assert.ErrorContains(t, err, `routing rule "sizes": min size 10 exceeds max size 5`)
+}
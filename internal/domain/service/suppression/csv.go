@@ -0,0 +1,103 @@
+package suppression
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// csvHeader names the columns of exported entries
+var csvHeader = []string{"address", "reason", "details", "created_at"}
+
+// Export writes every entry as CSV with a header row
+func (l *List) Export(w io.Writer) error {
+	entries, err := l.Entries()
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		record := []string{e.Address, string(e.Reason), e.Details, e.CreatedAt.Format(time.RFC3339)}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Import adds the entries in CSV read from r and returns how many there
+// were. Rows hold an address and optionally a reason, details and an RFC
+// 3339 creation time, in the order Export writes them; a header row is
+// skipped. Nothing is added unless every row is valid.
+func (l *List) Import(r io.Reader) (int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var entries []Entry
+	var errs []error
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%w: %w", ErrInvalidEntry, err)
+		}
+		line, _ := reader.FieldPos(0)
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), csvHeader[0]) {
+			continue
+		}
+
+		entry, err := parseRecord(record)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", line, err))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if len(errs) > 0 {
+		return 0, errors.Join(errs...)
+	}
+
+	for i, entry := range entries {
+		if _, err := l.Add(entry); err != nil {
+			return i, err
+		}
+	}
+	return len(entries), nil
+}
+
+// parseRecord reads an entry from a CSV row, rejecting what Add would
+func parseRecord(record []string) (Entry, error) {
+	if len(record) > len(csvHeader) {
+		return Entry{}, fmt.Errorf("expected at most %d columns, got %d: %w", len(csvHeader), len(record), ErrInvalidEntry)
+	}
+	field := func(i int) string {
+		if i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	entry := Entry{Address: field(0), Reason: Reason(field(1)), Details: field(2)}
+	if err := entry.normalize(); err != nil {
+		return Entry{}, err
+	}
+	if createdAt := field(3); createdAt != "" {
+		t, err := time.Parse(time.RFC3339, createdAt)
+		if err != nil {
+			return Entry{}, fmt.Errorf("invalid created_at %q: %w", createdAt, ErrInvalidEntry)
+		}
+		entry.CreatedAt = t
+	}
+	return entry, nil
+}
@@ -0,0 +1,76 @@
+package suppression
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestList_Export(t *testing.T) {
+	list := newList(ModeReject, "bob@example.org")
+	_, _ = list.Add(Entry{Address: "alice@example.org", Reason: ReasonHardBounce, Details: "550 5.1.1 user unknown, try later", CreatedAt: created})
+
+	var buf bytes.Buffer
+	assert.NoError(t, list.Export(&buf))
+
+	assert.Equal(t, `address,reason,details,created_at
+alice@example.org,hard_bounce,"550 5.1.1 user unknown, try later",2026-03-01T12:00:00Z
+bob@example.org,manual,,2026-03-01T12:00:00Z
+`, buf.String())
+}
+
+func TestList_Import(t *testing.T) {
+	list := newList(ModeReject)
+
+	n, err := list.Import(strings.NewReader(`address,reason,details,created_at
+alice@example.org,hard_bounce,"550 5.1.1 user unknown, try later",2025-11-02T08:00:00Z
+Bob@Example.org
+carol@example.org,complaint
+`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	entries, err := list.Entries()
+	assert.NoError(t, err)
+	assert.Equal(t, []Entry{
+		{Address: "alice@example.org", Reason: ReasonHardBounce, Details: "550 5.1.1 user unknown, try later", CreatedAt: time.Date(2025, 11, 2, 8, 0, 0, 0, time.UTC)},
+		{Address: "bob@example.org", Reason: ReasonManual, CreatedAt: created},
+		{Address: "carol@example.org", Reason: ReasonComplaint, CreatedAt: created},
+	}, entries)
+}
+
+func TestList_ImportRoundTrip(t *testing.T) {
+	source := newList(ModeReject, "bob@example.org", "alice@example.org")
+	var buf bytes.Buffer
+	assert.NoError(t, source.Export(&buf))
+
+	target := newList(ModeReject)
+	n, err := target.Import(&buf)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	want, _ := source.Entries()
+	got, _ := target.Entries()
+	assert.Equal(t, want, got)
+}
+
+func TestList_ImportInvalid(t *testing.T) {
+	list := newList(ModeReject)
+
+	n, err := list.Import(strings.NewReader(`bob@example.org
+not an address
+carol@example.org,bored
+dave@example.org,manual,,yesterday
+`))
+
+	assert.Equal(t, 0, n)
+	assert.ErrorIs(t, err, ErrInvalidEntry)
+	assert.ErrorContains(t, err, `line 2: invalid address "not an address"`)
+	assert.ErrorContains(t, err, `line 3: unknown reason "bored"`)
+	assert.ErrorContains(t, err, `line 4: invalid created_at "yesterday"`)
+	entries, _ := list.Entries()
+	assert.Empty(t, entries)
+}
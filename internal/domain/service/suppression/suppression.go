@@ -0,0 +1,224 @@
+package suppression
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/core/logger"
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+)
+
+// ErrNotFound is returned by a Store when an address is not suppressed
+var ErrNotFound = errors.New("address not suppressed")
+
+// ErrInvalidEntry is wrapped by the errors for entries that can't be added
+// or imported because of what they hold
+var ErrInvalidEntry = errors.New("invalid suppression entry")
+
+// Mode is what happens to messages for suppressed recipients
+type Mode string
+
+const (
+	// ModeReject refuses suppressed recipients at RCPT TO with 550 5.1.1
+	ModeReject Mode = "reject"
+	// ModeDrop accepts suppressed recipients but sends nothing to them
+	ModeDrop Mode = "drop"
+	// ModeTag delivers to suppressed recipients and records that they are
+	ModeTag Mode = "tag"
+)
+
+// Reason is why an address was suppressed
+type Reason string
+
+const (
+	ReasonManual     Reason = "manual"
+	ReasonHardBounce Reason = "hard_bounce"
+	ReasonComplaint  Reason = "complaint"
+)
+
+// valid reports whether r is a known reason
+func (r Reason) valid() bool {
+	return r == ReasonManual || r == ReasonHardBounce || r == ReasonComplaint
+}
+
+// Entry is a suppressed recipient address
+type Entry struct {
+	Address   string    `json:"address"`
+	Reason    Reason    `json:"reason"`
+	Details   string    `json:"details,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// normalize normalizes the address and defaults the reason of e, failing
+// if either is invalid
+func (e *Entry) normalize() error {
+	e.Address = Normalize(e.Address)
+	if parsed, err := mail.ParseAddress(e.Address); err != nil || parsed.Address != e.Address {
+		return fmt.Errorf("invalid address %q: %w", e.Address, ErrInvalidEntry)
+	}
+	if e.Reason == "" {
+		e.Reason = ReasonManual
+	}
+	if !e.Reason.valid() {
+		return fmt.Errorf("unknown reason %q, expected %s, %s or %s: %w", e.Reason, ReasonManual, ReasonHardBounce, ReasonComplaint, ErrInvalidEntry)
+	}
+	return nil
+}
+
+// Store persists suppression entries by normalized address
+type Store interface {
+	Put(e Entry) error
+	// Get returns the entry for address, or ErrNotFound
+	Get(address string) (Entry, error)
+	// Delete removes the entry for address, or returns ErrNotFound
+	Delete(address string) error
+	// List returns every entry ordered by address
+	List() ([]Entry, error)
+	Close() error
+}
+
+// List checks recipients against the suppressed addresses in a Store.
+// Lookup errors are logged and treated as not suppressed, so that a broken
+// store never stops delivery.
+type List struct {
+	store Store
+	mode  Mode
+	now   func() time.Time
+}
+
+// NewList creates a list that applies mode to suppressed recipients
+func NewList(store Store, mode Mode) *List {
+	return &List{store: store, mode: mode, now: time.Now}
+}
+
+// Mode returns what happens to messages for suppressed recipients
+func (l *List) Mode() Mode {
+	return l.mode
+}
+
+// Normalize returns address as stored: trimmed, without angle brackets and
+// in lower case
+func Normalize(address string) string {
+	return strings.ToLower(strings.Trim(strings.TrimSpace(address), "<>"))
+}
+
+// Lookup returns the entry suppressing address, if there is one
+func (l *List) Lookup(address string) (Entry, bool) {
+	entry, err := l.store.Get(Normalize(address))
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			logger.Errorf("failed to look up suppressed address: %v", err)
+		}
+		return Entry{}, false
+	}
+	return entry, true
+}
+
+// Add suppresses e.Address, replacing any entry it has. The reason
+// defaults to manual and the creation time to now.
+func (l *List) Add(e Entry) (Entry, error) {
+	if err := e.normalize(); err != nil {
+		return Entry{}, err
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = l.now()
+	}
+	e.CreatedAt = e.CreatedAt.UTC()
+
+	if err := l.store.Put(e); err != nil {
+		return Entry{}, err
+	}
+	return e, nil
+}
+
+// Remove lifts the suppression of address, or returns ErrNotFound
+func (l *List) Remove(address string) error {
+	return l.store.Delete(Normalize(address))
+}
+
+// Entries returns every suppressed address in order
+func (l *List) Entries() ([]Entry, error) {
+	return l.store.List()
+}
+
+// SuppressEvent suppresses the recipient of a hard bounce or a complaint.
+// Addresses that are already suppressed keep their entry.
+func (l *List) SuppressEvent(ctx context.Context, e entity.DeliveryEvent) {
+	var reason Reason
+	switch {
+	case e.Type == entity.EventBounced && e.Permanent:
+		reason = ReasonHardBounce
+	case e.Type == entity.EventComplained:
+		reason = ReasonComplaint
+	default:
+		return
+	}
+	if e.Recipient == "" {
+		return
+	}
+	if _, found := l.Lookup(e.Recipient); found {
+		return
+	}
+
+	entry, err := l.Add(Entry{Address: e.Recipient, Reason: reason, Details: e.Reason, CreatedAt: e.At})
+	if err != nil {
+		logger.WarnContext(ctx, "failed to suppress recipient", "recipient", e.Recipient, "reason", reason, "error", err)
+		return
+	}
+	logger.InfoContext(ctx, "recipient suppressed", "recipient", entry.Address, "reason", reason, "provider", e.Provider)
+}
+
+// Filter returns the suppressed recipients of email, taking them out of its
+// envelope and headers unless the mode only tags them. It also reports
+// whether the message still has anyone to be delivered to. In reject mode
+// the headers are left as the sender wrote them, and callers refuse the
+// message when a header names a suppressed recipient.
+func (l *List) Filter(email *entity.Email) (suppressed []string, deliverable bool) {
+	isSuppressed := func(address string) bool {
+		if _, found := l.Lookup(address); !found {
+			return false
+		}
+		if normalized := Normalize(address); !slices.Contains(suppressed, normalized) {
+			suppressed = append(suppressed, normalized)
+		}
+		return l.mode != ModeTag
+	}
+	filterHeader := func(addresses []*mail.Address) []*mail.Address {
+		return slices.DeleteFunc(addresses, func(a *mail.Address) bool {
+			return a != nil && isSuppressed(a.Address)
+		})
+	}
+
+	email.Envelope.To = slices.DeleteFunc(email.Envelope.To, isSuppressed)
+	if l.mode == ModeReject {
+		for _, list := range [][]*mail.Address{email.Headers.To, email.Headers.CC, email.Headers.BCC} {
+			for _, a := range list {
+				if a != nil {
+					isSuppressed(a.Address)
+				}
+			}
+		}
+		return suppressed, len(email.Envelope.To) > 0
+	}
+
+	headers := &email.Headers
+	before := len(headers.To) + len(headers.CC) + len(headers.BCC)
+	headers.To = filterHeader(headers.To)
+	headers.CC = filterHeader(headers.CC)
+	headers.BCC = filterHeader(headers.BCC)
+	after := len(headers.To) + len(headers.CC) + len(headers.BCC)
+
+	// A message that never named its recipients in headers is left as it was
+	deliverable = len(email.Envelope.To) > 0 && (after > 0 || before == 0)
+	return suppressed, deliverable
+}
+
+// Close closes the store
+func (l *List) Close() error {
+	return l.store.Close()
+}
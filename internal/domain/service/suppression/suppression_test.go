@@ -0,0 +1,171 @@
+package suppression
+
+import (
+	"context"
+	"net/mail"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itsLeonB/smtproxy/internal/domain/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryStore keeps entries in a map
+type memoryStore struct {
+	entries map[string]Entry
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{entries: make(map[string]Entry)}
+}
+
+func (m *memoryStore) Put(e Entry) error {
+	m.entries[e.Address] = e
+	return nil
+}
+
+func (m *memoryStore) Get(address string) (Entry, error) {
+	e, exists := m.entries[address]
+	if !exists {
+		return Entry{}, ErrNotFound
+	}
+	return e, nil
+}
+
+func (m *memoryStore) Delete(address string) error {
+	if _, exists := m.entries[address]; !exists {
+		return ErrNotFound
+	}
+	delete(m.entries, address)
+	return nil
+}
+
+func (m *memoryStore) List() ([]Entry, error) {
+	var entries []Entry
+	for _, e := range m.entries {
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b Entry) int { return strings.Compare(a.Address, b.Address) })
+	return entries, nil
+}
+
+func (m *memoryStore) Close() error { return nil }
+
+var created = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func newList(mode Mode, addresses ...string) *List {
+	list := NewList(newMemoryStore(), mode)
+	list.now = func() time.Time { return created }
+	for _, address := range addresses {
+		_, _ = list.Add(Entry{Address: address})
+	}
+	return list
+}
+
+func TestList_AddAndLookup(t *testing.T) {
+	list := newList(ModeReject)
+
+	entry, err := list.Add(Entry{Address: " <Bob@Example.org> "})
+	assert.NoError(t, err)
+	assert.Equal(t, Entry{Address: "bob@example.org", Reason: ReasonManual, CreatedAt: created}, entry)
+
+	found, ok := list.Lookup("BOB@example.org")
+	assert.True(t, ok)
+	assert.Equal(t, entry, found)
+
+	_, ok = list.Lookup("alice@example.org")
+	assert.False(t, ok)
+
+	assert.NoError(t, list.Remove("bob@example.org"))
+	_, ok = list.Lookup("bob@example.org")
+	assert.False(t, ok)
+	assert.ErrorIs(t, list.Remove("bob@example.org"), ErrNotFound)
+}
+
+func TestList_AddInvalid(t *testing.T) {
+	list := newList(ModeReject)
+
+	_, err := list.Add(Entry{Address: "not an address"})
+	assert.ErrorIs(t, err, ErrInvalidEntry)
+	assert.ErrorContains(t, err, `invalid address "not an address"`)
+
+	_, err = list.Add(Entry{Address: "bob@example.org", Reason: "bored"})
+	assert.ErrorContains(t, err, `unknown reason "bored"`)
+}
+
+func TestList_SuppressEvent(t *testing.T) {
+	list := newList(ModeReject, "carol@example.org")
+	at := time.Date(2026, 10, 19, 9, 12, 5, 0, time.UTC)
+
+	list.SuppressEvent(context.Background(), entity.DeliveryEvent{Type: entity.EventBounced, Permanent: true, Recipient: "bob@example.org", Reason: "550 5.1.1 mailbox unavailable", At: at})
+	list.SuppressEvent(context.Background(), entity.DeliveryEvent{Type: entity.EventComplained, Recipient: "carol@example.org", At: at})
+	list.SuppressEvent(context.Background(), entity.DeliveryEvent{Type: entity.EventBounced, Recipient: "dave@example.org", At: at})
+	list.SuppressEvent(context.Background(), entity.DeliveryEvent{Type: entity.EventOpened, Recipient: "erin@example.org", At: at})
+
+	entries, err := list.Entries()
+	assert.NoError(t, err)
+	assert.Equal(t, []Entry{
+		{Address: "bob@example.org", Reason: ReasonHardBounce, Details: "550 5.1.1 mailbox unavailable", CreatedAt: at},
+		// Already suppressed addresses keep their entry
+		{Address: "carol@example.org", Reason: ReasonManual, CreatedAt: created},
+	}, entries)
+}
+
+func newFilterEmail() *entity.Email {
+	return &entity.Email{
+		Envelope: entity.Envelope{To: []string{"bob@example.org", "alice@example.org"}},
+		Headers: entity.Headers{
+			To: []*mail.Address{{Address: "Bob@example.org"}, {Address: "alice@example.org"}},
+			CC: []*mail.Address{{Address: "carol@example.org"}},
+		},
+	}
+}
+
+func TestList_Filter(t *testing.T) {
+	list := newList(ModeDrop, "bob@example.org", "carol@example.org")
+	email := newFilterEmail()
+
+	suppressed, deliverable := list.Filter(email)
+
+	assert.Equal(t, []string{"bob@example.org", "carol@example.org"}, suppressed)
+	assert.True(t, deliverable)
+	assert.Equal(t, []string{"alice@example.org"}, email.Envelope.To)
+	assert.Equal(t, []*mail.Address{{Address: "alice@example.org"}}, email.Headers.To)
+	assert.Empty(t, email.Headers.CC)
+}
+
+func TestList_FilterEveryRecipient(t *testing.T) {
+	list := newList(ModeReject, "bob@example.org", "alice@example.org")
+
+	_, deliverable := list.Filter(newFilterEmail())
+
+	assert.False(t, deliverable)
+}
+
+func TestList_FilterReject(t *testing.T) {
+	list := newList(ModeReject, "bob@example.org", "carol@example.org")
+	email := newFilterEmail()
+
+	suppressed, deliverable := list.Filter(email)
+
+	// Both are reported so the message can be refused, but only the envelope changes
+	assert.Equal(t, []string{"bob@example.org", "carol@example.org"}, suppressed)
+	assert.True(t, deliverable)
+	assert.Equal(t, []string{"alice@example.org"}, email.Envelope.To)
+	assert.Len(t, email.Headers.To, 2)
+	assert.Equal(t, []*mail.Address{{Address: "carol@example.org"}}, email.Headers.CC)
+}
+
+func TestList_FilterTagOnly(t *testing.T) {
+	list := newList(ModeTag, "bob@example.org")
+	email := newFilterEmail()
+
+	suppressed, deliverable := list.Filter(email)
+
+	assert.Equal(t, []string{"bob@example.org"}, suppressed)
+	assert.True(t, deliverable)
+	assert.Len(t, email.Envelope.To, 2)
+	assert.Len(t, email.Headers.To, 2)
+}